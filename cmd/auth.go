@@ -0,0 +1,306 @@
+package main
+
+import (
+	"GDrive/internal/config"
+	"GDrive/internal/drive"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// runAuth handles "auth add|list|remove|revoke". It loads the configuration
+// itself, since adding an account must work while a profile still refers to
+// it.
+func runAuth(args []string) {
+	actions := map[string]func(path string, f *config.File, args []string){
+		"add":    runAuthAdd,
+		"list":   runAuthList,
+		"remove": runAuthRemove,
+		"revoke": runAuthRevoke,
+	}
+	if len(args) == 0 || actions[args[0]] == nil {
+		fmt.Fprintln(os.Stderr, "usage: gdrive auth add|list|remove|revoke [flags] [account]")
+		os.Exit(exitUsage)
+	}
+	path := globalFlag(args, "config")
+	if path == "" {
+		path = config.DefaultPath()
+	}
+	f, err := config.Load(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "gdrive: %v\n", err)
+		os.Exit(exitConfig)
+	}
+	actions[args[0]](path, f, args[1:])
+}
+
+// runAuthAdd adds or updates an account in the configuration file and signs
+// in to it.
+func runAuthAdd(path string, f *config.File, args []string) {
+	fset := newFlagSet("auth add", "[flags] name")
+	credentials := fset.String("credentials", "", "OAuth client, service account or external account JSON, or adc (default configs/credentials.json)")
+	subject := fset.String("subject", "", "user a service account acts as through domain-wide delegation")
+	tokenFile := fset.String("token-file", "", "where the token is kept (default one per account next to the configuration file)")
+	tokenStore := fset.String("token-store", "", "file, encrypted or keyring (default file)")
+	scopes := fset.String("scopes", "", "comma-separated OAuth scopes: drive, drive.readonly, drive.file or drive.metadata.readonly (default drive)")
+	fset.Parse(args)
+	requireArgs(fset, 1)
+	name := fset.Arg(0)
+	if err := config.ValidAccountName(name); err != nil {
+		fmt.Fprintf(os.Stderr, "gdrive: %v\n", err)
+		os.Exit(exitUsage)
+	}
+
+	// flags left unset keep the settings of an existing account
+	a := f.Accounts[name]
+	fset.Visit(func(fl *flag.Flag) {
+		switch fl.Name {
+		case "credentials":
+			a.Credentials = *credentials
+		case "subject":
+			a.Subject = *subject
+		case "token-file":
+			a.TokenFile = *tokenFile
+		case "token-store":
+			a.TokenStore = *tokenStore
+		case "scopes":
+			a.Scopes = strings.FieldsFunc(*scopes, func(r rune) bool { return r == ',' })
+		}
+	})
+	if _, err := drive.ParseStore(a.TokenStore); err != nil {
+		fmt.Fprintf(os.Stderr, "gdrive: %v\n", err)
+		os.Exit(exitUsage)
+	}
+	if _, err := drive.ParseScopes(a.Scopes); err != nil {
+		fmt.Fprintf(os.Stderr, "gdrive: %v\n", err)
+		os.Exit(exitUsage)
+	}
+	if f.Accounts == nil {
+		f.Accounts = map[string]config.Account{}
+	}
+	f.Accounts[name] = a
+	cfg, err := accountAuthConfig(f, args, name)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "gdrive: %v\n", err)
+		os.Exit(exitConfig)
+	}
+	if _, err := drive.CheckCredentials(cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "gdrive: %v\n", err)
+		os.Exit(exitConfig)
+	}
+
+	// sign in before saving, so that a failed sign-in leaves no account
+	if _, err := drive.Authenticate(cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "gdrive: failed to sign in: %v\n", err)
+		os.Exit(exitAuth)
+	}
+	if err := config.SetAccount(path, name, &a); err != nil {
+		fatal(err)
+	}
+	fmt.Printf("account %s added to %s\n", name, path)
+}
+
+// accountInfo is the JSON form of an account.
+type accountInfo struct {
+	Name        string   `json:"name"`
+	Credentials string   `json:"credentials"`
+	Type        string   `json:"type,omitempty"`
+	TokenStore  string   `json:"tokenStore,omitempty"`
+	SignedIn    bool     `json:"signedIn"`
+	Profiles    []string `json:"profiles,omitempty"`
+	Error       string   `json:"error,omitempty"`
+}
+
+// runAuthList lists the accounts, whether they hold a token and which
+// profiles use them.
+func runAuthList(path string, f *config.File, args []string) {
+	fset := newFlagSet("auth list", "[-json]")
+	asJSON := fset.Bool("json", false, "print JSON")
+	fset.Parse(args)
+
+	var infos []accountInfo
+	for _, name := range f.AccountNames() {
+		info := accountInfo{Name: name, Profiles: profilesUsing(f, name)}
+		cfg, err := accountAuthConfig(f, args, name)
+		if err != nil {
+			info.Error = err.Error()
+			infos = append(infos, info)
+			continue
+		}
+		info.Credentials = orString(cfg.CredentialsFile, "configs/credentials.json")
+		info.Type, err = drive.CheckCredentials(cfg)
+		if err != nil {
+			info.Error = err.Error()
+		} else if usesToken(info.Type) {
+			// no migration here: listing must not move tokens around
+			store, err := drive.NewTokenStore(cfg.TokenStore, cfg.TokenFile)
+			if err == nil {
+				info.TokenStore = store.String()
+				_, err = store.Load()
+			}
+			info.SignedIn = err == nil
+			if err != nil && !errors.Is(err, drive.ErrNoToken) {
+				info.Error = err.Error()
+			}
+		} else {
+			info.SignedIn = true
+		}
+		infos = append(infos, info)
+	}
+
+	if *asJSON {
+		printJSON(infos)
+		return
+	}
+	if len(infos) == 0 {
+		fmt.Printf("no accounts in %s; add one with \"gdrive auth add <name>\"\n", path)
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ACCOUNT\tCREDENTIALS\tTOKEN\tPROFILES")
+	for _, info := range infos {
+		token := "signed out"
+		switch {
+		case info.Error != "":
+			token = "error: " + info.Error
+		case !usesToken(info.Type):
+			token = "not needed"
+		case info.SignedIn:
+			token = info.TokenStore
+		}
+		credentials := info.Credentials
+		if info.Type != "" {
+			credentials += " (" + info.Type + ")"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", info.Name, credentials, token, strings.Join(info.Profiles, ","))
+	}
+	w.Flush()
+}
+
+// runAuthRemove deletes an account's token and removes it from the
+// configuration file. The token stays valid at Google; revoke it first to
+// invalidate it.
+func runAuthRemove(path string, f *config.File, args []string) {
+	fset := newFlagSet("auth remove", "[-force] name")
+	force := fset.Bool("force", false, "remove the account even if profiles use it")
+	fset.Parse(args)
+	requireArgs(fset, 1)
+	name := fset.Arg(0)
+	if _, ok := f.Accounts[name]; !ok {
+		fmt.Fprintf(os.Stderr, "gdrive: unknown account %q\n", name)
+		os.Exit(exitNotFound)
+	}
+	if users := profilesUsing(f, name); len(users) > 0 && !*force {
+		fmt.Fprintf(os.Stderr, "gdrive: account %s is used by profiles %s (use -force to remove it anyway)\n", name, strings.Join(users, ", "))
+		os.Exit(exitConfig)
+	}
+	if err := deleteAccountToken(f, args, name); err != nil {
+		fatal(err)
+	}
+	if err := config.SetAccount(path, name, nil); err != nil {
+		fatal(err)
+	}
+	fmt.Printf("account %s removed\n", name)
+}
+
+// runAuthRevoke revokes the token of an account at Google and deletes it,
+// keeping the account so that it can sign in again. Without a name it acts
+// on the account of the selected profile.
+func runAuthRevoke(path string, f *config.File, args []string) {
+	fset := newFlagSet("auth revoke", "[name]")
+	fset.Parse(args)
+	name := fset.Arg(0)
+	if name != "" {
+		if _, ok := f.Accounts[name]; !ok {
+			fmt.Fprintf(os.Stderr, "gdrive: unknown account %q\n", name)
+			os.Exit(exitNotFound)
+		}
+	}
+	cfg, err := accountAuthConfig(f, args, name)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "gdrive: %v\n", err)
+		os.Exit(exitConfig)
+	}
+	if err := revokeToken(cfg); err != nil {
+		fatal(err)
+	}
+}
+
+// revokeToken revokes the token kept for cfg at Google and deletes it from
+// its store.
+func revokeToken(cfg drive.AuthConfig) error {
+	store, err := drive.OpenTokenStore(cfg)
+	if err != nil {
+		return err
+	}
+	tok, err := store.Load()
+	if errors.Is(err, drive.ErrNoToken) {
+		fmt.Println("not signed in")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := drive.RevokeToken(context.Background(), tok); err != nil {
+		return err
+	}
+	if err := store.Delete(); err != nil {
+		return fmt.Errorf("token revoked but not deleted from %s: %v", store, err)
+	}
+	fmt.Printf("token revoked and deleted from %s\n", store)
+	return nil
+}
+
+// accountAuthConfig returns the sign-in settings of the named account, with
+// the auth flow settings of the profile selected in args. An empty name
+// selects the profile's own sign-in settings.
+func accountAuthConfig(f *config.File, args []string, name string) (drive.AuthConfig, error) {
+	prof, err := f.ProfileFor(globalFlag(args, "profile"), name)
+	if err != nil {
+		return drive.AuthConfig{}, err
+	}
+	if flow := globalFlag(args, "auth-flow"); flow != "" {
+		prof.AuthFlow = flow
+	}
+	return authConfigFor(prof), nil
+}
+
+// deleteAccountToken deletes the token of the named account from its store.
+func deleteAccountToken(f *config.File, args []string, name string) error {
+	cfg, err := accountAuthConfig(f, args, name)
+	if err != nil {
+		return err
+	}
+	typ, err := drive.CheckCredentials(cfg)
+	if err == nil && !usesToken(typ) {
+		return nil
+	}
+	store, err := drive.OpenTokenStore(cfg)
+	if err != nil {
+		return err
+	}
+	return store.Delete()
+}
+
+// profilesUsing returns the profiles that sign in as the named account.
+func profilesUsing(f *config.File, name string) []string {
+	var names []string
+	for n, p := range f.Profiles {
+		if p.Account == name {
+			names = append(names, n)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// usesToken reports whether credentials of type typ sign in with a stored
+// OAuth token rather than on their own.
+func usesToken(typ string) bool {
+	return typ == drive.CredentialsOAuthClient
+}
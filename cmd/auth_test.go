@@ -0,0 +1,105 @@
+package main
+
+import (
+	"GDrive/internal/config"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeAccounts writes a configuration file with two accounts, one used by
+// two profiles, and loads it.
+func writeAccounts(t *testing.T) (string, *config.File) {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(dir, "config"))
+	t.Setenv("XDG_CACHE_HOME", filepath.Join(dir, "cache"))
+	t.Setenv("GDRIVE_CONFIG", "")
+	path := filepath.Join(dir, "config.yaml")
+	content := `accounts:
+  home:
+    credentials: ` + filepath.Join(dir, "missing.json") + `
+    token_file: ` + filepath.Join(dir, "home-token.json") + `
+  work: {}
+profiles:
+  photos:
+    account: home
+  music:
+    account: home
+  other: {}
+`
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	f, err := config.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path, f
+}
+
+func TestAccountRegistry(t *testing.T) {
+	path, f := writeAccounts(t)
+	if got := strings.Join(profilesUsing(f, "home"), ","); got != "music,photos" {
+		t.Errorf("profiles using home = %s, want music,photos", got)
+	}
+	if got := profilesUsing(f, "work"); len(got) != 0 {
+		t.Errorf("profiles using work = %q, want none", got)
+	}
+
+	cfg, err := accountAuthConfig(f, nil, "home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Base(cfg.TokenFile) != "home-token.json" {
+		t.Errorf("home token file = %s", cfg.TokenFile)
+	}
+	// accounts without a token file get their own next to the configuration
+	cfg, err = accountAuthConfig(f, nil, "work")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join("tokens", "work.json"); !strings.HasSuffix(cfg.TokenFile, want) {
+		t.Errorf("work token file = %s, want one ending in %s", cfg.TokenFile, want)
+	}
+	if _, err := accountAuthConfig(f, nil, "nobody"); err == nil {
+		t.Error("unknown account accepted")
+	}
+
+	if err := config.SetAccount(path, "school", &config.Account{TokenStore: "keyring"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := config.SetAccount(path, "work", nil); err != nil {
+		t.Fatal(err)
+	}
+	f, err = config.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(f.AccountNames(), ","); got != "home,school" {
+		t.Errorf("accounts = %s, want home,school", got)
+	}
+	if f.Accounts["school"].TokenStore != "keyring" || len(f.Profiles) != 3 {
+		t.Errorf("file after update = %+v", f)
+	}
+}
+
+func TestDeleteAccountToken(t *testing.T) {
+	_, f := writeAccounts(t)
+	token := f.Accounts["home"].TokenFile
+	if err := os.WriteFile(token, []byte(`{"access_token":"a","refresh_token":"r"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := deleteAccountToken(f, nil, "home"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(token); !os.IsNotExist(err) {
+		t.Errorf("token file kept: %v", err)
+	}
+	// deleting a token that is already gone is not an error
+	if err := deleteAccountToken(f, nil, "home"); err != nil {
+		t.Errorf("second delete = %v", err)
+	}
+}
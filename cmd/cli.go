@@ -0,0 +1,152 @@
+package main
+
+import (
+	"GDrive/internal/drive"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	googleDrive "google.golang.org/api/drive/v3"
+)
+
+// Exit codes shared by all subcommands.
+const (
+	exitOK       = 0
+	exitFailure  = 1
+	exitUsage    = 2 // also used by the flag package for bad flags
+	exitNotFound = 3
+	exitAuth     = 4
+	exitConfig   = 5
+)
+
+// newFlagSet returns the flag set of a subcommand with a usage line.
+func newFlagSet(name, usage string) *flag.FlagSet {
+	fset := flag.NewFlagSet(name, flag.ExitOnError)
+	fset.Usage = func() {
+		fmt.Fprintf(fset.Output(), "usage: gdrive %s %s\n", name, usage)
+		fset.PrintDefaults()
+	}
+	configFlags(fset)
+	return fset
+}
+
+// requireArgs exits with a usage error unless fset has at least n arguments.
+func requireArgs(fset *flag.FlagSet, n int) {
+	if fset.NArg() < n {
+		fset.Usage()
+		os.Exit(exitUsage)
+	}
+}
+
+// connectDrive authenticates with the profile's credentials and returns a
+// Drive service rooted at its root folder, exiting on failure.
+func connectDrive() *drive.DriveService {
+	client, err := drive.Authenticate(authConfig())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "gdrive: failed to authenticate Google Drive: %v\n", err)
+		os.Exit(exitAuth)
+	}
+	d := drive.NewDriveService(client)
+	if err := setupDrive(d); err != nil {
+		fmt.Fprintf(os.Stderr, "gdrive: %v\n", err)
+		os.Exit(exitConfig)
+	}
+	return d
+}
+
+// exitCode maps an error to the exit code reported for it.
+func exitCode(err error) int {
+	if err == nil {
+		return exitOK
+	}
+	if drive.IsNotFound(err) || errors.Is(err, os.ErrNotExist) {
+		return exitNotFound
+	}
+	return exitFailure
+}
+
+// status tracks the exit code of a command that carries on past errors,
+// keeping the first failure.
+type status int
+
+// fail reports err on stderr and records its exit code.
+func (s *status) fail(err error) {
+	fmt.Fprintf(os.Stderr, "gdrive: %v\n", err)
+	if *s == exitOK {
+		*s = status(exitCode(err))
+	}
+}
+
+// exit ends the process with the recorded code.
+func (s status) exit() {
+	os.Exit(int(s))
+}
+
+// fatal reports err and exits with its code.
+func fatal(err error) {
+	var s status
+	s.fail(err)
+	s.exit()
+}
+
+// printJSON writes v to stdout as indented JSON.
+func printJSON(v interface{}) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		fatal(err)
+	}
+}
+
+// fileInfo is the JSON form of a Drive file.
+type fileInfo struct {
+	Path     string `json:"path"`
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	MimeType string `json:"mimeType"`
+	Folder   bool   `json:"folder"`
+	Size     int64  `json:"size"`
+	Modified string `json:"modifiedTime,omitempty"`
+	MD5      string `json:"md5Checksum,omitempty"`
+	Version  int64  `json:"version,omitempty"`
+}
+
+func newFileInfo(path string, f *googleDrive.File) fileInfo {
+	return fileInfo{
+		Path:     path,
+		ID:       f.Id,
+		Name:     f.Name,
+		MimeType: f.MimeType,
+		Folder:   drive.IsFolder(f),
+		Size:     f.Size,
+		Modified: f.ModifiedTime,
+		MD5:      f.Md5Checksum,
+		Version:  f.Version,
+	}
+}
+
+// modified formats the modification time of f for listings.
+func modified(f *googleDrive.File) string {
+	t, err := time.Parse(time.RFC3339, f.ModifiedTime)
+	if err != nil {
+		return "-"
+	}
+	return t.Local().Format("2006-01-02 15:04")
+}
+
+// humanBytes formats n with a binary unit, e.g. "1.5 GiB".
+func humanBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"GDrive/internal/cache"
+	"GDrive/internal/config"
+	"GDrive/internal/drive"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// The configuration file and profile selected for this run.
+var (
+	configFile *config.File
+	profile    config.Profile
+)
+
+// globalFlag returns the value of the flag -name (or --name) in args, given
+// as "-name value" or "-name=value", so that the profile is known before the
+// subcommand's own flags, whose defaults it supplies, are registered.
+func globalFlag(args []string, name string) string {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		arg = strings.TrimPrefix(strings.TrimPrefix(arg, "-"), "-")
+		if arg == name && i+1 < len(args) {
+			return args[i+1]
+		}
+		if value, ok := strings.CutPrefix(arg, name+"="); ok {
+			return value
+		}
+	}
+	return ""
+}
+
+// loadConfig loads the configuration file and profile named in args.
+func loadConfig(args []string) error {
+	f, err := config.Load(globalFlag(args, "config"))
+	if err != nil {
+		return err
+	}
+	prof, err := f.ProfileFor(globalFlag(args, "profile"), globalFlag(args, "account"))
+	if err != nil {
+		return err
+	}
+	if flow := globalFlag(args, "auth-flow"); flow != "" {
+		prof.AuthFlow = flow
+	}
+	if _, err := drive.ParseStore(prof.TokenStore); err != nil {
+		return err
+	}
+	if _, err := drive.ParseScopes(prof.Scopes); err != nil {
+		return err
+	}
+	if _, err := drive.ParseFlow(prof.AuthFlow); err != nil {
+		return err
+	}
+	configFile, profile = f, prof
+	return nil
+}
+
+// configFlags registers -config, -profile, -account and -auth-flow on fset. They are
+// read by loadConfig before parsing and only registered so that parsing
+// accepts them.
+func configFlags(fset *flag.FlagSet) {
+	fset.String("config", "", "configuration file (default $GDRIVE_CONFIG or "+config.DefaultPath()+")")
+	fset.String("profile", "", "configuration profile (default $GDRIVE_PROFILE or the file's default_profile)")
+	fset.String("account", "", "account to sign in as instead of the profile's (default $GDRIVE_ACCOUNT)")
+	fset.String("auth-flow", "", "how to sign in if needed: auto, browser, device or paste (default auto)")
+}
+
+// authConfig returns where the profile keeps credentials and tokens.
+func authConfig() drive.AuthConfig {
+	return authConfigFor(profile)
+}
+
+// authConfigFor returns where prof keeps credentials and tokens.
+func authConfigFor(prof config.Profile) drive.AuthConfig {
+	return drive.AuthConfig{
+		CredentialsFile: prof.Credentials,
+		Subject:         prof.Subject,
+		TokenFile:       prof.TokenFile,
+		TokenStore:      prof.TokenStore,
+		RedirectPort:    prof.AuthPort,
+		Timeout:         prof.AuthTimeout,
+		Scopes:          prof.Scopes,
+		Flow:            prof.AuthFlow,
+	}
+}
+
+// setupDrive applies the profile's root folder and export formats to d.
+func setupDrive(d *drive.DriveService) error {
+	d.SetExportFormats(profile.ExportFormats)
+	d.SetSharedDrives(!profile.DisableSharedDrives)
+	d.SetSharedWithMe(!profile.DisableSharedWithMe)
+	if profile.RootFolder == "" {
+		return nil
+	}
+	root, err := d.Resolve(profile.RootFolder)
+	if err != nil {
+		return fmt.Errorf("root folder %s: %w", profile.RootFolder, err)
+	}
+	if !drive.IsFolder(root) || drive.IsVirtual(root) && root.DriveId == "" {
+		return fmt.Errorf("root folder %s is not a folder", profile.RootFolder)
+	}
+	d.SetRootFolder(root)
+	return nil
+}
+
+// runConfig handles "config validate" and "config show".
+func runConfig(args []string) {
+	if len(args) == 0 || (args[0] != "validate" && args[0] != "show") {
+		fmt.Fprintln(os.Stderr, "usage: gdrive config validate|show [-config path] [-profile name]")
+		os.Exit(exitUsage)
+	}
+	fset := newFlagSet("config "+args[0], "[-config path] [-profile name]")
+	fset.Parse(args[1:])
+	path := globalFlag(args, "config")
+	if path == "" {
+		path = config.DefaultPath()
+	}
+	f, err := config.Load(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "gdrive: %v\n", err)
+		os.Exit(exitConfig)
+	}
+
+	name := globalFlag(args, "profile")
+	if args[0] == "show" {
+		prof, err := f.Profile(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "gdrive: %v\n", err)
+			os.Exit(exitConfig)
+		}
+		data, err := prof.Marshal()
+		if err != nil {
+			fatal(err)
+		}
+		fmt.Printf("# profile %s from %s\n%s", f.ProfileName(name), path, data)
+		return
+	}
+
+	names := []string{f.ProfileName(name)}
+	all := name == "" && os.Getenv("GDRIVE_PROFILE") == "" && len(f.Profiles) > 0
+	if all {
+		names = f.ProfileNames()
+	}
+	valid := true
+	report := func(kind, name string, problems []string) {
+		if len(problems) == 0 {
+			fmt.Printf("%s %s: ok\n", kind, name)
+			return
+		}
+		valid = false
+		for _, problem := range problems {
+			fmt.Printf("%s %s: %s\n", kind, name, problem)
+		}
+	}
+	for _, n := range names {
+		report("profile", n, validateProfile(f, n))
+	}
+	if all {
+		// accounts no profile uses are checked too
+		for _, n := range f.AccountNames() {
+			report("account", n, validateAccount(f.Accounts[n], n))
+		}
+	}
+	if !valid {
+		os.Exit(exitConfig)
+	}
+}
+
+// validateProfile returns what is wrong with the named profile.
+func validateProfile(f *config.File, name string) []string {
+	prof, err := f.Profile(name)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	var problems []string
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if _, err := drive.CheckCredentials(drive.AuthConfig{CredentialsFile: prof.Credentials, Subject: prof.Subject}); err != nil {
+		add("credentials: %v", err)
+	}
+	if _, err := drive.ParseStore(prof.TokenStore); err != nil {
+		add("token_store: %v", err)
+	} else if prof.TokenStore == drive.StoreEncrypted && os.Getenv(drive.PassphraseEnv) == "" {
+		add("token_store: encrypted needs a passphrase in $%s", drive.PassphraseEnv)
+	}
+	if _, err := drive.ParseScopes(prof.Scopes); err != nil {
+		add("scopes: %v", err)
+	}
+	if _, err := drive.ParseFlow(prof.AuthFlow); err != nil {
+		add("auth_flow: %v", err)
+	}
+	if prof.AuthPort < 0 || prof.AuthPort > 65535 {
+		add("auth_port: %d is not a port", prof.AuthPort)
+	}
+	if prof.MountPoint != "" && !(runtime.GOOS == "windows" && strings.HasSuffix(prof.MountPoint, ":")) {
+		if _, err := os.Stat(filepath.Dir(prof.MountPoint)); err != nil {
+			add("mount_point: parent directory: %v", err)
+		}
+	}
+	for _, from := range sortedKeys(prof.ExportFormats) {
+		to := prof.ExportFormats[from]
+		if !drive.IsGoogleFormat(from) {
+			add("export_formats: %s is not a Google Docs type", from)
+		}
+		if drive.ExportExtension(to) == "" {
+			add("export_formats: unknown export type %s", to)
+		}
+	}
+	if prof.Log.File != "" {
+		if _, err := os.Stat(filepath.Dir(prof.Log.File)); err != nil {
+			add("log.file: directory: %v", err)
+		}
+	}
+	switch prof.Cache.Backend {
+	case "", cache.BackendMemory, cache.BackendDisk, cache.BackendRedis:
+	default:
+		add("cache.backend: unknown backend %q (want memory, disk or redis)", prof.Cache.Backend)
+	}
+	if prof.Cache.Backend == cache.BackendRedis && prof.Cache.RedisAddr == "" {
+		add("cache.backend: redis requires cache.redis_addr")
+	}
+	for _, v := range []struct {
+		key   string
+		value int64
+	}{
+		{"auth_timeout", int64(prof.AuthTimeout)},
+		{"cache.memory_max_bytes", prof.Cache.MemoryMaxBytes},
+		{"cache.block_cache_max_bytes", prof.Cache.BlockCacheMaxBytes},
+		{"cache.max_bytes", prof.Cache.MaxBytes},
+		{"cache.prefetch_bandwidth", prof.Cache.PrefetchBandwidth},
+		{"cache.prefetch_memory", prof.Cache.PrefetchMemory},
+		{"mount.attr_timeout", int64(prof.Mount.AttrTimeout)},
+		{"mount.entry_timeout", int64(prof.Mount.EntryTimeout)},
+		{"sync.lock_ttl", int64(prof.Sync.LockTTL)},
+	} {
+		if v.value < 0 {
+			add("%s: must not be negative", v.key)
+		}
+	}
+
+	// the same checks the mount applies to its flags
+	fset := flag.NewFlagSet("validate", flag.ContinueOnError)
+	fset.SetOutput(io.Discard)
+	if _, err := cacheFlags(fset, prof)(); err != nil {
+		add("sync: %v", err)
+	}
+	return problems
+}
+
+// validateAccount returns what is wrong with the account a called name.
+func validateAccount(a config.Account, name string) []string {
+	var problems []string
+	if err := config.ValidAccountName(name); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if _, err := drive.CheckCredentials(drive.AuthConfig{CredentialsFile: config.ExpandHome(a.Credentials), Subject: a.Subject}); err != nil {
+		problems = append(problems, fmt.Sprintf("credentials: %v", err))
+	}
+	if _, err := drive.ParseStore(a.TokenStore); err != nil {
+		problems = append(problems, fmt.Sprintf("token_store: %v", err))
+	}
+	if _, err := drive.ParseScopes(a.Scopes); err != nil {
+		problems = append(problems, fmt.Sprintf("scopes: %v", err))
+	}
+	return problems
+}
+
+// sortedKeys returns the keys of m in order.
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"GDrive/internal/config"
+	"strings"
+	"testing"
+)
+
+// formatProblems returns the export format and negative size problems of
+// the named profile.
+func formatProblems(f *config.File, name string) string {
+	var got []string
+	for _, problem := range validateProfile(f, name) {
+		if strings.HasPrefix(problem, "export_formats:") || strings.HasSuffix(problem, "must not be negative") {
+			got = append(got, problem)
+		}
+	}
+	return strings.Join(got, "\n")
+}
+
+func TestValidateProfileOrder(t *testing.T) {
+	f := &config.File{Profiles: map[string]config.Profile{"work": {
+		ExportFormats: map[string]string{
+			"text/plain":                           "application/pdf",
+			"application/vnd.google-apps.document": "application/x-unknown",
+			"image/png":                            "image/png",
+		},
+		Cache: config.Cache{PrefetchMemory: -1, MemoryMaxBytes: -1},
+	}}}
+	want := strings.Join([]string{
+		"export_formats: unknown export type application/x-unknown",
+		"export_formats: image/png is not a Google Docs type",
+		"export_formats: text/plain is not a Google Docs type",
+		"cache.memory_max_bytes: must not be negative",
+		"cache.prefetch_memory: must not be negative",
+	}, "\n")
+	// map order changes between runs, the output must not
+	for i := 0; i < 5; i++ {
+		if got := formatProblems(f, "work"); got != want {
+			t.Fatalf("problems:\n%s\nwant:\n%s", got, want)
+		}
+	}
+}
+
+func TestValidateAccount(t *testing.T) {
+	problems := validateAccount(config.Account{TokenStore: "vault", Scopes: []string{"drive.everything"}}, "a b")
+	var fields []string
+	for _, problem := range problems {
+		fields = append(fields, strings.SplitN(problem, ":", 2)[0])
+	}
+	for _, want := range []string{"invalid account name \"a b\"", "token_store", "scopes"} {
+		found := false
+		for _, field := range fields {
+			found = found || strings.HasPrefix(field, want)
+		}
+		if !found {
+			t.Errorf("no %s problem in %q", want, problems)
+		}
+	}
+}
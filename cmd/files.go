@@ -0,0 +1,292 @@
+package main
+
+import (
+	"GDrive/internal/drive"
+	"fmt"
+	"os"
+	p "path"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	googleDrive "google.golang.org/api/drive/v3"
+)
+
+// expand resolves a path or glob on Drive to the files it names. A glob
+// matching nothing is reported as not found.
+func expand(d *drive.DriveService, arg string) ([]drive.PathMatch, error) {
+	if strings.ContainsAny(arg, `*?[\`) {
+		matches, err := d.Glob(arg)
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("%s: %w", arg, drive.ErrNotFound)
+		}
+		return matches, nil
+	}
+	f, err := d.Resolve(arg)
+	if err != nil {
+		return nil, err
+	}
+	return []drive.PathMatch{{Path: strings.Trim(p.Clean("/"+arg), "/"), File: f}}, nil
+}
+
+// runLs lists folders, or files themselves, sorted by name.
+func runLs(args []string) {
+	fset := newFlagSet("ls", "[-l] [-json] [path or glob]...")
+	long := fset.Bool("l", false, "long format with type, size and modification time")
+	asJSON := fset.Bool("json", false, "print JSON")
+	fset.Parse(args)
+	paths := fset.Args()
+	if len(paths) == 0 {
+		paths = []string{"/"}
+	}
+
+	d := connectDrive()
+	var st status
+	var entries []drive.PathMatch
+	for _, arg := range paths {
+		matches, err := expand(d, arg)
+		if err != nil {
+			st.fail(err)
+			continue
+		}
+		for _, m := range matches {
+			if !drive.IsFolder(m.File) {
+				entries = append(entries, m)
+				continue
+			}
+			children, err := d.ListChildren(m.File)
+			if err != nil {
+				st.fail(err)
+				continue
+			}
+			for _, c := range children {
+				entries = append(entries, drive.PathMatch{Path: p.Join(m.Path, c.Name), File: c})
+			}
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+
+	switch {
+	case *asJSON:
+		infos := make([]fileInfo, 0, len(entries))
+		for _, e := range entries {
+			infos = append(infos, newFileInfo(e.Path, e.File))
+		}
+		printJSON(infos)
+	case *long:
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+		for _, e := range entries {
+			kind, name := "-", e.File.Name
+			if drive.IsFolder(e.File) {
+				kind, name = "d", name+"/"
+			}
+			fmt.Fprintf(w, "%s\t%d\t%s\t %s\n", kind, e.File.Size, modified(e.File), name)
+		}
+		w.Flush()
+	default:
+		for _, e := range entries {
+			if drive.IsFolder(e.File) {
+				fmt.Println(e.File.Name + "/")
+			} else {
+				fmt.Println(e.File.Name)
+			}
+		}
+	}
+	st.exit()
+}
+
+// runStat prints the metadata of files.
+func runStat(args []string) {
+	fset := newFlagSet("stat", "[-json] <path or glob>...")
+	asJSON := fset.Bool("json", false, "print JSON")
+	fset.Parse(args)
+	requireArgs(fset, 1)
+
+	d := connectDrive()
+	var st status
+	var infos []fileInfo
+	for _, arg := range fset.Args() {
+		matches, err := expand(d, arg)
+		if err != nil {
+			st.fail(err)
+			continue
+		}
+		for _, m := range matches {
+			infos = append(infos, newFileInfo(m.Path, m.File))
+		}
+	}
+	if *asJSON {
+		printJSON(infos)
+		st.exit()
+	}
+	for i, info := range infos {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("Path:     /%s\n", info.Path)
+		fmt.Printf("ID:       %s\n", info.ID)
+		fmt.Printf("Type:     %s\n", info.MimeType)
+		fmt.Printf("Size:     %d\n", info.Size)
+		fmt.Printf("Modified: %s\n", info.Modified)
+		if info.MD5 != "" {
+			fmt.Printf("MD5:      %s\n", info.MD5)
+		}
+		fmt.Printf("Version:  %d\n", info.Version)
+	}
+	st.exit()
+}
+
+// runMkdir creates folders.
+func runMkdir(args []string) {
+	fset := newFlagSet("mkdir", "[-p] [-json] <path>...")
+	parents := fset.Bool("p", false, "create missing parents and accept existing folders")
+	asJSON := fset.Bool("json", false, "print the created folders as JSON")
+	fset.Parse(args)
+	requireArgs(fset, 1)
+
+	d := connectDrive()
+	var st status
+	var created []fileInfo
+	for _, arg := range fset.Args() {
+		path := strings.Trim(p.Clean("/"+arg), "/")
+		folder, err := mkdir(d, path, *parents)
+		if err != nil {
+			st.fail(err)
+			continue
+		}
+		created = append(created, newFileInfo(path, folder))
+	}
+	if *asJSON {
+		printJSON(created)
+	}
+	st.exit()
+}
+
+// mkdir creates the folder at path, whose parent must exist unless
+// parents is set.
+func mkdir(d *drive.DriveService, path string, parents bool) (*googleDrive.File, error) {
+	if parents {
+		return d.MkdirAll(path)
+	}
+	parent, err := d.Resolve(p.Dir(path))
+	if err != nil {
+		return nil, err
+	}
+	existing, err := d.FindFile(parent.Id, p.Base(path))
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, fmt.Errorf("%s already exists", path)
+	}
+	return d.CreateFolder(p.Base(path), parent.Id)
+}
+
+// runRm moves files to the Drive trash.
+func runRm(args []string) {
+	fset := newFlagSet("rm", "[-r] [-json] <path or glob>...")
+	recursive := fset.Bool("r", false, "remove folders and their contents")
+	asJSON := fset.Bool("json", false, "print the removed files as JSON")
+	fset.Parse(args)
+	requireArgs(fset, 1)
+
+	d := connectDrive()
+	var st status
+	var removed []fileInfo
+	for _, arg := range fset.Args() {
+		matches, err := expand(d, arg)
+		if err != nil {
+			st.fail(err)
+			continue
+		}
+		for _, m := range matches {
+			if m.Path == "" {
+				st.fail(fmt.Errorf("refusing to remove the root folder"))
+				continue
+			}
+			if drive.IsFolder(m.File) && !*recursive {
+				st.fail(fmt.Errorf("%s is a folder (use -r)", m.Path))
+				continue
+			}
+			if err := d.TrashFile(m.File.Id); err != nil {
+				st.fail(err)
+				continue
+			}
+			removed = append(removed, newFileInfo(m.Path, m.File))
+		}
+	}
+	if *asJSON {
+		printJSON(removed)
+	}
+	st.exit()
+}
+
+// runMv renames or moves a file. If the destination is an existing folder
+// the file is moved into it.
+func runMv(args []string) {
+	fset := newFlagSet("mv", "[-json] <source> <destination>")
+	asJSON := fset.Bool("json", false, "print the moved file as JSON")
+	fset.Parse(args)
+	if fset.NArg() != 2 {
+		fset.Usage()
+		os.Exit(exitUsage)
+	}
+	src, dst := fset.Arg(0), strings.Trim(p.Clean("/"+fset.Arg(1)), "/")
+
+	d := connectDrive()
+	file, err := d.Resolve(src)
+	if err != nil {
+		fatal(err)
+	}
+	if len(file.Parents) == 0 {
+		fatal(fmt.Errorf("cannot move %s", src))
+	}
+	target, err := d.Resolve(dst)
+	if err != nil && !drive.IsNotFound(err) {
+		fatal(err)
+	}
+	name, parent := file.Name, target
+	switch {
+	case target != nil && drive.IsFolder(target):
+		dst = p.Join(dst, name)
+	case target != nil:
+		fatal(fmt.Errorf("%s already exists", dst))
+	default:
+		name = p.Base(dst)
+		if parent, err = d.Resolve(p.Dir(dst)); err != nil {
+			fatal(err)
+		}
+	}
+	moved, err := d.MoveFile(file.Id, name, file.Parents[0], parent.Id)
+	if err != nil {
+		fatal(err)
+	}
+	if *asJSON {
+		printJSON(newFileInfo(dst, moved))
+	}
+}
+
+// runQuota prints storage usage.
+func runQuota(args []string) {
+	fset := newFlagSet("quota", "[-json]")
+	asJSON := fset.Bool("json", false, "print JSON")
+	fset.Parse(args)
+
+	total, used, err := connectDrive().GetQuota()
+	if err != nil {
+		fatal(err)
+	}
+	if *asJSON {
+		printJSON(map[string]uint64{"total": total, "used": used})
+		return
+	}
+	if total == 0 {
+		fmt.Printf("%s used (unlimited)\n", humanBytes(int64(used)))
+		return
+	}
+	fmt.Printf("%s of %s used (%.1f%%), %s free\n", humanBytes(int64(used)), humanBytes(int64(total)),
+		100*float64(used)/float64(total), humanBytes(int64(total-used)))
+}
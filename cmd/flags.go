@@ -0,0 +1,120 @@
+package main
+
+import (
+	"GDrive/internal/config"
+	"GDrive/internal/fs"
+	"GDrive/internal/lock"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// optionList collects the values of a repeatable string flag.
+type optionList []string
+
+func (l *optionList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *optionList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// orString, orInt, orInt64 and orDuration return v, or def if v is zero.
+// Flags use them to default to the profile's setting, then the built-in one.
+func orString(v, def string) string {
+	if v == "" {
+		return def
+	}
+	return v
+}
+
+func orInt(v, def int) int {
+	if v == 0 {
+		return def
+	}
+	return v
+}
+
+func orInt64(v, def int64) int64 {
+	if v == 0 {
+		return def
+	}
+	return v
+}
+
+func orDuration(v, def time.Duration) time.Duration {
+	if v == 0 {
+		return def
+	}
+	return v
+}
+
+// cacheFlags registers the cache and sync flags shared by mount and warm,
+// defaulting to the settings of prof. The returned function builds
+// fs.Options once the flags are parsed.
+func cacheFlags(fset *flag.FlagSet, prof config.Profile) func() (fs.Options, error) {
+	c, s := prof.Cache, prof.Sync
+	stateDir := fset.String("state-dir", prof.StateDir, "directory of the index, offline queue and caches (default in the user cache directory)")
+	conflictPolicy := fset.String("conflict-policy", orString(s.ConflictPolicy, string(fs.ConflictKeepBoth)),
+		"how to resolve files changed on Drive while open: keep-both, local-wins, remote-wins or fail")
+	memMaxBytes := fset.Int64("mem-cache-max-bytes", orInt64(c.MemoryMaxBytes, 512<<20), "size limit of the in-process content cache in bytes")
+	memMaxEntries := fset.Int("mem-cache-max-entries", orInt(c.MemoryMaxEntries, 10000), "entry limit of the in-process content cache")
+	blockCacheMaxBytes := fset.Int64("block-cache-max-bytes", c.BlockCacheMaxBytes, "size limit of the persistent on-disk block cache in bytes (0 disables it)")
+	blockCacheDir := fset.String("block-cache-dir", c.BlockCacheDir, "directory of the persistent block cache")
+	noPrefetch := fset.Bool("no-prefetch", c.DisablePrefetch, "disable adaptive prefetching")
+	prefetchBandwidth := fset.Int64("prefetch-bandwidth", c.PrefetchBandwidth, "prefetch download limit in bytes per second (0 means unlimited)")
+	prefetchMemory := fset.Int64("prefetch-memory", orInt64(c.PrefetchMemory, 128<<20), "bytes that may be prefetched at once")
+	cacheBackend := fset.String("cache", c.Backend, "second-level content cache: memory, disk or redis (default none, or redis if -redis-addr is set)")
+	cacheDir := fset.String("cache-dir", c.Dir, "directory for the disk cache")
+	cacheMaxBytes := fset.Int64("cache-max-bytes", orInt64(c.MaxBytes, 10<<30), "size limit of the memory or disk cache in bytes")
+	redisAddr := fset.String("redis-addr", c.RedisAddr, "Redis address for a shared content cache, e.g. localhost:6379")
+	redisTTL := fset.Duration("redis-ttl", orDuration(c.RedisTTL, 24*time.Hour), "how long content is kept in the shared Redis cache")
+	redisChannel := fset.String("redis-channel", orString(c.RedisChannel, "gdrivefs:invalidate"), "Redis pub/sub channel for cache invalidations between mounts")
+	lockBackend := fset.String("lock", s.Lock, "write leases shared between mounts: redis or drive (default none)")
+	lockTTL := fset.Duration("lock-ttl", orDuration(s.LockTTL, 30*time.Second), "how long a write lease outlives a mount that stopped renewing it")
+	exclusiveCreate := fset.Bool("exclusive-create", s.ExclusiveCreate, "fail creating files that already exist, as with O_EXCL")
+	controlSocket := fset.String("control-socket", s.ControlSocket, "control socket of the mount (default in the state directory)")
+
+	return func() (fs.Options, error) {
+		policy, err := fs.ParseConflictPolicy(*conflictPolicy)
+		if err != nil {
+			return fs.Options{}, err
+		}
+		if *lockTTL < lock.MinTTL {
+			return fs.Options{}, fmt.Errorf("-lock-ttl must be at least %s", lock.MinTTL)
+		}
+		switch *lockBackend {
+		case "", lock.BackendDrive:
+		case lock.BackendRedis:
+			if *redisAddr == "" {
+				return fs.Options{}, fmt.Errorf("-lock redis requires -redis-addr")
+			}
+		default:
+			return fs.Options{}, fmt.Errorf("unknown lock backend %q (want redis or drive)", *lockBackend)
+		}
+		return fs.Options{
+			StateDir:           *stateDir,
+			ConflictPolicy:     policy,
+			ControlSocket:      *controlSocket,
+			MemoryMaxBytes:     *memMaxBytes,
+			MemoryMaxEntries:   *memMaxEntries,
+			BlockCacheMaxBytes: *blockCacheMaxBytes,
+			BlockCacheDir:      *blockCacheDir,
+			DisablePrefetch:    *noPrefetch,
+			PrefetchBandwidth:  *prefetchBandwidth,
+			PrefetchMemory:     *prefetchMemory,
+			Cache:              *cacheBackend,
+			CacheDir:           *cacheDir,
+			CacheMaxBytes:      *cacheMaxBytes,
+			RedisAddr:          *redisAddr,
+			RedisTTL:           *redisTTL,
+			RedisChannel:       *redisChannel,
+			Lock:               *lockBackend,
+			LockTTL:            *lockTTL,
+			ExclusiveCreate:    *exclusiveCreate,
+		}, nil
+	}
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"GDrive/internal/config"
+	"flag"
+	"io"
+	"testing"
+)
+
+func TestCacheFlagsLockTTL(t *testing.T) {
+	for _, tt := range []struct {
+		ttl  string
+		fail bool
+	}{{"30s", false}, {"3s", false}, {"2s", true}, {"0", true}, {"-5s", true}} {
+		fset := flag.NewFlagSet("test", flag.ContinueOnError)
+		fset.SetOutput(io.Discard)
+		options := cacheFlags(fset, config.Profile{})
+		if err := fset.Parse([]string{"-lock-ttl", tt.ttl}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := options(); (err != nil) != tt.fail {
+			t.Errorf("-lock-ttl %s: err = %v, want failure %v", tt.ttl, err, tt.fail)
+		}
+	}
+}
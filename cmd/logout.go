@@ -0,0 +1,89 @@
+package main
+
+import (
+	"GDrive/internal/control"
+	"GDrive/internal/drive"
+	"GDrive/internal/fs"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"time"
+)
+
+// runLogout signs out of the selected profile's account: running mounts
+// using it are unmounted, then its token is revoked at Google and deleted
+// from its store.
+func runLogout(args []string) {
+	fset := newFlagSet("logout", "[-keep-mounted] [-control-socket path]")
+	defaultSocket := fs.Options{StateDir: profile.StateDir, ControlSocket: profile.Sync.ControlSocket}.SocketPath()
+	socket := fset.String("control-socket", defaultSocket, "control socket of the mount")
+	keepMounted := fset.Bool("keep-mounted", false, "leave running mounts alone; they fail once the token is revoked")
+	fset.Parse(args)
+
+	cfg := authConfig()
+	typ, err := drive.CheckCredentials(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "gdrive: %v\n", err)
+		os.Exit(exitConfig)
+	}
+	if !usesToken(typ) {
+		fatal(fmt.Errorf("%s credentials have no token to revoke; remove or disable them where they were issued", typ))
+	}
+
+	// unmount first, so that a mount refreshing the token cannot save it
+	// again after it was deleted
+	if !*keepMounted {
+		for _, s := range logoutSockets(*socket) {
+			mounted, err := unmountSocket(s)
+			if errors.Is(err, control.ErrNoServer) {
+				continue
+			}
+			if err != nil {
+				fatal(fmt.Errorf("failed to unmount the mount at %s: %v", s, err))
+			}
+			waitUnmounted(s, 10*time.Second)
+			fmt.Printf("Unmounted %s\n", mounted)
+		}
+	}
+	if err := revokeToken(cfg); err != nil {
+		fatal(fmt.Errorf("%v (the token was kept so that logout can be retried)", err))
+	}
+}
+
+// logoutSockets returns socket and the control sockets of the other profiles
+// signing in as the same account.
+func logoutSockets(socket string) []string {
+	seen := map[string]bool{socket: true}
+	sockets := []string{socket}
+	if profile.Account == "" {
+		return sockets
+	}
+	for _, name := range profilesUsing(configFile, profile.Account) {
+		prof, err := configFile.Profile(name)
+		if err != nil {
+			continue
+		}
+		s := fs.Options{StateDir: prof.StateDir, ControlSocket: prof.Sync.ControlSocket}.SocketPath()
+		if !seen[s] {
+			seen[s] = true
+			sockets = append(sockets, s)
+		}
+	}
+	sort.Strings(sockets[1:])
+	return sockets
+}
+
+// waitUnmounted waits until the mount on socket has stopped listening, as
+// the unmount it was asked for happens after the reply.
+func waitUnmounted(socket string, timeout time.Duration) {
+	for deadline := time.Now().Add(timeout); time.Now().Before(deadline); {
+		conn, err := net.Dial("unix", socket)
+		if err != nil {
+			return
+		}
+		conn.Close()
+		time.Sleep(100 * time.Millisecond)
+	}
+}
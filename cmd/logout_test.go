@@ -0,0 +1,41 @@
+package main
+
+import (
+	"GDrive/internal/config"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLogoutSockets(t *testing.T) {
+	dir := t.TempDir()
+	saved, savedFile := profile, configFile
+	t.Cleanup(func() { profile, configFile = saved, savedFile })
+
+	configFile = &config.File{
+		Accounts: map[string]config.Account{"home": {}},
+		Profiles: map[string]config.Profile{
+			"photos": {Account: "home", StateDir: filepath.Join(dir, "photos")},
+			"music":  {Account: "home", Sync: config.Sync{ControlSocket: filepath.Join(dir, "music.sock")}},
+			"other":  {Sync: config.Sync{ControlSocket: filepath.Join(dir, "other.sock")}},
+		},
+	}
+	own := filepath.Join(dir, "own.sock")
+	photos := filepath.Join(dir, "photos", "control.sock")
+
+	profile = config.Profile{}
+	if got := logoutSockets(own); !reflect.DeepEqual(got, []string{own}) {
+		t.Errorf("without an account: %q", got)
+	}
+
+	// every mount signed in as the account is stopped, each socket once
+	profile = config.Profile{Account: "home"}
+	want := []string{own, filepath.Join(dir, "music.sock"), photos}
+	if got := logoutSockets(own); !reflect.DeepEqual(got, want) {
+		t.Errorf("logoutSockets = %q, want %q", got, want)
+	}
+	want = []string{photos, filepath.Join(dir, "music.sock")}
+	if got := logoutSockets(photos); !reflect.DeepEqual(got, want) {
+		t.Errorf("logoutSockets from photos = %q, want %q", got, want)
+	}
+}
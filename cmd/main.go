@@ -3,6 +3,7 @@ package main
 import (
 	"GDrive/internal/drive"
 	"GDrive/internal/fs"
+	"fmt"
 	"io"
 	"log"
 	"os"
@@ -12,70 +13,171 @@ import (
 	"syscall"
 )
 
+// commands are the subcommands of the tool, in the order usage lists them.
+var commands = []struct {
+	name, summary string
+	run           func(args []string)
+}{
+	{"mount", "mount Drive and serve it until interrupted", runMount},
+	{"unmount", "unmount a running mount", runUnmount},
+	{"ls", "list folders", runLs},
+	{"stat", "show file metadata", runStat},
+	{"get", "download files", runGet},
+	{"put", "upload files", runPut},
+	{"rm", "move files to the trash", runRm},
+	{"mv", "rename or move a file", runMv},
+	{"mkdir", "create folders", runMkdir},
+	{"quota", "show storage usage", runQuota},
+	{"warm", "fill the cache ahead of a job", runWarm},
+	{"auth", "manage accounts (add, list, remove, revoke)", runAuth},
+	{"logout", "unmount, revoke and delete the token of the profile", runLogout},
+	{"config", "check or print the configuration (validate, show)", runConfig},
+}
+
 func main() {
+	name, args := "mount", os.Args[1:]
+	// mounting stays the default so that flags alone keep working
+	if len(args) > 0 && (!strings.HasPrefix(args[0], "-") || args[0] == "-h" || args[0] == "-help") {
+		name, args = args[0], args[1:]
+	}
+	for _, c := range commands {
+		if c.name != name {
+			continue
+		}
+		// config and auth load the file themselves, to report what is wrong
+		// and to edit accounts the profile refers to
+		if name != "config" && name != "auth" {
+			if err := loadConfig(args); err != nil {
+				fmt.Fprintf(os.Stderr, "gdrive: %v\n", err)
+				os.Exit(exitConfig)
+			}
+		}
+		c.run(args)
+		return
+	}
+	usage()
+	if name == "help" || name == "-h" || name == "-help" {
+		return
+	}
+	os.Exit(exitUsage)
+}
+
+// usage lists the subcommands.
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: gdrive <command> [flags] [arguments]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "commands:")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Run \"gdrive <command> -h\" for the flags of a command. Commands other than")
+	fmt.Fprintln(os.Stderr, "mount, unmount and warm talk to Drive directly and need no mount.")
+	fmt.Fprintln(os.Stderr, "Defaults come from the selected profile of the configuration file; every")
+	fmt.Fprintln(os.Stderr, "command accepts -config, -profile and -account.")
+}
+
+// runMount mounts Drive and serves it until interrupted.
+func runMount(args []string) {
+	fset := newFlagSet("mount", "[flags] [mount point]")
+	options := cacheFlags(fset, profile)
+	m := profile.Mount
+	mountPoint := fset.String("mountpoint", orString(profile.MountPoint, fs.DefaultMountPoint()), "directory, or drive letter on Windows, to mount Drive at")
+	mountOptions := optionList(m.Options)
+	fset.Var(&mountOptions, "o", "extra FUSE mount option, may be repeated")
+	debug := fset.Bool("debug", m.Debug, "trace every FUSE call")
+	allowOther := fset.Bool("allow-other", m.AllowOther, "let other users access the mount (Linux and macOS)")
+	defaultPermissions := fset.Bool("default-permissions", m.DefaultPermissions, "let the kernel enforce file modes (Linux and macOS)")
+	readOnly := fset.Bool("read-only", m.ReadOnly, "refuse all changes (implied by scopes without write access)")
+	attrTimeout := fset.Duration("attr-timeout", m.AttrTimeout, "how long the kernel caches file attributes (0 keeps the FUSE default)")
+	entryTimeout := fset.Duration("entry-timeout", m.EntryTimeout, "how long the kernel caches name lookups (0 keeps the FUSE default)")
+	logPath := fset.String("log-file", orString(profile.Log.File, "gdrive.log"), "file the mount logs to")
+	quiet := fset.Bool("quiet", profile.Log.Quiet, "log only to the log file, not to standard output")
+	fset.Parse(args)
+	opts, err := options()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "gdrive: %v\n", err)
+		os.Exit(exitUsage)
+	}
+	if fset.NArg() > 0 {
+		*mountPoint = fset.Arg(0)
+	}
+	opts.MountOptions = mountOptions
+	opts.Debug = *debug
+	opts.AllowOther = *allowOther
+	opts.DefaultPermissions = *defaultPermissions
+	scopes, err := drive.ParseScopes(profile.Scopes)
+	if err != nil {
+		log.Fatal(err)
+	}
+	opts.ReadOnly = *readOnly || drive.ReadOnlyScopes(scopes)
+	opts.AttrTimeout = *attrTimeout
+	opts.EntryTimeout = *entryTimeout
+
 	// Setup logging
-	logFile, err := os.OpenFile("gdrive.log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	logFile, err := os.OpenFile(*logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
 	if err != nil {
-		log.Fatal("Failed to open log file")
+		log.Fatalf("Failed to open log file: %v", err)
 	}
 	defer logFile.Close()
-	
+
 	// Log to both file and console
-	log.SetOutput(io.MultiWriter(os.Stdout, logFile))
+	if *quiet {
+		log.SetOutput(logFile)
+	} else {
+		log.SetOutput(io.MultiWriter(os.Stdout, logFile))
+	}
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
 	log.Println("=== Starting GDriveDisk ===")
 	log.Printf("OS: %s, Arch: %s", runtime.GOOS, runtime.GOARCH)
 
-	// Set mount point to a drive letter (make sure it's not in use)
-	mountPoint := "X:" // Try X: or any other available drive letter
-
 	// Authenticate Google Drive
 	log.Println("Authenticating with Google Drive...")
-	client, err := drive.AuthenticateGoogleDrive()
+	client, err := drive.Authenticate(authConfig())
 	if err != nil {
-		log.Fatalf("Failed to authenticate Google Drive: %v", err)
+		log.Printf("Failed to authenticate Google Drive: %v", err)
+		os.Exit(exitAuth)
 	}
 
 	// Initialize Drive Service
 	driveService := drive.NewDriveService(client)
-
-	// Test uploading a file if it exists
-	if _, err := os.Stat("test.txt"); err == nil {
-		log.Println("Found test.txt, attempting to upload...")
-		testFile, err := os.Open("test.txt")
-		if err != nil {
-			log.Printf("Warning: Failed to open test file: %v", err)
-		} else {
-			defer testFile.Close()
-			uploadedFile, err := driveService.UploadFile("test.txt", testFile)
-			if err != nil {
-				log.Printf("Warning: File upload failed: %v", err)
-			} else {
-				log.Printf("Test file uploaded successfully! ID: %s\n", uploadedFile.Id)
-			}
-		}
+	if err := setupDrive(driveService); err != nil {
+		log.Printf("Failed to set up Drive: %v", err)
+		os.Exit(exitConfig)
 	}
 
 	// Mount the FUSE filesystem
-	log.Printf("Mounting GDrive at %s...", mountPoint)
-	host, err := fs.Mount(mountPoint, driveService)
+	log.Printf("Mounting GDrive at %s...", *mountPoint)
+	host, err := fs.Mount(*mountPoint, driveService, opts)
 	if err != nil {
 		log.Printf("Failed to mount filesystem: %v", err)
 		log.Println("This could be due to:")
 		log.Println("1. Another instance is already running")
 		log.Println("2. Previous mount wasn't properly unmounted")
-		log.Println("3. WinFsp is not properly installed")
-		log.Println("4. Insufficient permissions")
-		os.Exit(1)
+		if runtime.GOOS == "windows" {
+			log.Println("3. WinFsp is not properly installed")
+		} else {
+			log.Println("3. FUSE is not installed (libfuse/fuse3 on Linux, macFUSE on macOS)")
+		}
+		log.Println("4. Insufficient permissions (-allow-other needs user_allow_other in /etc/fuse.conf)")
+		os.Exit(exitFailure)
 	}
 
-	log.Println("Successfully mounted GDrive at", mountPoint)
+	log.Println("Successfully mounted GDrive at", *mountPoint)
+	if opts.ReadOnly {
+		log.Println("Mounted read-only")
+	}
 	log.Println("Press Ctrl+C to unmount and exit")
 
-	// Wait for interrupt signal
+	// Wait for interrupt signal or an unmount from elsewhere
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
-	<-c
+	select {
+	case <-c:
+	case <-host.Done():
+		log.Println("GDrive has been unmounted")
+		return
+	}
 
 	log.Println("\nShutting down...")
 
@@ -83,8 +185,8 @@ func main() {
 	if host != nil {
 		host.Unmount()
 		// Clean up the mount point if it's a directory
-		if !strings.HasSuffix(mountPoint, ":") {
-			os.Remove(mountPoint)
+		if !strings.HasSuffix(*mountPoint, ":") {
+			os.Remove(*mountPoint)
 		}
 	}
 
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"GDrive/internal/drive"
+	"fmt"
+	"os"
+	p "path"
+	"path/filepath"
+	"strings"
+
+	googleDrive "google.golang.org/api/drive/v3"
+)
+
+// transfer is the JSON form of one file copied by get or put.
+type transfer struct {
+	Remote string `json:"remote"`
+	Local  string `json:"local"`
+	ID     string `json:"id"`
+	Size   int64  `json:"size"`
+}
+
+// localName returns the local file name for f, adding the extension of the
+// format native Google files are exported as, or an error for Google
+// formats that cannot be exported.
+func localName(d *drive.DriveService, f *googleDrive.File) (string, error) {
+	if exportType, ok := d.ExportType(f.MimeType); ok {
+		return f.Name + drive.ExportExtension(exportType), nil
+	}
+	if drive.IsGoogleFormat(f.MimeType) {
+		return "", fmt.Errorf("%s: %s files cannot be downloaded", f.Name, f.MimeType)
+	}
+	return f.Name, nil
+}
+
+// runGet downloads files and, with -r, folders.
+func runGet(args []string) {
+	fset := newFlagSet("get", "[-r] [-json] <remote path or glob>... <local destination>")
+	recursive := fset.Bool("r", false, "download folders and their contents")
+	asJSON := fset.Bool("json", false, "print the downloaded files as JSON")
+	fset.Parse(args)
+	requireArgs(fset, 2)
+	sources, dest := fset.Args()[:fset.NArg()-1], fset.Arg(fset.NArg()-1)
+
+	d := connectDrive()
+	var st status
+	var matches []drive.PathMatch
+	for _, arg := range sources {
+		m, err := expand(d, arg)
+		if err != nil {
+			st.fail(err)
+			continue
+		}
+		matches = append(matches, m...)
+	}
+	info, err := os.Stat(dest)
+	destIsDir := err == nil && info.IsDir()
+	if len(matches) > 1 && !destIsDir {
+		fatal(fmt.Errorf("%s is not a directory", dest))
+	}
+
+	var done []transfer
+	for _, m := range matches {
+		target := dest
+		if destIsDir {
+			name, err := localName(d, m.File)
+			if err != nil {
+				st.fail(err)
+				continue
+			}
+			target = filepath.Join(dest, name)
+		}
+		download(d, m, target, *recursive, &st, &done)
+	}
+	if *asJSON {
+		printJSON(done)
+	}
+	st.exit()
+}
+
+// download copies m to the local path target, descending into folders.
+func download(d *drive.DriveService, m drive.PathMatch, target string, recursive bool, st *status, done *[]transfer) {
+	if !drive.IsFolder(m.File) {
+		data, err := d.DownloadFile(m.File)
+		if err == nil {
+			err = os.WriteFile(target, data, 0644)
+		}
+		if err != nil {
+			st.fail(fmt.Errorf("%s: %w", m.Path, err))
+			return
+		}
+		*done = append(*done, transfer{Remote: m.Path, Local: target, ID: m.File.Id, Size: int64(len(data))})
+		return
+	}
+	if !recursive {
+		st.fail(fmt.Errorf("%s is a folder (use -r)", m.Path))
+		return
+	}
+	if err := os.MkdirAll(target, 0755); err != nil {
+		st.fail(err)
+		return
+	}
+	children, err := d.ListChildren(m.File)
+	if err != nil {
+		st.fail(err)
+		return
+	}
+	for _, c := range children {
+		name, err := localName(d, c)
+		if err != nil {
+			st.fail(err)
+			continue
+		}
+		download(d, drive.PathMatch{Path: p.Join(m.Path, c.Name), File: c}, filepath.Join(target, name), recursive, st, done)
+	}
+}
+
+// runPut uploads files and, with -r, directories. Files that already exist
+// on Drive are updated rather than duplicated.
+func runPut(args []string) {
+	fset := newFlagSet("put", "[-r] [-json] <local path or glob>... <remote destination>")
+	recursive := fset.Bool("r", false, "upload directories and their contents")
+	asJSON := fset.Bool("json", false, "print the uploaded files as JSON")
+	fset.Parse(args)
+	requireArgs(fset, 2)
+	sources, dest := fset.Args()[:fset.NArg()-1], strings.Trim(p.Clean("/"+fset.Arg(fset.NArg()-1)), "/")
+
+	var st status
+	var locals []string
+	for _, arg := range sources {
+		matches, err := filepath.Glob(arg)
+		if err != nil {
+			st.fail(err)
+			continue
+		}
+		if len(matches) == 0 {
+			st.fail(fmt.Errorf("%s: %w", arg, os.ErrNotExist))
+			continue
+		}
+		locals = append(locals, matches...)
+	}
+
+	d := connectDrive()
+	target, err := d.Resolve(dest)
+	if err != nil && !drive.IsNotFound(err) {
+		fatal(err)
+	}
+	var done []transfer
+	switch {
+	case target != nil && drive.IsFolder(target):
+		for _, local := range locals {
+			upload(d, local, target.Id, filepath.Base(local), p.Join(dest, filepath.Base(local)), *recursive, &st, &done)
+		}
+	case len(locals) > 1:
+		fatal(fmt.Errorf("%s is not a folder", dest))
+	case len(locals) == 1:
+		parent, err := d.Resolve(p.Dir(dest))
+		if err != nil {
+			fatal(err)
+		}
+		upload(d, locals[0], parent.Id, p.Base(dest), dest, *recursive, &st, &done)
+	}
+	if *asJSON {
+		printJSON(done)
+	}
+	st.exit()
+}
+
+// upload copies the local path local to name in the Drive folder parentID,
+// descending into directories.
+func upload(d *drive.DriveService, local, parentID, name, remote string, recursive bool, st *status, done *[]transfer) {
+	info, err := os.Stat(local)
+	if err != nil {
+		st.fail(err)
+		return
+	}
+	existing, err := d.FindFile(parentID, name)
+	if err != nil {
+		st.fail(err)
+		return
+	}
+	if info.IsDir() {
+		if !recursive {
+			st.fail(fmt.Errorf("%s is a directory (use -r)", local))
+			return
+		}
+		folder := existing
+		if folder == nil {
+			folder, err = d.CreateFolder(name, parentID)
+		} else if !drive.IsFolder(folder) {
+			err = fmt.Errorf("%s exists and is not a folder", remote)
+		}
+		if err != nil {
+			st.fail(err)
+			return
+		}
+		entries, err := os.ReadDir(local)
+		if err != nil {
+			st.fail(err)
+			return
+		}
+		for _, e := range entries {
+			upload(d, filepath.Join(local, e.Name()), folder.Id, e.Name(), p.Join(remote, e.Name()), recursive, st, done)
+		}
+		return
+	}
+
+	content, err := os.Open(local)
+	if err != nil {
+		st.fail(err)
+		return
+	}
+	defer content.Close()
+	var f *googleDrive.File
+	switch {
+	case existing == nil:
+		f, err = d.UploadFileToFolder(name, parentID, content)
+	case drive.IsFolder(existing):
+		err = fmt.Errorf("%s exists and is a folder", remote)
+	default:
+		f, err = d.UpdateFileContent(existing.Id, content)
+	}
+	if err != nil {
+		st.fail(fmt.Errorf("%s: %w", local, err))
+		return
+	}
+	*done = append(*done, transfer{Remote: remote, Local: local, ID: f.Id, Size: info.Size()})
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"GDrive/internal/drive"
+	"testing"
+
+	googleDrive "google.golang.org/api/drive/v3"
+)
+
+func TestLocalName(t *testing.T) {
+	d := drive.NewDriveService(nil)
+	d.SetExportFormats(map[string]string{"application/vnd.google-apps.document": "application/pdf"})
+	tests := []struct {
+		mimeType string
+		want     string
+		fail     bool
+	}{
+		{"application/vnd.google-apps.document", "report.pdf", false},
+		{"application/vnd.google-apps.spreadsheet", "report.xlsx", false},
+		{"application/vnd.google-apps.drawing", "report.png", false},
+		{"application/vnd.google-apps.form", "", true},
+		{drive.FolderMimeType, "report", false},
+		{"text/plain", "report", false},
+	}
+	for _, tt := range tests {
+		got, err := localName(d, &googleDrive.File{Name: "report", MimeType: tt.mimeType})
+		if (err != nil) != tt.fail || got != tt.want {
+			t.Errorf("localName(%s) = %q, %v; want %q, failure %v", tt.mimeType, got, err, tt.want, tt.fail)
+		}
+	}
+}
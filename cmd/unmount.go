@@ -0,0 +1,59 @@
+package main
+
+import (
+	"GDrive/internal/control"
+	"GDrive/internal/fs"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+)
+
+// runUnmount asks the running mount to unmount through its control socket.
+// If no mount answers and a mount point is given, the OS unmount tool is
+// used instead, e.g. after a crash left the mount point behind.
+func runUnmount(args []string) {
+	fset := newFlagSet("unmount", "[-control-socket path] [mount point]")
+	defaultSocket := fs.Options{StateDir: profile.StateDir, ControlSocket: profile.Sync.ControlSocket}.SocketPath()
+	socket := fset.String("control-socket", defaultSocket, "control socket of the mount")
+	fset.Parse(args)
+
+	mounted, err := unmountSocket(*socket)
+	if err == nil {
+		fmt.Printf("Unmounted %s\n", mounted)
+		return
+	}
+	if !errors.Is(err, control.ErrNoServer) || fset.NArg() == 0 {
+		fatal(err)
+	}
+
+	mountPoint := fset.Arg(0)
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "linux":
+		cmd = exec.Command("fusermount", "-u", mountPoint)
+		if _, err := exec.LookPath("fusermount3"); err == nil {
+			cmd = exec.Command("fusermount3", "-u", mountPoint)
+		}
+	case "windows":
+		fatal(fmt.Errorf("no running mount on %s", *socket))
+	default:
+		cmd = exec.Command("umount", mountPoint)
+	}
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		fatal(fmt.Errorf("failed to unmount %s: %v", mountPoint, err))
+	}
+	fmt.Printf("Unmounted %s\n", mountPoint)
+}
+
+// unmountSocket asks the mount listening on socket to unmount and returns
+// its mount point. control.ErrNoServer means no mount was listening.
+func unmountSocket(socket string) (string, error) {
+	var result map[string]string
+	if err := control.Call(socket, control.Request{Action: "unmount"}, os.Stderr, &result); err != nil {
+		return "", err
+	}
+	return result["mountPoint"], nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"GDrive/internal/control"
+	"GDrive/internal/drive"
+	"GDrive/internal/fs"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+)
+
+// runWarm pre-populates the persistent cache with the given paths or globs.
+// If a mount is running, its control socket does the work so the mount's
+// own caches are filled; otherwise the files are fetched directly.
+func runWarm(args []string) {
+	fset := newFlagSet("warm", "[flags] <path or glob>...")
+	parallel := fset.Int("parallel", 4, "number of files downloaded at once")
+	options := cacheFlags(fset, profile)
+	fset.Parse(args)
+	requireArgs(fset, 1)
+	opts, err := options()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "gdrive: %v\n", err)
+		os.Exit(exitUsage)
+	}
+
+	socket := opts.SocketPath()
+	var report fs.WarmReport
+	err = control.Call(socket, control.Request{Action: "warm", Paths: fset.Args(), Parallel: *parallel}, os.Stdout, &report)
+	if errors.Is(err, control.ErrNoServer) {
+		report, err = warmStandalone(opts, fset.Args(), *parallel)
+	}
+	if err != nil {
+		log.Fatalf("Warm failed: %v", err)
+	}
+	fmt.Printf("%d files: %d downloaded (%d bytes), %d already cached (%d bytes), %d skipped, %d failed\n",
+		report.Files, report.Downloaded, report.BytesDownloaded, report.AlreadyCached, report.BytesCached, report.Skipped, report.Failed)
+	if report.Failed > 0 {
+		os.Exit(exitFailure)
+	}
+}
+
+// warmStandalone warms the cache without a running mount.
+func warmStandalone(opts fs.Options, patterns []string, parallel int) (fs.WarmReport, error) {
+	client, err := drive.Authenticate(authConfig())
+	if err != nil {
+		return fs.WarmReport{}, fmt.Errorf("failed to authenticate Google Drive: %v", err)
+	}
+	d := drive.NewDriveService(client)
+	if err := setupDrive(d); err != nil {
+		return fs.WarmReport{}, err
+	}
+	opts.DisablePrefetch = true
+	gfs := fs.NewGDriveFS(d, opts)
+	defer gfs.Destroy()
+	return gfs.Warm(patterns, parallel, os.Stdout)
+}
@@ -0,0 +1,268 @@
+package cache
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	blockSuffix  = ".blk"
+	versionFile  = "version"
+	checksumSize = sha256.Size
+)
+
+// BlockCache keeps fixed-size blocks of remote files on disk so warm data
+// survives restarts. Blocks live under <dir>/<file key>/<index>.blk and are
+// prefixed with a SHA-256 of their payload, which is verified on every read.
+// Each file directory records the content version its blocks belong to;
+// asking for a different version discards the old blocks. Which blocks are
+// stored and how recently they were used is tracked in memory, so eviction
+// never walks the directory.
+type BlockCache struct {
+	mu        sync.Mutex
+	dir       string
+	maxBytes  int64
+	blockSize int64
+	size      int64
+	versions  map[string]string // validated file key -> version
+	lru       *list.List        // of *blockInfo, most recently used first
+	blocks    map[string]*list.Element
+}
+
+// NewBlockCache opens (creating if needed) a block cache in dir.
+// maxBytes <= 0 means unbounded.
+func NewBlockCache(dir string, maxBytes, blockSize int64) (*BlockCache, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("block cache directory not set")
+	}
+	if blockSize <= 0 {
+		return nil, fmt.Errorf("invalid block size %d", blockSize)
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create block cache directory: %w", err)
+	}
+	b := &BlockCache{
+		dir: dir, maxBytes: maxBytes, blockSize: blockSize,
+		versions: make(map[string]string),
+		lru:      list.New(),
+		blocks:   make(map[string]*list.Element),
+	}
+	// modification times carry the use order across restarts
+	stored := b.scan()
+	sort.Slice(stored, func(i, j int) bool { return stored[i].modTime.After(stored[j].modTime) })
+	for i := range stored {
+		b.blocks[stored[i].path] = b.lru.PushBack(&stored[i])
+		b.size += stored[i].size
+	}
+	return b, nil
+}
+
+// BlockSize returns the size of every block but a file's last.
+func (b *BlockCache) BlockSize() int64 {
+	return b.blockSize
+}
+
+// fileDir maps a file ID to its directory.
+func (b *BlockCache) fileDir(fileID string) string {
+	sum := sha256.Sum256([]byte(fileID))
+	return filepath.Join(b.dir, hex.EncodeToString(sum[:16]))
+}
+
+// blockPath returns the path of block idx of fileID.
+func (b *BlockCache) blockPath(fileID string, idx int64) string {
+	return filepath.Join(b.fileDir(fileID), strconv.FormatInt(idx, 10)+blockSuffix)
+}
+
+// validate makes sure the blocks stored for fileID belong to version,
+// dropping them otherwise. Caller must hold b.mu.
+func (b *BlockCache) validate(fileID, version string) error {
+	if b.versions[fileID] == version {
+		return nil
+	}
+	dir := b.fileDir(fileID)
+	stored, err := os.ReadFile(filepath.Join(dir, versionFile))
+	if err == nil && string(stored) == version {
+		b.versions[fileID] = version
+		return nil
+	}
+	b.removeFileDir(dir)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	if err := WriteFileAtomic(filepath.Join(dir, versionFile), []byte(version)); err != nil {
+		return err
+	}
+	b.versions[fileID] = version
+	return nil
+}
+
+// ReadBlock returns block idx of fileID at version. Blocks that fail their
+// integrity check are deleted and reported as a miss.
+func (b *BlockCache) ReadBlock(fileID, version string, idx int64) ([]byte, bool, error) {
+	b.mu.Lock()
+	err := b.validate(fileID, version)
+	b.mu.Unlock()
+	if err != nil {
+		return nil, false, err
+	}
+	name := b.blockPath(fileID, idx)
+	raw, err := os.ReadFile(name)
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if len(raw) < checksumSize {
+		b.dropBlock(name)
+		return nil, false, nil
+	}
+	sum := sha256.Sum256(raw[checksumSize:])
+	if !bytes.Equal(sum[:], raw[:checksumSize]) {
+		b.dropBlock(name)
+		return nil, false, fmt.Errorf("block %d of %s failed integrity check, discarded", idx, fileID)
+	}
+	b.touch(name)
+	return raw[checksumSize:], true, nil
+}
+
+// WriteBlock stores block idx of fileID at version.
+func (b *BlockCache) WriteBlock(fileID, version string, idx int64, data []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.validate(fileID, version); err != nil {
+		return err
+	}
+	sum := sha256.Sum256(data)
+	raw := append(sum[:], data...)
+	name := b.blockPath(fileID, idx)
+	if err := WriteFileAtomic(name, raw); err != nil {
+		return err
+	}
+	b.forget(name)
+	b.blocks[name] = b.lru.PushFront(&blockInfo{path: name, size: int64(len(raw)), modTime: time.Now()})
+	b.size += int64(len(raw))
+	b.evict(name)
+	return nil
+}
+
+// HasBlock reports whether block idx of fileID at version is stored,
+// without reading or verifying it.
+func (b *BlockCache) HasBlock(fileID, version string, idx int64) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.validate(fileID, version); err != nil {
+		return false
+	}
+	_, ok := b.blocks[b.blockPath(fileID, idx)]
+	return ok
+}
+
+// Invalidate drops every block of fileID.
+func (b *BlockCache) Invalidate(fileID string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.versions, fileID)
+	b.removeFileDir(b.fileDir(fileID))
+}
+
+// Size returns the bytes currently stored.
+func (b *BlockCache) Size() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.size
+}
+
+// touch marks the block at name as just used. Its modification time is
+// updated too, so the order survives a restart.
+func (b *BlockCache) touch(name string) {
+	b.mu.Lock()
+	if e, ok := b.blocks[name]; ok {
+		b.lru.MoveToFront(e)
+	}
+	b.mu.Unlock()
+	now := time.Now()
+	os.Chtimes(name, now, now)
+}
+
+// forget stops tracking the block at name. Caller must hold b.mu.
+func (b *BlockCache) forget(name string) {
+	if e, ok := b.blocks[name]; ok {
+		b.size -= e.Value.(*blockInfo).size
+		b.lru.Remove(e)
+		delete(b.blocks, name)
+	}
+}
+
+// dropBlock removes a corrupt block.
+func (b *BlockCache) dropBlock(name string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	os.Remove(name)
+	b.forget(name)
+}
+
+// removeFileDir deletes a file directory and its blocks. Caller must hold
+// b.mu.
+func (b *BlockCache) removeFileDir(dir string) {
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		if strings.HasSuffix(e.Name(), blockSuffix) {
+			b.forget(filepath.Join(dir, e.Name()))
+		}
+	}
+	os.RemoveAll(dir)
+}
+
+type blockInfo struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// scan lists every stored block on disk.
+func (b *BlockCache) scan() []blockInfo {
+	var blocks []blockInfo
+	dirs, _ := os.ReadDir(b.dir)
+	for _, d := range dirs {
+		if !d.IsDir() {
+			continue
+		}
+		entries, _ := os.ReadDir(filepath.Join(b.dir, d.Name()))
+		for _, e := range entries {
+			if !strings.HasSuffix(e.Name(), blockSuffix) {
+				continue
+			}
+			if info, err := e.Info(); err == nil {
+				blocks = append(blocks, blockInfo{filepath.Join(b.dir, d.Name(), e.Name()), info.Size(), info.ModTime()})
+			}
+		}
+	}
+	return blocks
+}
+
+// evict removes least recently used blocks until the cache fits, sparing
+// the block just written. Caller must hold b.mu.
+func (b *BlockCache) evict(keep string) {
+	if b.maxBytes <= 0 {
+		return
+	}
+	for e := b.lru.Back(); e != nil && b.size > b.maxBytes; {
+		prev := e.Prev()
+		if blk := e.Value.(*blockInfo); blk.path != keep {
+			os.Remove(blk.path)
+			b.forget(blk.path)
+		}
+		e = prev
+	}
+}
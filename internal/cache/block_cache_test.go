@@ -0,0 +1,140 @@
+package cache
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+)
+
+// blockBytes is the stored size of a block holding n bytes.
+func blockBytes(n int) int64 {
+	return int64(checksumSize + n)
+}
+
+func TestBlockCacheRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	b, err := NewBlockCache(dir, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := []byte("0123456789")
+	if err := b.WriteBlock("f1", "v1", 3, data); err != nil {
+		t.Fatal(err)
+	}
+	got, found, err := b.ReadBlock("f1", "v1", 3)
+	if err != nil || !found || !bytes.Equal(got, data) {
+		t.Fatalf("ReadBlock = %q, %v, %v", got, found, err)
+	}
+	if !b.HasBlock("f1", "v1", 3) || b.HasBlock("f1", "v1", 4) {
+		t.Error("HasBlock does not match the stored blocks")
+	}
+
+	reopened, err := NewBlockCache(dir, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reopened.Size() != blockBytes(10) {
+		t.Errorf("reopened size = %d, want %d", reopened.Size(), blockBytes(10))
+	}
+	if _, found, _ := reopened.ReadBlock("f1", "v1", 3); !found {
+		t.Error("block lost across reopen")
+	}
+}
+
+func TestBlockCacheVersion(t *testing.T) {
+	b, err := NewBlockCache(t.TempDir(), 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.WriteBlock("f1", "v1", 0, []byte("old"))
+	if _, found, _ := b.ReadBlock("f1", "v2", 0); found {
+		t.Error("block of an older version served")
+	}
+	if b.Size() != 0 {
+		t.Errorf("size = %d after the version changed, want 0", b.Size())
+	}
+	b.WriteBlock("f1", "v2", 0, []byte("new"))
+	b.Invalidate("f1")
+	if _, found, _ := b.ReadBlock("f1", "v2", 0); found || b.Size() != 0 {
+		t.Errorf("after Invalidate: found %v, size %d", found, b.Size())
+	}
+}
+
+func TestBlockCacheCorruptBlock(t *testing.T) {
+	b, err := NewBlockCache(t.TempDir(), 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.WriteBlock("f1", "v1", 0, []byte("0123456789"))
+	name := b.blockPath("f1", 0)
+	raw, _ := os.ReadFile(name)
+	raw[len(raw)-1] ^= 0xff
+	os.WriteFile(name, raw, 0600)
+
+	if _, found, err := b.ReadBlock("f1", "v1", 0); found || err == nil {
+		t.Errorf("corrupt block: found %v, err %v, want an integrity error", found, err)
+	}
+	if b.HasBlock("f1", "v1", 0) || b.Size() != 0 {
+		t.Errorf("corrupt block kept, size %d", b.Size())
+	}
+}
+
+func TestBlockCacheEviction(t *testing.T) {
+	b, err := NewBlockCache(t.TempDir(), 3*blockBytes(10), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, 10)
+	for i := int64(0); i < 3; i++ {
+		b.WriteBlock("f1", "v1", i, data)
+	}
+	// reads make block 1 the least recently used
+	b.ReadBlock("f1", "v1", 0)
+	b.ReadBlock("f1", "v1", 2)
+	// a write past the bound evicts the oldest block, never the new one
+	b.WriteBlock("f2", "v1", 0, data)
+	checkEvicted(t, b, 1)
+}
+
+func TestBlockCacheEvictionAfterReopen(t *testing.T) {
+	dir := t.TempDir()
+	b, err := NewBlockCache(dir, 3*blockBytes(10), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, 10)
+	past := time.Now().Add(-time.Hour)
+	for i := int64(0); i < 3; i++ {
+		b.WriteBlock("f1", "v1", i, data)
+		// block 1 is the least recently used, then 0, then 2
+		at := past.Add(time.Duration([]int{1, 0, 2}[i]) * time.Minute)
+		os.Chtimes(b.blockPath("f1", i), at, at)
+	}
+	// the use order of earlier runs comes from the blocks' times
+	if b, err = NewBlockCache(dir, 3*blockBytes(10), 10); err != nil {
+		t.Fatal(err)
+	}
+	b.WriteBlock("f2", "v1", 0, data)
+	checkEvicted(t, b, 1)
+}
+
+// checkEvicted fails t unless of the three blocks of f1 only block gone was
+// evicted for block 0 of f2.
+func checkEvicted(t *testing.T, b *BlockCache, gone int64) {
+	t.Helper()
+	for idx := int64(0); idx < 3; idx++ {
+		if kept := b.HasBlock("f1", "v1", idx); kept == (idx == gone) {
+			t.Errorf("block %d kept = %v", idx, kept)
+		}
+	}
+	if _, err := os.Stat(b.blockPath("f1", gone)); !os.IsNotExist(err) {
+		t.Errorf("evicted block still on disk: %v", err)
+	}
+	if !b.HasBlock("f2", "v1", 0) {
+		t.Error("block just written evicted")
+	}
+	if b.Size() != 3*blockBytes(10) {
+		t.Errorf("size = %d, want %d", b.Size(), 3*blockBytes(10))
+	}
+}
@@ -0,0 +1,109 @@
+package cache
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Cache stores file content by key. Get-style methods report a miss with
+// found == false and a nil error; err is only set when the backend failed.
+type Cache interface {
+	// Get returns the value stored under key.
+	Get(key string) (value []byte, found bool, err error)
+	// GetReader returns a reader over the value stored under key.
+	// The caller must close it.
+	GetReader(key string) (r io.ReadCloser, found bool, err error)
+	// Set stores value under key.
+	Set(key string, value []byte) error
+	// SetReader stores everything read from r under key.
+	SetReader(key string, r io.Reader) error
+	// Delete removes key. Deleting a missing key is not an error.
+	Delete(key string) error
+	// Stat describes the value stored under key without reading it.
+	Stat(key string) (info Info, found bool, err error)
+}
+
+// Info describes a cached value.
+type Info struct {
+	Size     int64
+	Modified time.Time
+}
+
+// Backend names accepted by Config.Backend.
+const (
+	BackendMemory = "memory"
+	BackendDisk   = "disk"
+	BackendRedis  = "redis"
+)
+
+// Config selects and sizes a Cache implementation.
+type Config struct {
+	// Backend is one of BackendMemory, BackendDisk or BackendRedis.
+	Backend string
+	// MaxBytes bounds the memory and disk caches.
+	MaxBytes int64
+	// MaxEntries bounds the memory cache.
+	MaxEntries int
+	// Dir is the disk cache directory.
+	Dir string
+	// RedisAddr is the Redis server address.
+	RedisAddr string
+	// TTL is how long Redis keeps entries.
+	TTL time.Duration
+}
+
+// New creates the cache described by cfg.
+func New(cfg Config) (Cache, error) {
+	switch cfg.Backend {
+	case BackendMemory:
+		return NewMemoryCache(cfg.MaxBytes, cfg.MaxEntries), nil
+	case BackendDisk:
+		return NewDiskCache(cfg.Dir, cfg.MaxBytes)
+	case BackendRedis:
+		r := NewRedisCache(cfg.RedisAddr, cfg.TTL)
+		if err := r.Ping(); err != nil {
+			return nil, fmt.Errorf("redis at %s unreachable: %w", cfg.RedisAddr, err)
+		}
+		return r, nil
+	}
+	return nil, fmt.Errorf("unknown cache backend %q (want memory, disk or redis)", cfg.Backend)
+}
+
+// readerFrom adapts Get to GetReader for backends that hold whole values.
+func readerFrom(value []byte, found bool, err error) (io.ReadCloser, bool, error) {
+	if !found || err != nil {
+		return nil, found, err
+	}
+	return io.NopCloser(bytes.NewReader(value)), true, nil
+}
+
+// WriteFileAtomic writes data to a temp file next to name and renames it
+// into place, creating name's directory if needed, so a crash never leaves a
+// half-written file behind.
+func WriteFileAtomic(name string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), name); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
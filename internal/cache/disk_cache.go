@@ -0,0 +1,185 @@
+package cache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tempPrefix starts the names of values being written.
+const tempPrefix = "tmp-"
+
+// DiskCache stores each value in its own file under a directory and evicts
+// the least recently used files once the directory exceeds maxBytes.
+// Access times are tracked through file modification times so that recency
+// survives restarts.
+type DiskCache struct {
+	mu       sync.Mutex
+	dir      string
+	maxBytes int64
+	size     int64
+}
+
+// NewDiskCache opens (creating if needed) a disk cache in dir.
+// maxBytes <= 0 means unbounded.
+func NewDiskCache(dir string, maxBytes int64) (*DiskCache, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("disk cache directory not set")
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	d := &DiskCache{dir: dir, maxBytes: maxBytes}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan cache directory: %w", err)
+	}
+	for _, e := range entries {
+		if info, err := e.Info(); err == nil && isCacheFile(info) {
+			d.size += info.Size()
+		}
+	}
+	return d, nil
+}
+
+// path maps key to a file name that is safe on every OS.
+func (d *DiskCache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(d.dir, hex.EncodeToString(sum[:]))
+}
+
+// Get returns the value stored under key.
+func (d *DiskCache) Get(key string) ([]byte, bool, error) {
+	r, found, err := d.GetReader(key)
+	if !found || err != nil {
+		return nil, found, err
+	}
+	defer r.Close()
+	value, err := io.ReadAll(r)
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+// GetReader returns the open cache file for key.
+func (d *DiskCache) GetReader(key string) (io.ReadCloser, bool, error) {
+	name := d.path(key)
+	f, err := os.Open(name)
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	now := time.Now()
+	os.Chtimes(name, now, now)
+	return f, true, nil
+}
+
+// Set stores value under key.
+func (d *DiskCache) Set(key string, value []byte) error {
+	return d.SetReader(key, bytes.NewReader(value))
+}
+
+// SetReader streams r into the cache file for key. The file is written
+// under a temporary name and renamed, so readers never see partial values.
+func (d *DiskCache) SetReader(key string, r io.Reader) error {
+	tmp, err := os.CreateTemp(d.dir, tempPrefix+"*")
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(tmp, r)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	name := d.path(key)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if info, err := os.Stat(name); err == nil {
+		d.size -= info.Size()
+	}
+	if err := os.Rename(tmp.Name(), name); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	d.size += n
+	d.evict()
+	return nil
+}
+
+// Delete removes key.
+func (d *DiskCache) Delete(key string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	name := d.path(key)
+	info, err := os.Stat(name)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(name); err != nil {
+		return err
+	}
+	d.size -= info.Size()
+	return nil
+}
+
+// Stat describes the value stored under key.
+func (d *DiskCache) Stat(key string) (Info, bool, error) {
+	info, err := os.Stat(d.path(key))
+	if os.IsNotExist(err) {
+		return Info{}, false, nil
+	}
+	if err != nil {
+		return Info{}, false, err
+	}
+	return Info{Size: info.Size(), Modified: info.ModTime()}, true, nil
+}
+
+// evict removes least recently used files until the cache fits. Values
+// still being written are left to their writers. Caller must hold d.mu.
+func (d *DiskCache) evict() {
+	if d.maxBytes <= 0 || d.size <= d.maxBytes {
+		return
+	}
+	entries, err := os.ReadDir(d.dir)
+	if err != nil {
+		return
+	}
+	var files []os.FileInfo
+	for _, e := range entries {
+		if info, err := e.Info(); err == nil && isCacheFile(info) {
+			files = append(files, info)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].ModTime().Before(files[j].ModTime()) })
+	for _, info := range files {
+		if d.size <= d.maxBytes {
+			break
+		}
+		if os.Remove(filepath.Join(d.dir, info.Name())) == nil {
+			d.size -= info.Size()
+		}
+	}
+}
+
+// isCacheFile reports whether info is a stored value rather than a
+// directory or a value being written.
+func isCacheFile(info os.FileInfo) bool {
+	return info.Mode().IsRegular() && !strings.HasPrefix(info.Name(), tempPrefix)
+}
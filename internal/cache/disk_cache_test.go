@@ -0,0 +1,75 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDiskCacheRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	d, err := NewDiskCache(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SetReader("a", strings.NewReader("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if value, found, err := d.Get("a"); err != nil || !found || string(value) != "hello" {
+		t.Fatalf("Get = %q, %v, %v", value, found, err)
+	}
+	if info, found, _ := d.Stat("a"); !found || info.Size != 5 {
+		t.Errorf("Stat = %+v, %v", info, found)
+	}
+	d.Set("a", []byte("hi"))
+	reopened, err := NewDiskCache(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reopened.size != 2 {
+		t.Errorf("reopened size = %d, want 2", reopened.size)
+	}
+	reopened.Delete("a")
+	if _, found, _ := reopened.Get("a"); found || reopened.size != 0 {
+		t.Errorf("after Delete: found %v, size %d", found, reopened.size)
+	}
+}
+
+func TestDiskCacheEviction(t *testing.T) {
+	dir := t.TempDir()
+	d, err := NewDiskCache(dir, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	past := time.Now().Add(-time.Hour)
+	for i, key := range []string{"a", "b", "c"} {
+		d.Set(key, make([]byte, 10))
+		at := past.Add(time.Duration(i) * time.Minute)
+		os.Chtimes(d.path(key), at, at)
+	}
+	// reading a makes b the least recently used
+	d.Get("a")
+
+	// another writer's value in progress is neither evicted nor counted
+	inflight := filepath.Join(dir, tempPrefix+"other")
+	os.WriteFile(inflight, make([]byte, 100), 0600)
+	os.Chtimes(inflight, past.Add(-time.Hour), past.Add(-time.Hour))
+
+	d.Set("d", make([]byte, 10))
+	for key, want := range map[string]bool{"a": true, "b": false, "c": true, "d": true} {
+		if _, found, _ := d.Stat(key); found != want {
+			t.Errorf("%s present = %v, want %v", key, found, want)
+		}
+	}
+	if _, err := os.Stat(inflight); err != nil {
+		t.Errorf("value being written was evicted: %v", err)
+	}
+	if d.size != 30 {
+		t.Errorf("size = %d, want 30", d.size)
+	}
+	if reopened, _ := NewDiskCache(dir, 30); reopened.size != 30 {
+		t.Errorf("reopened size = %d, want 30 without the temp file", reopened.size)
+	}
+}
@@ -0,0 +1,71 @@
+package cache
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Invalidation announces that a file changed on Drive through one mount,
+// so that other mounts drop what they cached for it.
+type Invalidation struct {
+	Origin  string `json:"origin"`
+	Op      string `json:"op"`
+	FileID  string `json:"fileId"`
+	Version int64  `json:"version,omitempty"`
+}
+
+// InvalidationBus publishes and receives invalidations on a Redis channel.
+// Messages a bus published itself are not delivered back to it.
+type InvalidationBus struct {
+	client  *redis.Client
+	channel string
+	origin  string
+}
+
+// NewInvalidationBus connects to the Redis server at addr.
+func NewInvalidationBus(addr, channel string) *InvalidationBus {
+	id := make([]byte, 8)
+	rand.Read(id)
+	return &InvalidationBus{
+		client:  redis.NewClient(&redis.Options{Addr: addr}),
+		channel: channel,
+		origin:  hex.EncodeToString(id),
+	}
+}
+
+// Publish sends inv to every other subscriber.
+func (b *InvalidationBus) Publish(inv Invalidation) error {
+	inv.Origin = b.origin
+	data, err := json.Marshal(inv)
+	if err != nil {
+		return err
+	}
+	return b.client.Publish(ctx, b.channel, data).Err()
+}
+
+// Subscribe calls handle for every invalidation published by other buses
+// until stop is closed. The subscription reconnects on its own after
+// network errors.
+func (b *InvalidationBus) Subscribe(stop <-chan struct{}, handle func(Invalidation)) {
+	sub := b.client.Subscribe(ctx, b.channel)
+	go func() {
+		<-stop
+		sub.Close()
+		b.client.Close()
+	}()
+	for msg := range sub.Channel() {
+		var inv Invalidation
+		if err := json.Unmarshal([]byte(msg.Payload), &inv); err != nil {
+			log.Printf("Ignoring malformed invalidation: %v", err)
+			continue
+		}
+		if inv.Origin == b.origin {
+			continue
+		}
+		handle(inv)
+	}
+}
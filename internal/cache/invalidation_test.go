@@ -0,0 +1,79 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// subscribe starts b's subscription and waits until Redis has it.
+func subscribe(t *testing.T, mr *miniredis.Miniredis, b *InvalidationBus, subscribers int) <-chan Invalidation {
+	t.Helper()
+	got := make(chan Invalidation, 10)
+	stop := make(chan struct{})
+	t.Cleanup(func() { close(stop) })
+	go b.Subscribe(stop, func(inv Invalidation) { got <- inv })
+	deadline := time.Now().Add(5 * time.Second)
+	for mr.PubSubNumSub(b.channel)[b.channel] < subscribers {
+		if time.Now().After(deadline) {
+			t.Fatal("subscription not established")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return got
+}
+
+func TestInvalidationBus(t *testing.T) {
+	mr := miniredis.RunT(t)
+	a := NewInvalidationBus(mr.Addr(), "gdrivefs:test")
+	b := NewInvalidationBus(mr.Addr(), "gdrivefs:test")
+	gotA := subscribe(t, mr, a, 1)
+	gotB := subscribe(t, mr, b, 2)
+
+	if err := a.Publish(Invalidation{Op: "upload", FileID: "f1", Version: 7}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case inv := <-gotB:
+		if inv.Op != "upload" || inv.FileID != "f1" || inv.Version != 7 || inv.Origin != a.origin {
+			t.Errorf("received %+v", inv)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("invalidation not delivered")
+	}
+
+	// a bus does not hear itself; b's message shows a's handler is live
+	if err := b.Publish(Invalidation{Op: "delete", FileID: "f2"}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case inv := <-gotA:
+		if inv.FileID != "f2" {
+			t.Errorf("a received its own invalidation %+v", inv)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("invalidation not delivered")
+	}
+	select {
+	case inv := <-gotB:
+		t.Errorf("b received its own invalidation %+v", inv)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestInvalidationBusIgnoresMalformed(t *testing.T) {
+	mr := miniredis.RunT(t)
+	b := NewInvalidationBus(mr.Addr(), "gdrivefs:test")
+	got := subscribe(t, mr, b, 1)
+	mr.Publish("gdrivefs:test", "not json")
+	mr.Publish("gdrivefs:test", `{"origin":"other","op":"rename","fileId":"f3"}`)
+	select {
+	case inv := <-got:
+		if inv.FileID != "f3" {
+			t.Errorf("received %+v", inv)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("invalidation after a malformed one not delivered")
+	}
+}
@@ -0,0 +1,201 @@
+package cache
+
+import (
+	"container/list"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryCache is an in-process LRU cache bounded by total value size and
+// entry count. Pinned keys are kept while they hold at most half of the size
+// bound; past that the least recently used of them are evicted too, so open
+// files cannot grow the cache without limit.
+type MemoryCache struct {
+	mu         sync.Mutex
+	maxBytes   int64
+	maxEntries int
+	size       int64
+	order      *list.List // front is most recently used
+	entries    map[string]*list.Element
+	pins       map[string]int
+	stats      Stats
+}
+
+type memoryEntry struct {
+	key      string
+	value    []byte
+	modified time.Time
+}
+
+// Stats reports cache usage and effectiveness.
+type Stats struct {
+	Entries      int
+	Bytes        int64
+	Hits         uint64
+	Misses       uint64
+	Evictions    uint64
+	EvictedBytes uint64
+}
+
+// NewMemoryCache creates a MemoryCache holding at most maxBytes of values in
+// at most maxEntries entries. A limit <= 0 means unbounded.
+func NewMemoryCache(maxBytes int64, maxEntries int) *MemoryCache {
+	return &MemoryCache{
+		maxBytes:   maxBytes,
+		maxEntries: maxEntries,
+		order:      list.New(),
+		entries:    make(map[string]*list.Element),
+		pins:       make(map[string]int),
+	}
+}
+
+// Get returns the value stored under key and marks it recently used.
+func (m *MemoryCache) Get(key string) ([]byte, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	el, ok := m.entries[key]
+	if !ok {
+		m.stats.Misses++
+		return nil, false, nil
+	}
+	m.stats.Hits++
+	m.order.MoveToFront(el)
+	return el.Value.(*memoryEntry).value, true, nil
+}
+
+// GetReader returns a reader over the value stored under key.
+func (m *MemoryCache) GetReader(key string) (io.ReadCloser, bool, error) {
+	return readerFrom(m.Get(key))
+}
+
+// Set stores value under key, evicting least recently used entries as needed.
+func (m *MemoryCache) Set(key string, value []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if el, ok := m.entries[key]; ok {
+		m.removeElement(el)
+	}
+	m.entries[key] = m.order.PushFront(&memoryEntry{key: key, value: value, modified: time.Now()})
+	m.size += int64(len(value))
+	m.evict()
+	return nil
+}
+
+// SetReader stores everything read from r under key.
+func (m *MemoryCache) SetReader(key string, r io.Reader) error {
+	value, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return m.Set(key, value)
+}
+
+// Delete removes key.
+func (m *MemoryCache) Delete(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if el, ok := m.entries[key]; ok {
+		m.removeElement(el)
+	}
+	return nil
+}
+
+// DeletePrefix removes every key starting with prefix and returns how many
+// entries were dropped.
+func (m *MemoryCache) DeletePrefix(prefix string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := 0
+	for key, el := range m.entries {
+		if strings.HasPrefix(key, prefix) {
+			m.removeElement(el)
+			n++
+		}
+	}
+	return n
+}
+
+// Stat describes the value stored under key.
+func (m *MemoryCache) Stat(key string) (Info, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	el, ok := m.entries[key]
+	if !ok {
+		return Info{}, false, nil
+	}
+	e := el.Value.(*memoryEntry)
+	return Info{Size: int64(len(e.value)), Modified: e.modified}, true, nil
+}
+
+// Pin protects key from eviction until a matching Unpin. The key does not
+// need to be present yet.
+func (m *MemoryCache) Pin(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pins[key]++
+}
+
+// Unpin releases one Pin of key.
+func (m *MemoryCache) Unpin(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.pins[key] <= 1 {
+		delete(m.pins, key)
+		m.evict()
+		return
+	}
+	m.pins[key]--
+}
+
+// Stats returns a snapshot of the cache counters.
+func (m *MemoryCache) Stats() Stats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := m.stats
+	s.Entries = len(m.entries)
+	s.Bytes = m.size
+	return s
+}
+
+// overLimit reports whether the cache exceeds a bound. Caller must hold m.mu.
+func (m *MemoryCache) overLimit() bool {
+	return (m.maxBytes > 0 && m.size > m.maxBytes) ||
+		(m.maxEntries > 0 && len(m.entries) > m.maxEntries)
+}
+
+// evict drops least recently used entries until the cache fits, sparing
+// pinned ones while they stay within half of maxBytes. Caller must hold m.mu.
+func (m *MemoryCache) evict() {
+	if !m.overLimit() {
+		return
+	}
+	var pinned int64
+	for key := range m.pins {
+		if el, ok := m.entries[key]; ok {
+			pinned += int64(len(el.Value.(*memoryEntry).value))
+		}
+	}
+	for el := m.order.Back(); el != nil && m.overLimit(); {
+		prev := el.Prev()
+		e := el.Value.(*memoryEntry)
+		isPinned := m.pins[e.key] > 0
+		if !isPinned || (m.maxBytes > 0 && pinned > m.maxBytes/2) {
+			if isPinned {
+				pinned -= int64(len(e.value))
+			}
+			m.removeElement(el)
+			m.stats.Evictions++
+			m.stats.EvictedBytes += uint64(len(e.value))
+		}
+		el = prev
+	}
+}
+
+// removeElement drops el. Caller must hold m.mu.
+func (m *MemoryCache) removeElement(el *list.Element) {
+	e := m.order.Remove(el).(*memoryEntry)
+	delete(m.entries, e.key)
+	m.size -= int64(len(e.value))
+}
@@ -0,0 +1,122 @@
+package cache
+
+import (
+	"strings"
+	"testing"
+)
+
+// present returns the keys present in m, in the order given.
+func present(m *MemoryCache, keys ...string) []string {
+	var found []string
+	for _, key := range keys {
+		if _, ok, _ := m.Stat(key); ok {
+			found = append(found, key)
+		}
+	}
+	return found
+}
+
+func TestMemoryCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	m := NewMemoryCache(30, 0)
+	m.Set("a", make([]byte, 10))
+	m.Set("b", make([]byte, 10))
+	m.Set("c", make([]byte, 10))
+	m.Get("a")
+	m.Set("d", make([]byte, 10))
+
+	if got := strings.Join(present(m, "a", "b", "c", "d"), ","); got != "a,c,d" {
+		t.Errorf("present = %s, want a,c,d", got)
+	}
+	s := m.Stats()
+	if s.Entries != 3 || s.Bytes != 30 || s.Evictions != 1 || s.EvictedBytes != 10 || s.Hits != 1 {
+		t.Errorf("stats = %+v", s)
+	}
+}
+
+func TestMemoryCacheEntryLimit(t *testing.T) {
+	m := NewMemoryCache(0, 2)
+	for _, key := range []string{"a", "b", "c"} {
+		m.Set(key, []byte(key))
+	}
+	if got := strings.Join(present(m, "a", "b", "c"), ","); got != "b,c" {
+		t.Errorf("present = %s, want b,c", got)
+	}
+}
+
+func TestMemoryCacheReplace(t *testing.T) {
+	m := NewMemoryCache(100, 0)
+	m.Set("a", make([]byte, 40))
+	m.Set("a", make([]byte, 10))
+	if s := m.Stats(); s.Entries != 1 || s.Bytes != 10 {
+		t.Errorf("stats after replace = %+v, want 1 entry of 10 bytes", s)
+	}
+	m.Delete("a")
+	if s := m.Stats(); s.Entries != 0 || s.Bytes != 0 {
+		t.Errorf("stats after delete = %+v, want empty", s)
+	}
+}
+
+func TestMemoryCachePin(t *testing.T) {
+	m := NewMemoryCache(40, 0)
+	m.Pin("a")
+	m.Pin("a")
+	m.Set("a", make([]byte, 20))
+	m.Set("b", make([]byte, 20))
+	m.Set("c", make([]byte, 20))
+	if got := strings.Join(present(m, "a", "b", "c"), ","); got != "a,c" {
+		t.Fatalf("present = %s, want pinned a kept", got)
+	}
+
+	m.Unpin("a")
+	m.Set("d", make([]byte, 20))
+	if got := strings.Join(present(m, "a", "c", "d"), ","); got != "a,d" {
+		t.Fatalf("present = %s, want a still pinned once", got)
+	}
+
+	m.Unpin("a")
+	m.Set("e", make([]byte, 20))
+	if got := strings.Join(present(m, "a", "d", "e"), ","); got != "d,e" {
+		t.Errorf("present = %s, want unpinned a evicted", got)
+	}
+}
+
+func TestMemoryCachePinLimit(t *testing.T) {
+	m := NewMemoryCache(100, 0)
+	for _, key := range []string{"a", "b", "c"} {
+		m.Pin(key)
+		m.Set(key, make([]byte, 30))
+	}
+	// 90 pinned bytes are over half the cache, so the oldest pin goes
+	m.Set("d", make([]byte, 30))
+	if got := strings.Join(present(m, "a", "b", "c", "d"), ","); got != "b,c,d" {
+		t.Errorf("present = %s, want b,c,d", got)
+	}
+	if s := m.Stats(); s.Bytes > 100 {
+		t.Errorf("cache holds %d bytes, over its 100 byte bound", s.Bytes)
+	}
+
+	// 60 pinned bytes are still over half, so b goes before unpinned d
+	m.Set("e", make([]byte, 30))
+	if got := strings.Join(present(m, "b", "c", "d", "e"), ","); got != "c,d,e" {
+		t.Errorf("present = %s, want c,d,e", got)
+	}
+
+	// with c alone within half, it is kept over unpinned entries
+	m.Set("f", make([]byte, 30))
+	if got := strings.Join(present(m, "c", "d", "e", "f"), ","); got != "c,e,f" {
+		t.Errorf("present = %s, want c,e,f", got)
+	}
+}
+
+func TestMemoryCacheDeletePrefix(t *testing.T) {
+	m := NewMemoryCache(0, 0)
+	for _, key := range []string{"f1/0", "f1/1", "f2/0"} {
+		m.Set(key, []byte(key))
+	}
+	if n := m.DeletePrefix("f1/"); n != 2 {
+		t.Errorf("DeletePrefix = %d, want 2", n)
+	}
+	if got := strings.Join(present(m, "f1/0", "f1/1", "f2/0"), ","); got != "f2/0" {
+		t.Errorf("present = %s, want f2/0", got)
+	}
+}
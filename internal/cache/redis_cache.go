@@ -2,7 +2,7 @@ package cache
 
 import (
 	"context"
-	"fmt"
+	"io"
 	"time"
 
 	"github.com/go-redis/redis/v8"
@@ -14,28 +14,65 @@ var ctx = context.Background()
 // RedisCache struct
 type RedisCache struct {
 	client *redis.Client
+	ttl    time.Duration
 }
 
-// NewRedisCache initializes a Redis client
-func NewRedisCache(addr string) *RedisCache {
+// NewRedisCache initializes a Redis client; entries expire after ttl (0 keeps them forever)
+func NewRedisCache(addr string, ttl time.Duration) *RedisCache {
 	client := redis.NewClient(&redis.Options{Addr: addr})
-	return &RedisCache{client: client}
+	return &RedisCache{client: client, ttl: ttl}
 }
 
-// SetCache stores data in Redis
-func (r *RedisCache) SetCache(key string, value string, ttl time.Duration) {
-	err := r.client.Set(ctx, key, value, ttl).Err()
+// Get retrieves data from Redis
+func (r *RedisCache) Get(key string) ([]byte, bool, error) {
+	val, err := r.client.Get(ctx, key).Bytes()
+	if err == redis.Nil {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return val, true, nil
+}
+
+// GetReader retrieves data from Redis as a reader
+func (r *RedisCache) GetReader(key string) (io.ReadCloser, bool, error) {
+	return readerFrom(r.Get(key))
+}
+
+// Set stores data in Redis
+func (r *RedisCache) Set(key string, value []byte) error {
+	return r.client.Set(ctx, key, value, r.ttl).Err()
+}
+
+// SetReader stores everything read from rd in Redis
+func (r *RedisCache) SetReader(key string, rd io.Reader) error {
+	value, err := io.ReadAll(rd)
 	if err != nil {
-		fmt.Println("Error setting cache:", err)
+		return err
 	}
+	return r.Set(key, value)
+}
+
+// Delete removes data from Redis
+func (r *RedisCache) Delete(key string) error {
+	return r.client.Del(ctx, key).Err()
 }
 
-// GetCache retrieves data from Redis
-func (r *RedisCache) GetCache(key string) string {
-	val, err := r.client.Get(ctx, key).Result()
+// Stat reports the size of a Redis entry without fetching it
+func (r *RedisCache) Stat(key string) (Info, bool, error) {
+	n, err := r.client.Exists(ctx, key).Result()
+	if err != nil || n == 0 {
+		return Info{}, false, err
+	}
+	size, err := r.client.StrLen(ctx, key).Result()
 	if err != nil {
-		fmt.Println("Cache miss for:", key)
-		return ""
+		return Info{}, false, err
 	}
-	return val
+	return Info{Size: size}, true, nil
+}
+
+// Ping checks that the Redis server is reachable
+func (r *RedisCache) Ping() error {
+	return r.client.Ping(ctx).Err()
 }
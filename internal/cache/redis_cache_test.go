@@ -0,0 +1,78 @@
+package cache
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestRedisCache(t *testing.T) {
+	mr := miniredis.RunT(t)
+	r := NewRedisCache(mr.Addr(), time.Minute)
+	if err := r.Ping(); err != nil {
+		t.Fatal(err)
+	}
+
+	if value, found, err := r.Get("a"); value != nil || found || err != nil {
+		t.Errorf("Get of missing key = %q, %v, %v, want a plain miss", value, found, err)
+	}
+	if err := r.Set("a", []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if value, found, err := r.Get("a"); string(value) != "hello" || !found || err != nil {
+		t.Errorf("Get = %q, %v, %v", value, found, err)
+	}
+	rd, found, err := r.GetReader("a")
+	if !found || err != nil {
+		t.Fatalf("GetReader = %v, %v", found, err)
+	}
+	data, _ := io.ReadAll(rd)
+	rd.Close()
+	if string(data) != "hello" {
+		t.Errorf("GetReader read %q", data)
+	}
+	if info, found, err := r.Stat("a"); info.Size != 5 || !found || err != nil {
+		t.Errorf("Stat = %+v, %v, %v", info, found, err)
+	}
+
+	if err := r.Delete("a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, found, err := r.Stat("a"); found || err != nil {
+		t.Errorf("Stat after Delete = %v, %v", found, err)
+	}
+}
+
+func TestRedisCacheTTL(t *testing.T) {
+	mr := miniredis.RunT(t)
+	r := NewRedisCache(mr.Addr(), time.Minute)
+	r.Set("a", []byte("hello"))
+	if ttl := mr.TTL("a"); ttl != time.Minute {
+		t.Errorf("TTL = %v, want 1m", ttl)
+	}
+	mr.FastForward(2 * time.Minute)
+	if _, found, _ := r.Get("a"); found {
+		t.Error("entry outlived its TTL")
+	}
+
+	forever := NewRedisCache(mr.Addr(), 0)
+	forever.Set("b", []byte("kept"))
+	if ttl := mr.TTL("b"); ttl != 0 {
+		t.Errorf("TTL = %v, want none", ttl)
+	}
+}
+
+func TestRedisCacheUnreachable(t *testing.T) {
+	mr := miniredis.RunT(t)
+	addr := mr.Addr()
+	r := NewRedisCache(addr, 0)
+	mr.Close()
+	if _, found, err := r.Get("a"); found || err == nil {
+		t.Errorf("Get with Redis down = %v, %v, want an error", found, err)
+	}
+	if _, err := New(Config{Backend: BackendRedis, RedisAddr: addr}); err == nil {
+		t.Error("New accepted an unreachable Redis")
+	}
+}
@@ -0,0 +1,431 @@
+// Package config loads the YAML configuration file with its named
+// profiles and applies environment variable overrides.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultProfileName is used when neither the file nor the caller names one.
+const DefaultProfileName = "default"
+
+// File is the configuration file.
+type File struct {
+	// DefaultProfile is the profile used when none is selected.
+	DefaultProfile string `yaml:"default_profile,omitempty"`
+	// Accounts by name. A profile signs in as one with account.
+	Accounts map[string]Account `yaml:"accounts,omitempty"`
+	// Profiles by name.
+	Profiles map[string]Profile `yaml:"profiles,omitempty"`
+}
+
+// Account is one Google identity and where its token is kept. Zero values
+// select the built-in defaults, except that the token file defaults to one
+// per account.
+type Account struct {
+	Credentials string   `yaml:"credentials,omitempty"`
+	Subject     string   `yaml:"subject,omitempty"`
+	TokenFile   string   `yaml:"token_file,omitempty"`
+	TokenStore  string   `yaml:"token_store,omitempty"`
+	Scopes      []string `yaml:"scopes,omitempty"`
+}
+
+// Profile is one named set of settings. Zero values select the built-in
+// defaults.
+type Profile struct {
+	// Account names the entry of Accounts to sign in as. Its settings
+	// replace Credentials, Subject, TokenFile and TokenStore, and StateDir
+	// defaults to one per account so that mounts of different accounts do
+	// not share an index. Scopes are replaced as well when the account sets
+	// them.
+	Account string `yaml:"account,omitempty"`
+	// Credentials is the OAuth client, service account, external account
+	// or authorized user JSON file, or "adc" for Application Default
+	// Credentials.
+	Credentials string `yaml:"credentials,omitempty"`
+	// Subject is the Workspace user a service account impersonates through
+	// domain-wide delegation.
+	Subject string `yaml:"subject,omitempty"`
+	// TokenFile is where the OAuth token is stored.
+	TokenFile string `yaml:"token_file,omitempty"`
+	// TokenStore keeps the OAuth token in the token file as plain JSON
+	// ("file"), encrypted with $GDRIVE_TOKEN_PASSPHRASE ("encrypted"), or in
+	// the OS keyring ("keyring").
+	TokenStore string `yaml:"token_store,omitempty"`
+	// Scopes are the OAuth scopes requested: drive (the default),
+	// drive.readonly, drive.file or drive.metadata.readonly. Without a
+	// write scope the mount is read-only.
+	Scopes []string `yaml:"scopes,omitempty"`
+	// AuthPort is the loopback port of the OAuth redirect listener. Zero
+	// picks a free port.
+	AuthPort int `yaml:"auth_port,omitempty"`
+	// AuthTimeout bounds how long sign-in waits for consent. Defaults to 5m.
+	AuthTimeout time.Duration `yaml:"auth_timeout,omitempty"`
+	// AuthFlow is how a new token is obtained: auto, browser, device or
+	// paste. auto picks a headless flow when there is no display.
+	AuthFlow string `yaml:"auth_flow,omitempty"`
+	// MountPoint is where Drive is mounted.
+	MountPoint string `yaml:"mount_point,omitempty"`
+	// RootFolder is the Drive folder path shown as the root of the mount
+	// and used by the other commands. Defaults to all of My Drive.
+	RootFolder string `yaml:"root_folder,omitempty"`
+	// DisableSharedDrives hides the SharedDrives folder at the top of My
+	// Drive. root_folder may still point into a shared drive.
+	DisableSharedDrives bool `yaml:"disable_shared_drives,omitempty"`
+	// DisableSharedWithMe hides the SharedWithMe folder at the top of My
+	// Drive; shared files without a My Drive folder then show at the top.
+	DisableSharedWithMe bool `yaml:"disable_shared_with_me,omitempty"`
+	// StateDir holds the index, offline queue, caches and control socket.
+	StateDir string `yaml:"state_dir,omitempty"`
+	// ExportFormats maps Google Docs MIME types to the MIME type they are
+	// downloaded as, e.g. application/vnd.google-apps.document: application/pdf.
+	ExportFormats map[string]string `yaml:"export_formats,omitempty"`
+
+	Log   Log   `yaml:"log,omitempty"`
+	Mount Mount `yaml:"mount,omitempty"`
+	Cache Cache `yaml:"cache,omitempty"`
+	Sync  Sync  `yaml:"sync,omitempty"`
+}
+
+// Log configures logging of the mount.
+type Log struct {
+	// File is appended to. Defaults to gdrive.log in the working directory.
+	File string `yaml:"file,omitempty"`
+	// Quiet stops mirroring the log to standard output.
+	Quiet bool `yaml:"quiet,omitempty"`
+}
+
+// Mount holds FUSE mount options.
+type Mount struct {
+	Options            []string      `yaml:"options,omitempty"`
+	Debug              bool          `yaml:"debug,omitempty"`
+	AllowOther         bool          `yaml:"allow_other,omitempty"`
+	DefaultPermissions bool          `yaml:"default_permissions,omitempty"`
+	ReadOnly           bool          `yaml:"read_only,omitempty"`
+	AttrTimeout        time.Duration `yaml:"attr_timeout,omitempty"`
+	EntryTimeout       time.Duration `yaml:"entry_timeout,omitempty"`
+}
+
+// Cache holds the cache and prefetch settings.
+type Cache struct {
+	MemoryMaxBytes     int64         `yaml:"memory_max_bytes,omitempty"`
+	MemoryMaxEntries   int           `yaml:"memory_max_entries,omitempty"`
+	BlockCacheMaxBytes int64         `yaml:"block_cache_max_bytes,omitempty"`
+	BlockCacheDir      string        `yaml:"block_cache_dir,omitempty"`
+	DisablePrefetch    bool          `yaml:"disable_prefetch,omitempty"`
+	PrefetchBandwidth  int64         `yaml:"prefetch_bandwidth,omitempty"`
+	PrefetchMemory     int64         `yaml:"prefetch_memory,omitempty"`
+	Backend            string        `yaml:"backend,omitempty"`
+	Dir                string        `yaml:"dir,omitempty"`
+	MaxBytes           int64         `yaml:"max_bytes,omitempty"`
+	RedisAddr          string        `yaml:"redis_addr,omitempty"`
+	RedisTTL           time.Duration `yaml:"redis_ttl,omitempty"`
+	RedisChannel       string        `yaml:"redis_channel,omitempty"`
+}
+
+// Sync holds the conflict, locking and control settings.
+type Sync struct {
+	ConflictPolicy  string        `yaml:"conflict_policy,omitempty"`
+	Lock            string        `yaml:"lock,omitempty"`
+	LockTTL         time.Duration `yaml:"lock_ttl,omitempty"`
+	ExclusiveCreate bool          `yaml:"exclusive_create,omitempty"`
+	ControlSocket   string        `yaml:"control_socket,omitempty"`
+}
+
+// DefaultPath is the configuration file used when none is given:
+// $GDRIVE_CONFIG, else gdrivefs/config.yaml in the user config directory.
+func DefaultPath() string {
+	if path := os.Getenv("GDRIVE_CONFIG"); path != "" {
+		return path
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "gdrivefs.yaml"
+	}
+	return filepath.Join(dir, "gdrivefs", "config.yaml")
+}
+
+// Load reads the configuration file at path, or DefaultPath if path is
+// empty. A missing default file yields an empty configuration; unknown keys
+// are errors so that typos do not go unnoticed.
+func Load(path string) (*File, error) {
+	explicit := path != ""
+	if !explicit {
+		path = DefaultPath()
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && !explicit {
+		return &File{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+	var f File
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&f); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return &f, nil
+}
+
+// ProfileNames returns the names of the profiles in f, sorted.
+func (f *File) ProfileNames() []string {
+	names := make([]string, 0, len(f.Profiles))
+	for name := range f.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ProfileName resolves the profile to use: name if set, else
+// $GDRIVE_PROFILE, else the file's default profile, else "default".
+func (f *File) ProfileName(name string) string {
+	if name == "" {
+		name = os.Getenv("GDRIVE_PROFILE")
+	}
+	if name == "" {
+		name = f.DefaultProfile
+	}
+	if name == "" {
+		name = DefaultProfileName
+	}
+	return name
+}
+
+// Profile returns the profile selected by ProfileName(name) with
+// environment overrides applied and "~" expanded in paths. The "default"
+// profile may be absent from the file.
+func (f *File) Profile(name string) (Profile, error) {
+	return f.ProfileFor(name, "")
+}
+
+// ProfileFor is Profile signing in as account, if set, or $GDRIVE_ACCOUNT
+// instead of the profile's own account.
+func (f *File) ProfileFor(name, account string) (Profile, error) {
+	name = f.ProfileName(name)
+	p, ok := f.Profiles[name]
+	if !ok && name != DefaultProfileName {
+		return Profile{}, fmt.Errorf("unknown profile %q (have %s)", name, strings.Join(f.ProfileNames(), ", "))
+	}
+	if account == "" {
+		account = os.Getenv("GDRIVE_ACCOUNT")
+	}
+	if account != "" {
+		p.Account = account
+	}
+	if p.Account != "" {
+		if err := f.applyAccount(&p); err != nil {
+			return Profile{}, err
+		}
+	}
+	if err := p.applyEnv(); err != nil {
+		return Profile{}, err
+	}
+	p.expandPaths()
+	return p, nil
+}
+
+// AccountNames returns the names of the accounts in f, sorted.
+func (f *File) AccountNames() []string {
+	names := make([]string, 0, len(f.Accounts))
+	for name := range f.Accounts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// applyAccount replaces the sign-in settings of p with its account's.
+func (f *File) applyAccount(p *Profile) error {
+	a, ok := f.Accounts[p.Account]
+	if !ok {
+		return fmt.Errorf("unknown account %q (have %s)", p.Account, strings.Join(f.AccountNames(), ", "))
+	}
+	p.Credentials = a.Credentials
+	p.Subject = a.Subject
+	p.TokenStore = a.TokenStore
+	if len(a.Scopes) > 0 {
+		p.Scopes = a.Scopes
+	}
+	p.TokenFile = a.TokenFile
+	if p.TokenFile == "" {
+		p.TokenFile = filepath.Join(filepath.Dir(DefaultPath()), "tokens", p.Account+".json")
+	}
+	if p.StateDir == "" {
+		// the mount's default state directory, one level down
+		if dir, err := os.UserCacheDir(); err == nil {
+			p.StateDir = filepath.Join(dir, "GDriveFS", "accounts", p.Account)
+		}
+	}
+	return nil
+}
+
+// ValidAccountName reports whether name can name an account. Names end up in
+// file names, so they are limited to letters, digits, '.', '_' and '-'.
+func ValidAccountName(name string) error {
+	if name == "" || name == "." || name == ".." {
+		return fmt.Errorf("invalid account name %q", name)
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '_' || r == '-') {
+			return fmt.Errorf("invalid account name %q: use letters, digits, '.', '_' and '-'", name)
+		}
+	}
+	return nil
+}
+
+// SetAccount adds or replaces the account name in the configuration file at
+// path, or removes it if a is nil. The rest of the file, comments included,
+// is kept.
+func SetAccount(path, name string, a *Account) error {
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to read config: %w", err)
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if len(doc.Content) == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return fmt.Errorf("%s: top level is not a mapping", path)
+	}
+	accounts := mappingValue(root, "accounts")
+	if accounts != nil && accounts.Kind != yaml.MappingNode {
+		// "accounts:" with nothing below
+		*accounts = yaml.Node{Kind: yaml.MappingNode}
+	}
+	if accounts == nil {
+		if a == nil {
+			return nil
+		}
+		accounts = &yaml.Node{Kind: yaml.MappingNode}
+		root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: "accounts"}, accounts)
+	}
+	for i := 0; i < len(accounts.Content); i += 2 {
+		if accounts.Content[i].Value == name {
+			accounts.Content = append(accounts.Content[:i], accounts.Content[i+2:]...)
+			break
+		}
+	}
+	if a != nil {
+		var value yaml.Node
+		if err := value.Encode(a); err != nil {
+			return err
+		}
+		accounts.Content = append(accounts.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: name}, &value)
+	}
+
+	var out bytes.Buffer
+	enc := yaml.NewEncoder(&out)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, out.Bytes(), 0600)
+}
+
+// mappingValue returns the value of key in the mapping node m, or nil.
+func mappingValue(m *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return m.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// applyEnv overrides settings from GDRIVE_* environment variables.
+func (p *Profile) applyEnv() error {
+	strs := map[string]*string{
+		"GDRIVE_CREDENTIALS":     &p.Credentials,
+		"GDRIVE_SUBJECT":         &p.Subject,
+		"GDRIVE_TOKEN_FILE":      &p.TokenFile,
+		"GDRIVE_TOKEN_STORE":     &p.TokenStore,
+		"GDRIVE_AUTH_FLOW":       &p.AuthFlow,
+		"GDRIVE_MOUNT_POINT":     &p.MountPoint,
+		"GDRIVE_ROOT_FOLDER":     &p.RootFolder,
+		"GDRIVE_STATE_DIR":       &p.StateDir,
+		"GDRIVE_LOG_FILE":        &p.Log.File,
+		"GDRIVE_CACHE":           &p.Cache.Backend,
+		"GDRIVE_CACHE_DIR":       &p.Cache.Dir,
+		"GDRIVE_REDIS_ADDR":      &p.Cache.RedisAddr,
+		"GDRIVE_CONFLICT_POLICY": &p.Sync.ConflictPolicy,
+		"GDRIVE_LOCK":            &p.Sync.Lock,
+		"GDRIVE_CONTROL_SOCKET":  &p.Sync.ControlSocket,
+	}
+	for env, field := range strs {
+		if v, ok := os.LookupEnv(env); ok {
+			*field = v
+		}
+	}
+	ints := map[string]*int64{
+		"GDRIVE_MEM_CACHE_MAX_BYTES":   &p.Cache.MemoryMaxBytes,
+		"GDRIVE_BLOCK_CACHE_MAX_BYTES": &p.Cache.BlockCacheMaxBytes,
+		"GDRIVE_CACHE_MAX_BYTES":       &p.Cache.MaxBytes,
+	}
+	for env, field := range ints {
+		if v, ok := os.LookupEnv(env); ok {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return fmt.Errorf("%s: %w", env, err)
+			}
+			*field = n
+		}
+	}
+	if v, ok := os.LookupEnv("GDRIVE_SCOPES"); ok {
+		p.Scopes = strings.FieldsFunc(v, func(r rune) bool { return r == ',' || r == ' ' })
+	}
+	if v, ok := os.LookupEnv("GDRIVE_AUTH_PORT"); ok {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("GDRIVE_AUTH_PORT: %w", err)
+		}
+		p.AuthPort = n
+	}
+	return nil
+}
+
+// expandPaths replaces a leading "~" in file paths with the home directory.
+func (p *Profile) expandPaths() {
+	for _, path := range []*string{&p.Credentials, &p.TokenFile, &p.MountPoint, &p.StateDir,
+		&p.Log.File, &p.Cache.BlockCacheDir, &p.Cache.Dir, &p.Sync.ControlSocket} {
+		*path = ExpandHome(*path)
+	}
+}
+
+// ExpandHome replaces a leading "~/" in path with the home directory.
+func ExpandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, strings.TrimPrefix(path, "~"))
+}
+
+// Marshal returns the YAML form of p.
+func (p Profile) Marshal() ([]byte, error) {
+	return yaml.Marshal(p)
+}
@@ -0,0 +1,234 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// isolate points the configuration and home directories at temp dirs and
+// clears the GDRIVE_* overrides.
+func isolate(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(dir, "config"))
+	t.Setenv("XDG_CACHE_HOME", filepath.Join(dir, "cache"))
+	for _, kv := range os.Environ() {
+		if name, _, _ := strings.Cut(kv, "="); strings.HasPrefix(name, "GDRIVE_") {
+			t.Setenv(name, "")
+			os.Unsetenv(name)
+		}
+	}
+	return dir
+}
+
+// writeConfig writes content to a configuration file in dir.
+func writeConfig(t *testing.T, dir, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+const testConfig = `
+default_profile: work
+accounts:
+  project:
+    credentials: ~/project.json
+    token_store: keyring
+    scopes: [drive.readonly]
+profiles:
+  work:
+    mount_point: ~/drive
+    export_formats:
+      application/vnd.google-apps.document: application/pdf
+    cache:
+      memory_max_bytes: 1024
+    sync:
+      lock_ttl: 30s
+  data:
+    account: project
+    scopes: [drive]
+`
+
+func TestLoad(t *testing.T) {
+	dir := isolate(t)
+	f, err := Load(writeConfig(t, dir, testConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(f.ProfileNames(), ","); got != "data,work" {
+		t.Errorf("ProfileNames = %s, want data,work", got)
+	}
+	prof, err := f.Profile("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prof.MountPoint != filepath.Join(dir, "drive") {
+		t.Errorf("mount_point = %s, want ~ expanded", prof.MountPoint)
+	}
+	if prof.Cache.MemoryMaxBytes != 1024 || prof.Sync.LockTTL != 30*time.Second {
+		t.Errorf("cache/sync = %+v %+v", prof.Cache, prof.Sync)
+	}
+	if prof.ExportFormats["application/vnd.google-apps.document"] != "application/pdf" {
+		t.Errorf("export_formats = %v", prof.ExportFormats)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	dir := isolate(t)
+	if _, err := Load(filepath.Join(dir, "missing.yaml")); err == nil {
+		t.Error("missing explicit file accepted")
+	}
+	if _, err := Load(writeConfig(t, dir, "profiles:\n  work:\n    mount_piont: /mnt\n")); err == nil {
+		t.Error("unknown key accepted")
+	}
+
+	// a missing default file is an empty configuration
+	f, err := Load("")
+	if err != nil || len(f.Profiles) != 0 {
+		t.Fatalf("Load of missing default = %+v, %v", f, err)
+	}
+	if prof, err := f.Profile(""); err != nil || prof.MountPoint != "" {
+		t.Errorf("default profile = %+v, %v", prof, err)
+	}
+	if _, err := f.Profile("work"); err == nil {
+		t.Error("unknown profile accepted")
+	}
+}
+
+func TestProfileName(t *testing.T) {
+	isolate(t)
+	f := &File{DefaultProfile: "work"}
+	if got := f.ProfileName(""); got != "work" {
+		t.Errorf("ProfileName = %s, want the file's default", got)
+	}
+	t.Setenv("GDRIVE_PROFILE", "env")
+	if got := f.ProfileName(""); got != "env" {
+		t.Errorf("ProfileName = %s, want $GDRIVE_PROFILE", got)
+	}
+	if got := f.ProfileName("flag"); got != "flag" {
+		t.Errorf("ProfileName = %s, want the given name", got)
+	}
+	if got := (&File{}).ProfileName(""); got != "env" {
+		t.Errorf("ProfileName = %s, want $GDRIVE_PROFILE", got)
+	}
+	os.Unsetenv("GDRIVE_PROFILE")
+	if got := (&File{}).ProfileName(""); got != DefaultProfileName {
+		t.Errorf("ProfileName = %s, want %s", got, DefaultProfileName)
+	}
+}
+
+func TestProfileAccount(t *testing.T) {
+	dir := isolate(t)
+	f, err := Load(writeConfig(t, dir, testConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	prof, err := f.Profile("data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prof.Credentials != filepath.Join(dir, "project.json") || prof.TokenStore != "keyring" {
+		t.Errorf("sign-in = %s %s, want the account's", prof.Credentials, prof.TokenStore)
+	}
+	if strings.Join(prof.Scopes, ",") != "drive.readonly" {
+		t.Errorf("scopes = %v, want the account's", prof.Scopes)
+	}
+	if want := filepath.Join(dir, "config", "gdrivefs", "tokens", "project.json"); prof.TokenFile != want {
+		t.Errorf("token_file = %s, want %s", prof.TokenFile, want)
+	}
+	if want := filepath.Join(dir, "cache", "GDriveFS", "accounts", "project"); prof.StateDir != want {
+		t.Errorf("state_dir = %s, want %s", prof.StateDir, want)
+	}
+
+	if _, err := f.ProfileFor("work", "nobody"); err == nil || !strings.Contains(err.Error(), "have project") {
+		t.Errorf("unknown account: %v", err)
+	}
+	t.Setenv("GDRIVE_ACCOUNT", "project")
+	if prof, err := f.Profile("work"); err != nil || prof.TokenStore != "keyring" {
+		t.Errorf("$GDRIVE_ACCOUNT not applied: %+v, %v", prof, err)
+	}
+}
+
+func TestProfileEnv(t *testing.T) {
+	dir := isolate(t)
+	f, err := Load(writeConfig(t, dir, testConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GDRIVE_MOUNT_POINT", "/mnt/drive")
+	t.Setenv("GDRIVE_MEM_CACHE_MAX_BYTES", "2048")
+	t.Setenv("GDRIVE_SCOPES", "drive.file, drive.metadata.readonly")
+	t.Setenv("GDRIVE_AUTH_PORT", "8085")
+	prof, err := f.Profile("work")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prof.MountPoint != "/mnt/drive" || prof.Cache.MemoryMaxBytes != 2048 || prof.AuthPort != 8085 {
+		t.Errorf("overrides not applied: %+v", prof)
+	}
+	if strings.Join(prof.Scopes, ",") != "drive.file,drive.metadata.readonly" {
+		t.Errorf("scopes = %v", prof.Scopes)
+	}
+
+	t.Setenv("GDRIVE_AUTH_PORT", "http")
+	if _, err := f.Profile("work"); err == nil {
+		t.Error("bad GDRIVE_AUTH_PORT accepted")
+	}
+}
+
+func TestValidAccountName(t *testing.T) {
+	for name, valid := range map[string]bool{
+		"project": true, "me.example-2_b": true,
+		"": false, ".": false, "..": false, "a/b": false, "a b": false,
+	} {
+		if err := ValidAccountName(name); (err == nil) != valid {
+			t.Errorf("ValidAccountName(%q) = %v, want valid %v", name, err, valid)
+		}
+	}
+}
+
+func TestSetAccount(t *testing.T) {
+	dir := isolate(t)
+	path := writeConfig(t, dir, "# my settings\nprofiles:\n  work:\n    account: home # personal\n")
+	if err := SetAccount(path, "home", &Account{TokenStore: "keyring"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetAccount(path, "old", &Account{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetAccount(path, "old", nil); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	for _, want := range []string{"# my settings", "# personal"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("comment %q lost:\n%s", want, data)
+		}
+	}
+	f, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(f.AccountNames(), ","); got != "home" {
+		t.Errorf("accounts = %s, want home", got)
+	}
+	if f.Accounts["home"].TokenStore != "keyring" {
+		t.Errorf("home = %+v", f.Accounts["home"])
+	}
+
+	// a new file is created
+	fresh := filepath.Join(dir, "new", "config.yaml")
+	if err := SetAccount(fresh, "home", &Account{}); err != nil {
+		t.Fatal(err)
+	}
+	if f, err := Load(fresh); err != nil || len(f.Accounts) != 1 {
+		t.Errorf("new file = %+v, %v", f, err)
+	}
+}
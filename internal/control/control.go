@@ -0,0 +1,196 @@
+// Package control implements the local socket used to send commands to a
+// running mount, such as cache warming.
+package control
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Request is a command sent to a running mount.
+type Request struct {
+	Action   string   `json:"action"`
+	Paths    []string `json:"paths,omitempty"`
+	Parallel int      `json:"parallel,omitempty"`
+}
+
+// message is one line of a response. Progress lines are followed by a
+// single line with Done set carrying the result or error.
+type message struct {
+	Progress string          `json:"progress,omitempty"`
+	Result   json.RawMessage `json:"result,omitempty"`
+	Error    string          `json:"error,omitempty"`
+	Done     bool            `json:"done,omitempty"`
+}
+
+// Handler serves one action. Text written to progress is streamed to the
+// client line by line; the returned result is sent as JSON.
+type Handler func(req Request, progress io.Writer) (interface{}, error)
+
+// Server accepts requests on a Unix domain socket.
+type Server struct {
+	ln       net.Listener
+	path     string
+	mu       sync.RWMutex
+	handlers map[string]Handler
+}
+
+// Listen creates the socket at path, replacing a stale one left behind by
+// a process that did not shut down cleanly.
+func Listen(path string) (*Server, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create socket directory: %v", err)
+	}
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("control socket %s is in use by another mount", path)
+	}
+	os.Remove(path)
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %v", path, err)
+	}
+	os.Chmod(path, 0600)
+	return &Server{ln: ln, path: path, handlers: make(map[string]Handler)}, nil
+}
+
+// Handle registers h for action.
+func (s *Server) Handle(action string, h Handler) {
+	s.mu.Lock()
+	s.handlers[action] = h
+	s.mu.Unlock()
+}
+
+// Serve accepts connections until Close is called.
+func (s *Server) Serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Printf("control socket accept error: %v", err)
+			}
+			return
+		}
+		go s.serveConn(conn)
+	}
+}
+
+// Close stops the server and removes the socket.
+func (s *Server) Close() error {
+	err := s.ln.Close()
+	os.Remove(s.path)
+	return err
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer conn.Close()
+	enc := json.NewEncoder(conn)
+	var req Request
+	if err := json.NewDecoder(conn).Decode(&req); err != nil {
+		enc.Encode(message{Error: fmt.Sprintf("bad request: %v", err), Done: true})
+		return
+	}
+	s.mu.RLock()
+	h, ok := s.handlers[req.Action]
+	s.mu.RUnlock()
+	if !ok {
+		enc.Encode(message{Error: fmt.Sprintf("unknown action %q", req.Action), Done: true})
+		return
+	}
+	pw := &progressWriter{enc: enc}
+	result, err := h(req, pw)
+	pw.flush()
+	if err != nil {
+		enc.Encode(message{Error: err.Error(), Done: true})
+		return
+	}
+	raw, err := json.Marshal(result)
+	if err != nil {
+		enc.Encode(message{Error: err.Error(), Done: true})
+		return
+	}
+	enc.Encode(message{Result: raw, Done: true})
+}
+
+// progressWriter turns written text into progress messages, one per line.
+type progressWriter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	buf []byte
+}
+
+func (w *progressWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buf = append(w.buf, b...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		if err := w.enc.Encode(message{Progress: string(w.buf[:i])}); err != nil {
+			return 0, err
+		}
+		w.buf = w.buf[i+1:]
+	}
+	return len(b), nil
+}
+
+func (w *progressWriter) flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.buf) > 0 {
+		w.enc.Encode(message{Progress: string(w.buf)})
+		w.buf = nil
+	}
+}
+
+// ErrNoServer is returned by Call when no mount is listening on the socket.
+var ErrNoServer = errors.New("no running mount on control socket")
+
+// Call sends req to the mount listening at path, copying progress lines to
+// progress and decoding the result into result (which may be nil).
+func Call(path string, req Request, progress io.Writer, result interface{}) error {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return ErrNoServer
+	}
+	defer conn.Close()
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return fmt.Errorf("failed to send request: %v", err)
+	}
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var msg message
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			return fmt.Errorf("bad response: %v", err)
+		}
+		if msg.Progress != "" && progress != nil {
+			fmt.Fprintln(progress, msg.Progress)
+		}
+		if !msg.Done {
+			continue
+		}
+		if msg.Error != "" {
+			return errors.New(msg.Error)
+		}
+		if result != nil && len(msg.Result) > 0 {
+			return json.Unmarshal(msg.Result, result)
+		}
+		return nil
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read response: %v", err)
+	}
+	return fmt.Errorf("mount closed the connection without a result")
+}
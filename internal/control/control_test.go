@@ -0,0 +1,79 @@
+package control
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// listen starts a server on a fresh socket. The directory is kept short
+// because socket paths are limited to about a hundred bytes.
+func listen(t *testing.T) (*Server, string) {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "ctl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "sock")
+	s, err := Listen(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve()
+	t.Cleanup(func() { s.Close() })
+	return s, path
+}
+
+func TestCall(t *testing.T) {
+	s, path := listen(t)
+	s.Handle("count", func(req Request, progress io.Writer) (interface{}, error) {
+		for _, p := range req.Paths {
+			fmt.Fprintf(progress, "got %s\n", p)
+		}
+		// a last line without a newline is still sent
+		io.WriteString(progress, "done")
+		return map[string]int{"count": len(req.Paths)}, nil
+	})
+	s.Handle("fail", func(req Request, progress io.Writer) (interface{}, error) {
+		return nil, errors.New("nothing to do")
+	})
+
+	var progress strings.Builder
+	var result struct{ Count int }
+	if err := Call(path, Request{Action: "count", Paths: []string{"a", "b"}}, &progress, &result); err != nil {
+		t.Fatal(err)
+	}
+	if want := "got a\ngot b\ndone\n"; progress.String() != want {
+		t.Errorf("progress = %q, want %q", progress.String(), want)
+	}
+	if result.Count != 2 {
+		t.Errorf("result count = %d, want 2", result.Count)
+	}
+
+	if err := Call(path, Request{Action: "fail"}, nil, nil); err == nil || err.Error() != "nothing to do" {
+		t.Errorf("handler error = %v", err)
+	}
+	if err := Call(path, Request{Action: "other"}, nil, nil); err == nil || !strings.Contains(err.Error(), "unknown action") {
+		t.Errorf("unknown action error = %v", err)
+	}
+}
+
+func TestCallNoServer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sock")
+	if err := Call(path, Request{Action: "warm"}, nil, nil); err != ErrNoServer {
+		t.Errorf("Call without a server = %v, want ErrNoServer", err)
+	}
+
+	// a second mount cannot take over a socket that is in use
+	_, path = listen(t)
+	s, err := Listen(path)
+	if err == nil {
+		s.Close()
+		t.Error("Listen on a socket in use succeeded")
+	}
+}
@@ -2,9 +2,9 @@ package drive
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -16,24 +16,93 @@ import (
 	"google.golang.org/api/option"
 )
 
-// AuthenticateGoogleDrive initializes Google Drive API client
-func AuthenticateGoogleDrive() (*drive.Service, error) {
-	ctx := context.Background()
+// AuthConfig says where credentials and tokens are kept. Zero values select
+// the defaults.
+type AuthConfig struct {
+	// CredentialsFile is the OAuth client JSON downloaded from the Google
+	// Cloud console, or a service account, external account (workload
+	// identity federation) or authorized user file, told apart by their
+	// contents. CredentialsADC uses Application Default Credentials.
+	// Defaults to configs/credentials.json.
+	CredentialsFile string
+	// Subject is the user a service account acts as through domain-wide
+	// delegation. Empty uses the service account's own Drive.
+	Subject string
+	// TokenFile caches the OAuth token, and names its keyring entry.
+	// Defaults to ~/.credentials/token.json.
+	TokenFile string
+	// TokenStore selects where the token is kept: StoreFile (the default),
+	// StoreEncrypted or StoreKeyring.
+	TokenStore string
+	// RedirectPort is the loopback port the browser is sent back to after
+	// consent. Zero picks a free port, which Desktop app clients accept;
+	// Web application clients need the port of their registered redirect URI.
+	RedirectPort int
+	// Timeout bounds how long the browser and paste flows wait for the user.
+	// Defaults to 5 minutes.
+	Timeout time.Duration
+	// Scopes are the OAuth scopes requested, as short names ("drive.readonly")
+	// or URLs. Defaults to full access ("drive").
+	Scopes []string
+	// Flow selects how a new token is obtained: FlowBrowser, FlowDevice,
+	// FlowPaste, or FlowAuto (the default), which uses the browser when a
+	// display is available and the headless flows otherwise.
+	Flow string
+}
 
-	// Load credentials.json
-	b, err := os.ReadFile("configs/credentials.json")
+// withDefaults fills in unset fields.
+func (c AuthConfig) withDefaults() (AuthConfig, error) {
+	if c.CredentialsFile == "" {
+		c.CredentialsFile = "configs/credentials.json"
+	}
+	if c.TokenFile == "" {
+		file, err := tokenCacheFile()
+		if err != nil {
+			return c, fmt.Errorf("unable to get path to cached credential file: %v", err)
+		}
+		c.TokenFile = file
+	}
+	if c.TokenStore == "" {
+		c.TokenStore = StoreFile
+	}
+	if c.Timeout == 0 {
+		c.Timeout = 5 * time.Minute
+	}
+	if c.Flow == "" {
+		c.Flow = FlowAuto
+	}
+	scopes, err := ParseScopes(c.Scopes)
 	if err != nil {
-		return nil, fmt.Errorf("unable to read client secret file: %v", err)
+		return c, err
 	}
+	c.Scopes = scopes
+	return c, nil
+}
 
-	// Parse credentials
-	config, err := google.ConfigFromJSON(b, drive.DriveScope)
+// AuthenticateGoogleDrive initializes Google Drive API client with the
+// default AuthConfig
+func AuthenticateGoogleDrive() (*drive.Service, error) {
+	return Authenticate(AuthConfig{})
+}
+
+// Authenticate initializes a Google Drive API client as configured by cfg
+func Authenticate(cfg AuthConfig) (*drive.Service, error) {
+	ctx := context.Background()
+	cfg, err := cfg.withDefaults()
 	if err != nil {
-		return nil, fmt.Errorf("unable to parse client secret file: %v", err)
+		return nil, err
 	}
 
-	// Get token
-	client := getClient(config)
+	var client *http.Client
+	if cfg.CredentialsFile == CredentialsADC {
+		log.Println("Using Application Default Credentials")
+		client, err = nonInteractiveClient(ctx, cfg, nil)
+	} else {
+		client, err = fileClient(ctx, cfg)
+	}
+	if err != nil {
+		return nil, err
+	}
 	service, err := drive.NewService(ctx, option.WithHTTPClient(client))
 	if err != nil {
 		return nil, fmt.Errorf("unable to initialize Drive client: %v", err)
@@ -42,29 +111,111 @@ func AuthenticateGoogleDrive() (*drive.Service, error) {
 	return service, nil
 }
 
-// getClient retrieves a Token from a local server and handles token refresh
-func getClient(config *oauth2.Config) *http.Client {
-	cacheFile, err := tokenCacheFile()
+// fileClient returns a client for the credentials file in cfg, running the
+// OAuth consent flow if it holds an OAuth client and no token is cached.
+func fileClient(ctx context.Context, cfg AuthConfig) (*http.Client, error) {
+	data, err := os.ReadFile(cfg.CredentialsFile)
 	if err != nil {
-		log.Fatalf("Unable to get path to cached credential file. %v", err)
+		return nil, fmt.Errorf("unable to read client secret file: %v", err)
+	}
+	typ, err := CredentialsType(data)
+	if err != nil {
+		return nil, err
+	}
+	if typ != CredentialsOAuthClient {
+		if cfg.Subject != "" {
+			log.Printf("Using %s credentials acting as %s", typ, cfg.Subject)
+		} else {
+			log.Printf("Using %s credentials", typ)
+		}
+		return nonInteractiveClient(ctx, cfg, data)
 	}
+	if cfg.Subject != "" {
+		return nil, fmt.Errorf("subject %s can only be impersonated with a service account", cfg.Subject)
+	}
+	config, err := LoadOAuthConfig(cfg.CredentialsFile, cfg.Scopes...)
+	if err != nil {
+		return nil, err
+	}
+	// Get token
+	return getClient(config, cfg)
+}
 
-	// Read the token from the cache file.
-	token, err := tokenFromFile(cacheFile)
-	if err != nil || !token.Valid() {
-		log.Println("Token not found or invalid, getting new token...")
-		token = getTokenFromWeb(config)
+// LoadOAuthConfig reads an OAuth client JSON file, requesting scopes, or
+// full access to Drive if none are given.
+func LoadOAuthConfig(credentialsFile string, scopes ...string) (*oauth2.Config, error) {
+	if len(scopes) == 0 {
+		scopes = []string{drive.DriveScope}
+	}
+	b, err := os.ReadFile(credentialsFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read client secret file: %v", err)
+	}
+	config, err := google.ConfigFromJSON(b, scopes...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse client secret file: %v", err)
+	}
+	if config.Endpoint.DeviceAuthURL == "" {
+		config.Endpoint.DeviceAuthURL = google.Endpoint.DeviceAuthURL
+	}
+	return config, nil
+}
 
-		// Save the token to the cache file.
-		if err := saveToken(cacheFile, token); err != nil {
-			log.Fatalf("Unable to save token to cache file. %v", err)
+// getClient returns a client for the stored token, refreshing it with the
+// refresh token as needed. The interactive flow only runs when there is no
+// usable token or Google rejects the refresh token.
+func getClient(config *oauth2.Config, cfg AuthConfig) (*http.Client, error) {
+	store, err := OpenTokenStore(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// Read the token from the store.
+	token, err := store.Load()
+	if err == nil && !token.Valid() {
+		if token.RefreshToken == "" {
+			err = fmt.Errorf("token expired and has no refresh token")
+		} else if fresh, rerr := newPersistingTokenSource(config, token, store.Save).Token(); rerr == nil {
+			token = fresh
+		} else if isInvalidGrant(rerr) {
+			err = rerr
+		} else {
+			// most likely offline: keep the token and let requests retry
+			log.Printf("Unable to refresh token, retrying on first use: %v", rerr)
+		}
+	}
+	if err != nil {
+		log.Printf("Token not usable (%v), getting new token...", err)
+		token, err = obtainToken(config, cfg)
+		if err != nil {
+			return nil, err
+		}
+
+		fmt.Printf("Saving token to: %s\n", store)
+		if err := store.Save(token); err != nil {
+			return nil, fmt.Errorf("unable to save token: %v", err)
 		}
 	}
 
-	// Create a token source with auto-refresh
-	tokenSource := config.TokenSource(context.Background(), token)
+	// Refreshed tokens are written back to the store
+	return oauth2.NewClient(context.Background(), newPersistingTokenSource(config, token, store.Save)), nil
+}
 
-	return oauth2.NewClient(context.Background(), oauth2.ReuseTokenSource(token, tokenSource))
+// OpenTokenStore opens the token store selected by cfg, moving a token kept
+// by another backend for the same token file into it.
+func OpenTokenStore(cfg AuthConfig) (TokenStore, error) {
+	cfg, err := cfg.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+	store, err := NewTokenStore(cfg.TokenStore, cfg.TokenFile)
+	if err != nil {
+		return nil, err
+	}
+	if err := MigrateToken(store, cfg.TokenStore, cfg.TokenFile); err != nil {
+		return nil, err
+	}
+	return store, nil
 }
 
 // tokenCacheFile returns the file path where the credentials are cached.
@@ -80,107 +231,75 @@ func tokenCacheFile() (string, error) {
 	return filepath.Join(homeDir, ".credentials", fname), nil
 }
 
-// getTokenFromWeb uses Config to request a Token with local server based authorization flow
-func getTokenFromWeb(config *oauth2.Config) *oauth2.Token {
-	// Setup local server to handle the redirect
-	config.RedirectURL = "http://localhost:8080/callback"
-	
-	// Create a channel to receive the authorization code
-	codeChan := make(chan string)
-	
-	// Create a new ServeMux to avoid conflicts with the default one
-	mux := http.NewServeMux()
-	
-	// Setup a local HTTP server to handle the callback
-	server := &http.Server{
-		Addr:    ":8080",
-		Handler: mux,
+// getTokenFromWeb runs the authorization code flow with a loopback
+// redirect. The listener binds to 127.0.0.1 on port, or a free port if it is
+// 0. The request carries a random state, checked on the callback, and a PKCE
+// S256 challenge.
+func getTokenFromWeb(config *oauth2.Config, port int, timeout time.Duration) (*oauth2.Token, error) {
+	listener, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		return nil, fmt.Errorf("unable to start redirect listener: %v", err)
 	}
-	
-	// Define the callback handler
+	config.RedirectURL = loopbackRedirect(listener.Addr().(*net.TCPAddr).Port)
+
+	state, err := randomState()
+	if err != nil {
+		return nil, err
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	// Only the first valid callback is used; later ones are answered but dropped
+	results := make(chan callbackResult, 1)
+	mux := http.NewServeMux()
 	mux.HandleFunc("/callback", func(w http.ResponseWriter, r *http.Request) {
-		code := r.URL.Query().Get("code")
-		if code == "" {
-			fmt.Fprintf(w, "Error: No authorization code received")
-			codeChan <- ""
+		res := parseCallback(r.URL.Query(), state)
+		if res.forged {
+			// Not from our request: keep waiting for the real one
+			log.Printf("Ignoring OAuth callback with mismatched state")
+			writeCallbackPage(w, http.StatusBadRequest, res.err)
 			return
 		}
-		
-		// Return a success page to the user
-		fmt.Fprintf(w, "Authorization successful! You can close this window and return to the application.")
-		
-		// Send the code through the channel
-		codeChan <- code
+		writeCallbackPage(w, http.StatusOK, res.err)
+		select {
+		case results <- res:
+		default:
+		}
 	})
-	
-	// Start the server in a goroutine
+	server := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
 	go func() {
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
 			log.Printf("HTTP server error: %v", err)
 		}
 	}()
-	
-	// Generate the authorization URL
-	authURL := config.AuthCodeURL("state-token", oauth2.AccessTypeOffline)
-	fmt.Printf("Please open the following URL in your browser to authorize the application:\n%v\n", authURL)
-	
-	// Wait for the code to be received
-	code := <-codeChan
-	
-	// Shutdown the server
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	if err := server.Shutdown(ctx); err != nil {
-		log.Printf("Server shutdown error: %v", err)
-	}
-	
-	if code == "" {
-		log.Fatalf("No authorization code received")
-	}
-	
-	// Exchange the authorization code for a token
-	tok, err := config.Exchange(context.Background(), code)
-	if err != nil {
-		log.Fatalf("Unable to retrieve token from web: %v", err)
-	}
-	
-	return tok
-}
-
-// tokenFromFile retrieves a Token from a local file.
-func tokenFromFile(file string) (*oauth2.Token, error) {
-	f, err := os.Open(file)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open token file: %v", err)
-	}
-	defer f.Close()
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			log.Printf("Server shutdown error: %v", err)
+		}
+	}()
 
-	tok := &oauth2.Token{}
-	if err := json.NewDecoder(f).Decode(tok); err != nil {
-		return nil, fmt.Errorf("failed to decode token: %v", err)
-	}
+	authURL := config.AuthCodeURL(state, oauth2.AccessTypeOffline, oauth2.S256ChallengeOption(verifier))
+	fmt.Printf("Please open the following URL in your browser to authorize the application:\n%v\n", authURL)
+	openBrowser(authURL)
 
-	// Check if token is expired or about to expire soon
-	if time.Until(tok.Expiry) < 5*time.Minute {
-		return nil, fmt.Errorf("token expired or about to expire")
+	var res callbackResult
+	select {
+	case res = <-results:
+	case <-time.After(timeout):
+		return nil, fmt.Errorf("timed out after %s waiting for authorization", timeout)
 	}
-
-	return tok, nil
-}
-
-// saveToken saves a Token to a file path.
-func saveToken(file string, token *oauth2.Token) error {
-	fmt.Printf("Saving credential file to: %s\n", file)
-
-	if err := os.MkdirAll(filepath.Dir(file), os.ModePerm); err != nil {
-		return fmt.Errorf("Unable to create directory %v", err)
+	if res.err != nil {
+		return nil, res.err
 	}
 
-	f, err := os.OpenFile(file, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	tok, err := config.Exchange(context.Background(), res.code, oauth2.VerifierOption(verifier))
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("unable to retrieve token from web: %v", err)
 	}
-	defer f.Close()
 
-	return json.NewEncoder(f).Encode(token)
+	return tok, nil
 }
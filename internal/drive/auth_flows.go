@@ -0,0 +1,270 @@
+package drive
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// Ways of obtaining a new OAuth token.
+const (
+	// FlowAuto uses FlowBrowser when a display is available, and otherwise
+	// FlowDevice, falling back to FlowPaste if Google refuses the device
+	// flow for the client or scopes.
+	FlowAuto = "auto"
+	// FlowBrowser opens the consent page and receives the code on a local
+	// redirect listener.
+	FlowBrowser = "browser"
+	// FlowDevice shows a code to enter at google.com/device from any other
+	// device. It needs a "TVs and Limited Input devices" OAuth client.
+	FlowDevice = "device"
+	// FlowPaste prints the consent URL and reads back the URL the browser
+	// was redirected to, for machines the browser cannot reach.
+	FlowPaste = "paste"
+)
+
+// ParseFlow validates an OAuth flow name.
+func ParseFlow(s string) (string, error) {
+	switch s {
+	case "", FlowAuto:
+		return FlowAuto, nil
+	case FlowBrowser, FlowDevice, FlowPaste:
+		return s, nil
+	}
+	return "", fmt.Errorf("unknown auth flow %q (want auto, browser, device or paste)", s)
+}
+
+// obtainToken runs the interactive flow selected by cfg.Flow.
+func obtainToken(config *oauth2.Config, cfg AuthConfig) (*oauth2.Token, error) {
+	switch cfg.Flow {
+	case FlowBrowser:
+		return getTokenFromWeb(config, cfg.RedirectPort, cfg.Timeout)
+	case FlowDevice:
+		return tokenFromDevice(config)
+	case FlowPaste:
+		return tokenFromPaste(config, cfg.RedirectPort, cfg.Timeout)
+	}
+	if hasDisplay() {
+		return getTokenFromWeb(config, cfg.RedirectPort, cfg.Timeout)
+	}
+	log.Println("No display available, using device authorization")
+	resp, err := config.DeviceAuth(context.Background())
+	var rerr *oauth2.RetrieveError
+	if errors.As(err, &rerr) {
+		// Google only allows the device flow for limited-input clients
+		// and some scopes; the request for a code fails otherwise
+		log.Printf("Device authorization not available for this client (%s), pasting the redirect URL instead", rerr.ErrorCode)
+		return tokenFromPaste(config, cfg.RedirectPort, cfg.Timeout)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to start device authorization: %w", err)
+	}
+	return pollDevice(config, resp)
+}
+
+// hasDisplay reports whether a browser can be opened on this machine.
+// Sessions over SSH are treated as headless.
+func hasDisplay() bool {
+	if os.Getenv("SSH_CONNECTION") != "" || os.Getenv("SSH_TTY") != "" {
+		return false
+	}
+	switch runtime.GOOS {
+	case "windows", "darwin":
+		return true
+	}
+	return os.Getenv("DISPLAY") != "" || os.Getenv("WAYLAND_DISPLAY") != ""
+}
+
+// openBrowser tries to open url in the default browser. Failures are
+// ignored since the URL is printed as well.
+func openBrowser(url string) {
+	if !hasDisplay() {
+		return
+	}
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	case "darwin":
+		cmd = exec.Command("open", url)
+	default:
+		cmd = exec.Command("xdg-open", url)
+	}
+	if err := cmd.Start(); err == nil {
+		go cmd.Wait()
+	}
+}
+
+// tokenFromDevice runs the OAuth device authorization flow.
+func tokenFromDevice(config *oauth2.Config) (*oauth2.Token, error) {
+	resp, err := config.DeviceAuth(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("unable to start device authorization: %w", err)
+	}
+	return pollDevice(config, resp)
+}
+
+// pollDevice shows the user code of a started device authorization and
+// waits until it is approved.
+func pollDevice(config *oauth2.Config, resp *oauth2.DeviceAuthResponse) (*oauth2.Token, error) {
+	fmt.Printf("On any device, open %s and enter the code: %s\n", resp.VerificationURI, resp.UserCode)
+	if resp.VerificationURIComplete != "" {
+		fmt.Printf("Or open: %s\n", resp.VerificationURIComplete)
+	}
+	fmt.Println("Waiting for authorization...")
+	tok, err := config.DeviceAccessToken(context.Background(), resp)
+	if err != nil {
+		return nil, fmt.Errorf("device authorization failed: %w", err)
+	}
+	return tok, nil
+}
+
+// tokenFromPaste prints the consent URL and reads back the URL the browser
+// ended up on, which fails to load since nothing listens on this machine's
+// port, but carries the authorization code.
+func tokenFromPaste(config *oauth2.Config, port int, timeout time.Duration) (*oauth2.Token, error) {
+	config.RedirectURL = loopbackRedirect(port)
+	state, err := randomState()
+	if err != nil {
+		return nil, err
+	}
+	verifier := oauth2.GenerateVerifier()
+	authURL := config.AuthCodeURL(state, oauth2.AccessTypeOffline, oauth2.S256ChallengeOption(verifier))
+	fmt.Printf("Open the following URL in a browser on any machine and authorize the application:\n%v\n\n", authURL)
+	fmt.Println("The browser is then sent to a 127.0.0.1 page that will not load.")
+	fmt.Print("Paste the full URL from its address bar here: ")
+
+	lines := make(chan string, 1)
+	errs := make(chan error, 1)
+	go func() {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			errs <- err
+			return
+		}
+		lines <- line
+	}()
+	var line string
+	select {
+	case line = <-lines:
+	case err := <-errs:
+		return nil, fmt.Errorf("unable to read redirect URL: %v", err)
+	case <-time.After(timeout):
+		fmt.Println()
+		return nil, fmt.Errorf("timed out after %s waiting for authorization", timeout)
+	}
+	code, err := codeFromRedirect(strings.TrimSpace(line), state)
+	if err != nil {
+		return nil, err
+	}
+	tok, err := config.Exchange(context.Background(), code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve token: %v", err)
+	}
+	return tok, nil
+}
+
+// codeFromRedirect extracts the authorization code from a pasted redirect
+// URL, checking its state. A bare code is accepted as well; PKCE still ties
+// it to this request.
+func codeFromRedirect(pasted, state string) (string, error) {
+	if !strings.Contains(pasted, "?") {
+		if pasted == "" {
+			return "", fmt.Errorf("no authorization code received")
+		}
+		return pasted, nil
+	}
+	u, err := url.Parse(pasted)
+	if err != nil {
+		return "", fmt.Errorf("unable to parse redirect URL: %v", err)
+	}
+	res := parseCallback(u.Query(), state)
+	return res.code, res.err
+}
+
+// loopbackRedirect is the redirect URI for port on 127.0.0.1. Google
+// accepts any port for loopback redirects of Desktop app clients.
+func loopbackRedirect(port int) string {
+	if port == 0 {
+		return "http://127.0.0.1/callback"
+	}
+	return fmt.Sprintf("http://127.0.0.1:%d/callback", port)
+}
+
+// randomState returns an unguessable OAuth state value.
+func randomState() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("unable to generate OAuth state: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// callbackResult is the outcome of an OAuth redirect.
+type callbackResult struct {
+	code string
+	err  error
+	// forged is set when the state does not match the request, so the
+	// redirect did not come from it
+	forged bool
+}
+
+// parseCallback checks the query of an OAuth redirect against state.
+func parseCallback(q url.Values, state string) callbackResult {
+	if got := q.Get("state"); got != state {
+		return callbackResult{forged: true, err: fmt.Errorf("redirect state %q does not match this request", got)}
+	}
+	if e := q.Get("error"); e != "" {
+		if e == "access_denied" {
+			return callbackResult{err: errors.New("authorization denied by the user")}
+		}
+		if desc := q.Get("error_description"); desc != "" {
+			e += ": " + desc
+		}
+		return callbackResult{err: fmt.Errorf("authorization failed: %s", e)}
+	}
+	code := q.Get("code")
+	if code == "" {
+		return callbackResult{err: errors.New("no authorization code in redirect")}
+	}
+	return callbackResult{code: code}
+}
+
+var callbackPage = template.Must(template.New("callback").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>{{.Title}}</title></head>
+<body style="font-family: sans-serif; margin: 3em">
+<h2>{{.Title}}</h2>
+<p>{{.Message}}</p>
+</body></html>
+`))
+
+// writeCallbackPage answers the browser after a redirect, with err shown if
+// authorization failed.
+func writeCallbackPage(w http.ResponseWriter, status int, err error) {
+	page := struct{ Title, Message string }{
+		"Authorization successful",
+		"You can close this window and return to the application.",
+	}
+	if err != nil {
+		page.Title = "Authorization failed"
+		page.Message = err.Error() + ". Return to the application for details."
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	callbackPage.Execute(w, page)
+}
@@ -0,0 +1,51 @@
+package drive
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestParseCallback(t *testing.T) {
+	for _, tt := range []struct {
+		query  string
+		code   string
+		err    string
+		forged bool
+	}{
+		{query: "state=s1&code=c1", code: "c1"},
+		{query: "state=other&code=c1", err: "does not match", forged: true},
+		{query: "code=c1", err: "does not match", forged: true},
+		{query: "state=s1&error=access_denied", err: "denied by the user"},
+		{query: "state=s1&error=invalid_scope&error_description=bad+scope", err: "invalid_scope: bad scope"},
+		{query: "state=s1", err: "no authorization code"},
+	} {
+		q, _ := url.ParseQuery(tt.query)
+		res := parseCallback(q, "s1")
+		if res.code != tt.code || res.forged != tt.forged {
+			t.Errorf("parseCallback(%s) = code %q forged %v, want %q %v", tt.query, res.code, res.forged, tt.code, tt.forged)
+		}
+		if (res.err == nil) != (tt.err == "") || res.err != nil && !strings.Contains(res.err.Error(), tt.err) {
+			t.Errorf("parseCallback(%s) err = %v, want %q", tt.query, res.err, tt.err)
+		}
+	}
+}
+
+func TestCodeFromRedirect(t *testing.T) {
+	for _, tt := range []struct {
+		pasted string
+		code   string
+		fail   bool
+	}{
+		{pasted: "http://127.0.0.1/callback?state=s1&code=c1", code: "c1"},
+		{pasted: "http://127.0.0.1/callback?state=s2&code=c1", fail: true},
+		{pasted: "http://127.0.0.1/callback?state=s1&error=access_denied", fail: true},
+		{pasted: "4/bare-code", code: "4/bare-code"},
+		{pasted: "", fail: true},
+	} {
+		code, err := codeFromRedirect(tt.pasted, "s1")
+		if code != tt.code || (err != nil) != tt.fail {
+			t.Errorf("codeFromRedirect(%q) = %q, %v, want %q, failure %v", tt.pasted, code, err, tt.code, tt.fail)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package drive
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+// CredentialsADC selects Application Default Credentials instead of a
+// credentials file: $GOOGLE_APPLICATION_CREDENTIALS, the gcloud user
+// credentials, or the metadata server on Google Cloud.
+const CredentialsADC = "adc"
+
+// Types of credentials files, from their "type" field. OAuth client files
+// have no type field and are keyed by "installed" or "web" instead.
+const (
+	CredentialsOAuthClient     = "oauth_client"
+	CredentialsServiceAccount  = "service_account"
+	CredentialsExternalAccount = "external_account"
+	CredentialsAuthorizedUser  = "authorized_user"
+)
+
+// CredentialsType reports what kind of credentials data holds.
+func CredentialsType(data []byte) (string, error) {
+	var probe struct {
+		Type      string          `json:"type"`
+		Installed json.RawMessage `json:"installed"`
+		Web       json.RawMessage `json:"web"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return "", fmt.Errorf("unable to parse credentials file: %v", err)
+	}
+	switch {
+	case probe.Installed != nil || probe.Web != nil:
+		return CredentialsOAuthClient, nil
+	case probe.Type == CredentialsServiceAccount, probe.Type == CredentialsExternalAccount,
+		probe.Type == CredentialsAuthorizedUser:
+		return probe.Type, nil
+	case probe.Type == "":
+		return "", fmt.Errorf("credentials file has no type and is not an OAuth client")
+	}
+	return "", fmt.Errorf("unsupported credentials type %q", probe.Type)
+}
+
+// CheckCredentials verifies that cfg names usable credentials without
+// contacting Google, and returns their type.
+func CheckCredentials(cfg AuthConfig) (string, error) {
+	cfg, err := cfg.withDefaults()
+	if err != nil {
+		return "", err
+	}
+	if cfg.CredentialsFile == CredentialsADC {
+		_, err := google.FindDefaultCredentials(context.Background(), cfg.Scopes...)
+		return CredentialsADC, err
+	}
+	data, err := os.ReadFile(cfg.CredentialsFile)
+	if err != nil {
+		return "", fmt.Errorf("unable to read credentials file: %v", err)
+	}
+	typ, err := CredentialsType(data)
+	if err != nil {
+		return "", err
+	}
+	if typ == CredentialsOAuthClient {
+		_, err = LoadOAuthConfig(cfg.CredentialsFile, cfg.Scopes...)
+		return typ, err
+	}
+	if cfg.Subject != "" && typ != CredentialsServiceAccount {
+		return typ, fmt.Errorf("subject %s can only be impersonated with a service account", cfg.Subject)
+	}
+	_, err = google.CredentialsFromJSONWithParams(context.Background(), data, credentialsParams(cfg))
+	return typ, err
+}
+
+// credentialsParams are the parameters for non-interactive credentials.
+func credentialsParams(cfg AuthConfig) google.CredentialsParams {
+	return google.CredentialsParams{
+		Scopes:  cfg.Scopes,
+		Subject: cfg.Subject,
+	}
+}
+
+// nonInteractiveClient returns a client for Application Default Credentials
+// or for a service account, external account or authorized user file.
+// These need no consent flow and refresh on their own.
+func nonInteractiveClient(ctx context.Context, cfg AuthConfig, data []byte) (*http.Client, error) {
+	var creds *google.Credentials
+	var err error
+	if cfg.CredentialsFile == CredentialsADC {
+		creds, err = google.FindDefaultCredentialsWithParams(ctx, credentialsParams(cfg))
+	} else {
+		creds, err = google.CredentialsFromJSONWithParams(ctx, data, credentialsParams(cfg))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to load credentials: %v", err)
+	}
+	return oauth2.NewClient(ctx, creds.TokenSource), nil
+}
@@ -0,0 +1,31 @@
+package drive
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCredentialsType(t *testing.T) {
+	for _, tt := range []struct {
+		data string
+		want string
+		err  string
+	}{
+		{data: `{"type":"service_account","client_email":"sa@p.iam.gserviceaccount.com"}`, want: CredentialsServiceAccount},
+		{data: `{"type":"external_account","audience":"//iam.googleapis.com/x"}`, want: CredentialsExternalAccount},
+		{data: `{"type":"authorized_user","refresh_token":"r"}`, want: CredentialsAuthorizedUser},
+		{data: `{"installed":{"client_id":"c","client_secret":"s"}}`, want: CredentialsOAuthClient},
+		{data: `{"web":{"client_id":"c","client_secret":"s"}}`, want: CredentialsOAuthClient},
+		{data: `{"type":"impersonated_service_account"}`, err: "unsupported credentials type"},
+		{data: `{"client_id":"c"}`, err: "no type"},
+		{data: `{"type":`, err: "unable to parse"},
+	} {
+		got, err := CredentialsType([]byte(tt.data))
+		if got != tt.want {
+			t.Errorf("CredentialsType(%s) = %q, want %q", tt.data, got, tt.want)
+		}
+		if (err == nil) != (tt.err == "") || err != nil && !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("CredentialsType(%s) err = %v, want %q", tt.data, err, tt.err)
+		}
+	}
+}
@@ -1,70 +1,98 @@
 package drive
 
 import (
+    "errors"
     "fmt"
     "io"
+    "net"
     "net/http"
+    "strings"
 
+    "golang.org/x/oauth2"
+    "google.golang.org/api/googleapi"
     googleDrive "google.golang.org/api/drive/v3"
 )
 
+// fileFields is the set of metadata fields requested for every file.
+// version, headRevisionId and modifiedTime are needed to detect remote changes;
+// driveId and capabilities to check what is allowed in shared drives;
+// shortcutDetails to show shortcuts as their targets.
+const fileFields = "id,name,mimeType,size,parents,version,headRevisionId,modifiedTime,md5Checksum," +
+    "driveId,capabilities(canEdit,canAddChildren,canRename,canTrash,canMoveItemWithinDrive),shortcutDetails(targetId)"
 
 // DriveService struct holds the Drive client
 type DriveService struct {
-	client *googleDrive.Service
+	client        *googleDrive.Service
+	root          string
+	rootID        string // ID of root once fetched, as "root" is an alias
+	rootDrive     string
+	sharedDrives  bool
+	sharedWithMe  bool
+	exportFormats map[string]string
 }
 
 // NewDriveService initializes a DriveService
 func NewDriveService(client *googleDrive.Service) *DriveService {
-	return &DriveService{client: client}
+	return &DriveService{client: client, root: "root", sharedDrives: true, sharedWithMe: true}
 }
 
 // UploadFile uploads a file to Drive root
 func (d *DriveService) UploadFile(filename string, file io.Reader) (*googleDrive.File, error) {
-    return d.UploadFileToFolder(filename, "root", file)
+    return d.UploadFileToFolder(filename, d.root, file)
 }
 
 // UploadFileToFolder uploads a file to the given parent folderID ("root" for MyDrive root)
 func (d *DriveService) UploadFileToFolder(filename, parentID string, file io.Reader) (*googleDrive.File, error) {
     fileMetadata := &googleDrive.File{Name: filename, Parents: []string{parentID}}
-    driveFile, err := d.client.Files.Create(fileMetadata).Media(file).Do()
+    driveFile, err := d.client.Files.Create(fileMetadata).Media(file).Fields(fileFields).SupportsAllDrives(true).Do()
     if err != nil {
-        return nil, fmt.Errorf("unable to upload file: %v", err)
+        return nil, fmt.Errorf("unable to upload file: %w", err)
     }
     return driveFile, nil
 }
 
 // DownloadFile downloads or exports a file from Google Drive depending on its type.
-// For native Google docs it chooses a sensible Office format.
+// Native Google docs are exported as chosen by ExportType.
 func (d *DriveService) DownloadFile(file *googleDrive.File) ([]byte, error) {
     var resp *http.Response
     var err error
-    switch file.MimeType {
-    case "application/vnd.google-apps.spreadsheet":
-        resp, err = d.client.Files.Export(file.Id, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet").Download()
-    case "application/vnd.google-apps.document":
-        resp, err = d.client.Files.Export(file.Id, "application/vnd.openxmlformats-officedocument.wordprocessingml.document").Download()
-    case "application/vnd.google-apps.presentation":
-        resp, err = d.client.Files.Export(file.Id, "application/vnd.openxmlformats-officedocument.presentationml.presentation").Download()
-    default:
-        resp, err = d.client.Files.Get(file.Id).Download()
+    if exportType, ok := d.ExportType(file.MimeType); ok {
+        resp, err = d.client.Files.Export(file.Id, exportType).Download()
+    } else {
+        resp, err = d.client.Files.Get(file.Id).SupportsAllDrives(true).Download()
     }
     if err != nil {
-        return nil, fmt.Errorf("unable to download file: %v", err)
+        return nil, fmt.Errorf("unable to download file: %w", err)
     }
     defer resp.Body.Close()
     data, err := io.ReadAll(resp.Body)
     if err != nil {
-        return nil, fmt.Errorf("error reading file data: %v", err)
+        return nil, fmt.Errorf("error reading file data: %w", err)
+    }
+    return data, nil
+}
+
+// DownloadRange downloads length bytes of a binary file starting at offset.
+func (d *DriveService) DownloadRange(fileID string, offset, length int64) ([]byte, error) {
+    call := d.client.Files.Get(fileID).SupportsAllDrives(true)
+    call.Header().Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+    resp, err := call.Download()
+    if err != nil {
+        return nil, fmt.Errorf("unable to download range: %w", err)
+    }
+    defer resp.Body.Close()
+    data, err := io.ReadAll(resp.Body)
+    if err != nil {
+        return nil, fmt.Errorf("error reading file data: %w", err)
     }
     return data, nil
 }
 
 // DownloadFileLegacy kept for compatibility with older callers.
 func (d *DriveService) DownloadFileLegacy(fileID string) ([]byte, error) {
-    resp, err := d.client.Files.Get(fileID).Download()
+    resp, err := d.client.Files.Get(fileID).SupportsAllDrives(true).Download()
     if err != nil {
-        return nil, fmt.Errorf("unable to download file: %v", err)
+        return nil, fmt.Errorf("unable to download file: %w", err)
     }
     defer resp.Body.Close()
     return io.ReadAll(resp.Body)
@@ -74,15 +102,15 @@ func (d *DriveService) DownloadFileLegacy(fileID string) ([]byte, error) {
 // Deprecated: use DownloadFileByID or DownloadFileLegacy; kept for backward compat
 
 func (d *DriveService) DownloadFileByID(fileID string) ([]byte, error) {
-	resp, err := d.client.Files.Get(fileID).Download()
+	resp, err := d.client.Files.Get(fileID).SupportsAllDrives(true).Download()
 	if err != nil {
-		return nil, fmt.Errorf("unable to download file: %v", err)
+		return nil, fmt.Errorf("unable to download file: %w", err)
 	}
 	defer resp.Body.Close()
 
 	data, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("error reading file data: %v", err)
+		return nil, fmt.Errorf("error reading file data: %w", err)
 	}
 
 	return data, nil
@@ -93,13 +121,14 @@ func (d *DriveService) ListFilesInFolder(folderID string) ([]*googleDrive.File,
     var files []*googleDrive.File
     pageTok := ""
     for {
-        req := d.client.Files.List().Q(fmt.Sprintf("'%s' in parents and trashed=false", folderID)).Fields("nextPageToken, files(id,name,mimeType,size,parents)").PageSize(1000)
+        req := d.client.Files.List().Q(fmt.Sprintf("'%s' in parents and trashed=false", folderID)).Fields("nextPageToken, files(" + fileFields + ")").PageSize(1000).
+            SupportsAllDrives(true).IncludeItemsFromAllDrives(true)
         if pageTok != "" {
             req = req.PageToken(pageTok)
         }
         resp, err := req.Do()
         if err != nil {
-            return nil, fmt.Errorf("failed to list files: %v", err)
+            return nil, fmt.Errorf("failed to list files: %w", err)
         }
         files = append(files, resp.Files...)
         if resp.NextPageToken == "" {
@@ -110,18 +139,19 @@ func (d *DriveService) ListFilesInFolder(folderID string) ([]*googleDrive.File,
     return files, nil
 }
 
-// ListAllFiles retrieves all non-trashed files in the drive with parents information.
+// ListAllFiles retrieves all non-trashed files in My Drive with parents
+// information. Shared drives are listed with ListDriveFiles.
 func (d *DriveService) ListAllFiles() ([]*googleDrive.File, error) {
     var files []*googleDrive.File
     pageTok := ""
     for {
-        req := d.client.Files.List().Q("trashed=false").Fields("nextPageToken, files(id,name,mimeType,size,parents)").PageSize(1000)
+        req := d.client.Files.List().Q("trashed=false").Fields("nextPageToken, files(" + fileFields + ")").PageSize(1000)
         if pageTok != "" {
             req = req.PageToken(pageTok)
         }
         resp, err := req.Do()
         if err != nil {
-            return nil, fmt.Errorf("failed to list files: %v", err)
+            return nil, fmt.Errorf("failed to list files: %w", err)
         }
         files = append(files, resp.Files...)
         if resp.NextPageToken == "" {
@@ -137,7 +167,7 @@ func (d *DriveService) ListAllFiles() ([]*googleDrive.File, error) {
 func (d *DriveService) GetQuota() (total uint64, used uint64, err error) {
     about, err := d.client.About.Get().Fields("storageQuota").Do()
     if err != nil {
-        return 0, 0, fmt.Errorf("failed to get Drive quota: %v", err)
+        return 0, 0, fmt.Errorf("failed to get Drive quota: %w", err)
     }
     if about.StorageQuota == nil {
         return 0, 0, fmt.Errorf("storageQuota not available")
@@ -146,3 +176,144 @@ func (d *DriveService) GetQuota() (total uint64, used uint64, err error) {
     used = uint64(about.StorageQuota.Usage)
     return
 }
+
+// GetFile fetches current metadata for a single file.
+func (d *DriveService) GetFile(fileID string) (*googleDrive.File, error) {
+    f, err := d.client.Files.Get(fileID).Fields(fileFields + ",trashed").SupportsAllDrives(true).Do()
+    if err != nil {
+        return nil, fmt.Errorf("failed to get file %s: %w", fileID, err)
+    }
+    return f, nil
+}
+
+// UpdateFileContent replaces the content of an existing file.
+func (d *DriveService) UpdateFileContent(fileID string, file io.Reader) (*googleDrive.File, error) {
+    driveFile, err := d.client.Files.Update(fileID, &googleDrive.File{}).Media(file).Fields(fileFields).SupportsAllDrives(true).Do()
+    if err != nil {
+        return nil, fmt.Errorf("unable to update file: %w", err)
+    }
+    return driveFile, nil
+}
+
+// MoveFile renames a file and/or moves it from oldParentID to newParentID.
+// Pass equal parent IDs to only rename.
+func (d *DriveService) MoveFile(fileID, newName, oldParentID, newParentID string) (*googleDrive.File, error) {
+    req := d.client.Files.Update(fileID, &googleDrive.File{Name: newName}).Fields(fileFields).SupportsAllDrives(true)
+    if oldParentID != newParentID {
+        req = req.AddParents(newParentID).RemoveParents(oldParentID)
+    }
+    driveFile, err := req.Do()
+    if err != nil {
+        return nil, fmt.Errorf("unable to move file: %w", err)
+    }
+    return driveFile, nil
+}
+
+// TrashFile moves a file to the Drive trash.
+func (d *DriveService) TrashFile(fileID string) error {
+    _, err := d.client.Files.Update(fileID, &googleDrive.File{Trashed: true}).SupportsAllDrives(true).Do()
+    if err != nil {
+        return fmt.Errorf("unable to trash file: %w", err)
+    }
+    return nil
+}
+
+// FindFile looks up a non-trashed file called name directly under parentID.
+// It returns nil if there is none.
+func (d *DriveService) FindFile(parentID, name string) (*googleDrive.File, error) {
+    escaped := strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(name)
+    query := fmt.Sprintf("name = '%s' and '%s' in parents and trashed = false", escaped, parentID)
+    list, err := d.client.Files.List().Q(query).Fields("files(" + fileFields + ")").PageSize(1).
+        SupportsAllDrives(true).IncludeItemsFromAllDrives(true).Do()
+    if err != nil {
+        return nil, fmt.Errorf("failed to look up %s: %w", name, err)
+    }
+    if len(list.Files) == 0 {
+        return nil, nil
+    }
+    return list.Files[0], nil
+}
+
+// GetAppProperties returns the private application properties of a file
+// and its current version.
+func (d *DriveService) GetAppProperties(fileID string) (map[string]string, int64, error) {
+    f, err := d.client.Files.Get(fileID).Fields("appProperties,version").SupportsAllDrives(true).Do()
+    if err != nil {
+        return nil, 0, fmt.Errorf("failed to get properties of %s: %w", fileID, err)
+    }
+    return f.AppProperties, f.Version, nil
+}
+
+// SetAppProperties adds or overwrites the given application properties of
+// a file, leaving other properties untouched. It returns the file's version
+// after the change, which Drive bumps for metadata edits too.
+func (d *DriveService) SetAppProperties(fileID string, props map[string]string) (int64, error) {
+    f, err := d.client.Files.Update(fileID, &googleDrive.File{AppProperties: props}).Fields("version").SupportsAllDrives(true).Do()
+    if err != nil {
+        return 0, fmt.Errorf("failed to set properties of %s: %w", fileID, err)
+    }
+    return f.Version, nil
+}
+
+// IsNetworkError reports whether err was caused by Drive being unreachable
+// rather than by the request itself being rejected. Only failures to
+// connect, resolve or answer in time and the gateway errors 502, 503 and
+// 504 count; a refused token is an auth error, not an outage.
+func IsNetworkError(err error) bool {
+    if err == nil || IsAuthError(err) {
+        return false
+    }
+    var apiErr *googleapi.Error
+    if errors.As(err, &apiErr) {
+        switch apiErr.Code {
+        case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+            return true
+        }
+        return false
+    }
+    var dnsErr *net.DNSError
+    if errors.As(err, &dnsErr) {
+        return true
+    }
+    var opErr *net.OpError
+    if errors.As(err, &opErr) && opErr.Op == "dial" {
+        return true
+    }
+    var netErr net.Error
+    return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// IsAuthError reports whether err is Google refusing the credentials, e.g.
+// a revoked or expired refresh token. Signing in again is the only fix.
+func IsAuthError(err error) bool {
+    var rerr *oauth2.RetrieveError
+    if errors.As(err, &rerr) {
+        return true
+    }
+    var apiErr *googleapi.Error
+    return errors.As(err, &apiErr) && apiErr.Code == http.StatusUnauthorized
+}
+
+// IsPermissionDenied reports whether err is Drive refusing a request for
+// lack of permission, as opposed to a 403 for exceeding a rate limit.
+func IsPermissionDenied(err error) bool {
+    var apiErr *googleapi.Error
+    if !errors.As(err, &apiErr) || apiErr.Code != 403 {
+        return false
+    }
+    for _, e := range apiErr.Errors {
+        if strings.Contains(strings.ToLower(e.Reason), "ratelimit") {
+            return false
+        }
+    }
+    return true
+}
+
+// IsNotFound reports whether err is a Drive 404 response or ErrNotFound.
+func IsNotFound(err error) bool {
+    if errors.Is(err, ErrNotFound) {
+        return true
+    }
+    var apiErr *googleapi.Error
+    return errors.As(err, &apiErr) && apiErr.Code == 404
+}
@@ -0,0 +1,58 @@
+package drive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"testing"
+
+	"golang.org/x/oauth2"
+	"google.golang.org/api/googleapi"
+)
+
+// timeoutError is a net.Error that timed out.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestIsNetworkError(t *testing.T) {
+	urlErr := func(err error) error {
+		return &url.Error{Op: "Get", URL: "https://www.googleapis.com/drive/v3/files", Err: err}
+	}
+	revoked := &oauth2.RetrieveError{ErrorCode: "invalid_grant"}
+	tests := []struct {
+		name    string
+		err     error
+		network bool
+		auth    bool
+	}{
+		{"nil", nil, false, false},
+		{"dial", urlErr(&net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}), true, false},
+		{"dns", urlErr(&net.DNSError{Name: "www.googleapis.com", IsNotFound: true}), true, false},
+		{"timeout", urlErr(timeoutError{}), true, false},
+		{"wrapped timeout", fmt.Errorf("failed to get file: %w", urlErr(timeoutError{})), true, false},
+		{"read reset", urlErr(&net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset")}), false, false},
+		{"bad gateway", &googleapi.Error{Code: 502}, true, false},
+		{"unavailable", &googleapi.Error{Code: 503}, true, false},
+		{"gateway timeout", fmt.Errorf("unable to upload file: %w", &googleapi.Error{Code: 504}), true, false},
+		{"internal error", &googleapi.Error{Code: 500}, false, false},
+		{"not found", &googleapi.Error{Code: 404}, false, false},
+		{"unauthorized", &googleapi.Error{Code: 401}, false, true},
+		{"revoked token", urlErr(revoked), false, true},
+		{"revoked token rewrapped", fmt.Errorf("sign in again: %w", urlErr(revoked)), false, true},
+		{"other url error", urlErr(errors.New("unsupported protocol scheme")), false, false},
+		{"canceled", context.Canceled, false, false},
+	}
+	for _, tt := range tests {
+		if got := IsNetworkError(tt.err); got != tt.network {
+			t.Errorf("%s: IsNetworkError = %v, want %v", tt.name, got, tt.network)
+		}
+		if got := IsAuthError(tt.err); got != tt.auth {
+			t.Errorf("%s: IsAuthError = %v, want %v", tt.name, got, tt.auth)
+		}
+	}
+}
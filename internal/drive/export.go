@@ -0,0 +1,62 @@
+package drive
+
+import "strings"
+
+// defaultExportFormats are the formats native Google files are downloaded
+// as unless SetExportFormats says otherwise.
+var defaultExportFormats = map[string]string{
+	"application/vnd.google-apps.document":     "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	"application/vnd.google-apps.spreadsheet":  "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	"application/vnd.google-apps.presentation": "application/vnd.openxmlformats-officedocument.presentationml.presentation",
+	"application/vnd.google-apps.drawing":      "image/png",
+}
+
+// exportExtensions are file name extensions of the formats Drive exports to.
+var exportExtensions = map[string]string{
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document":   ".docx",
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet":         ".xlsx",
+	"application/vnd.openxmlformats-officedocument.presentationml.presentation": ".pptx",
+	"application/vnd.oasis.opendocument.text":                                   ".odt",
+	"application/vnd.oasis.opendocument.spreadsheet":                            ".ods",
+	"application/vnd.oasis.opendocument.presentation":                           ".odp",
+	"application/pdf":           ".pdf",
+	"application/rtf":           ".rtf",
+	"application/epub+zip":      ".epub",
+	"application/zip":           ".zip",
+	"text/plain":                ".txt",
+	"text/csv":                  ".csv",
+	"text/tab-separated-values": ".tsv",
+	"text/html":                 ".html",
+	"text/markdown":             ".md",
+	"image/png":                 ".png",
+	"image/jpeg":                ".jpg",
+	"image/svg+xml":             ".svg",
+}
+
+// SetExportFormats overrides the export format of native Google files,
+// keyed by their MIME type.
+func (d *DriveService) SetExportFormats(formats map[string]string) {
+	d.exportFormats = formats
+}
+
+// ExportType returns the MIME type a native Google file of type mimeType is
+// exported as, and false if files of that type are downloaded as they are.
+func (d *DriveService) ExportType(mimeType string) (string, bool) {
+	if t, ok := d.exportFormats[mimeType]; ok {
+		return t, true
+	}
+	t, ok := defaultExportFormats[mimeType]
+	return t, ok
+}
+
+// ExportExtension returns the file name extension for an export MIME type,
+// or "" if it is not known.
+func ExportExtension(exportType string) string {
+	return exportExtensions[exportType]
+}
+
+// IsGoogleFormat reports whether mimeType is a native Google file that has
+// no content of its own and can only be exported.
+func IsGoogleFormat(mimeType string) bool {
+	return strings.HasPrefix(mimeType, "application/vnd.google-apps.") && mimeType != FolderMimeType
+}
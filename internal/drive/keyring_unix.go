@@ -0,0 +1,83 @@
+//go:build !windows
+
+package drive
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// The keyring is reached through the security tool on macOS and through
+// secret-tool (libsecret) for the Secret Service elsewhere, so that no cgo
+// or D-Bus client is needed.
+
+func keyringGet(service, account string) ([]byte, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "darwin" {
+		cmd = exec.Command("security", "find-generic-password", "-s", service, "-a", account, "-w")
+	} else {
+		cmd = exec.Command("secret-tool", "lookup", "service", service, "account", account)
+	}
+	out, err := keyringRun(cmd, nil)
+	if err != nil {
+		return nil, err
+	}
+	out = bytes.TrimSuffix(out, []byte("\n"))
+	if len(out) == 0 {
+		return nil, errKeyringNotFound
+	}
+	return out, nil
+}
+
+func keyringSet(service, account string, secret []byte) error {
+	if runtime.GOOS == "darwin" {
+		// interactive mode keeps the secret off the command line
+		script := fmt.Sprintf("add-generic-password -U -s %q -a %q -X %s\n", service, account, hex.EncodeToString(secret))
+		_, err := keyringRun(exec.Command("security", "-i"), []byte(script))
+		return err
+	}
+	cmd := exec.Command("secret-tool", "store", "--label=gdrivefs token ("+account+")", "service", service, "account", account)
+	_, err := keyringRun(cmd, secret)
+	return err
+}
+
+func keyringDelete(service, account string) error {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "darwin" {
+		cmd = exec.Command("security", "delete-generic-password", "-s", service, "-a", account)
+	} else {
+		cmd = exec.Command("secret-tool", "clear", "service", service, "account", account)
+	}
+	_, err := keyringRun(cmd, nil)
+	return err
+}
+
+// keyringRun runs a keyring tool with stdin, mapping its "not found" exit
+// codes to errKeyringNotFound.
+func keyringRun(cmd *exec.Cmd, stdin []byte) ([]byte, error) {
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	var exit *exec.ExitError
+	if errors.As(err, &exit) {
+		// security exits with 44 for missing items; secret-tool exits
+		// with 1 and prints nothing
+		if (runtime.GOOS == "darwin" && exit.ExitCode() == 44) ||
+			(runtime.GOOS != "darwin" && exit.ExitCode() == 1 && stderr.Len() == 0) {
+			return nil, errKeyringNotFound
+		}
+		return nil, fmt.Errorf("%s: %v: %s", cmd.Path, err, strings.TrimSpace(stderr.String()))
+	}
+	if errors.Is(err, exec.ErrNotFound) {
+		return nil, fmt.Errorf("no keyring tool available: %v", err)
+	}
+	return out, err
+}
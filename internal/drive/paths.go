@@ -0,0 +1,152 @@
+package drive
+
+import (
+	"errors"
+	"fmt"
+	p "path"
+	"strings"
+
+	googleDrive "google.golang.org/api/drive/v3"
+)
+
+// FolderMimeType is the MIME type Drive gives folders.
+const FolderMimeType = "application/vnd.google-apps.folder"
+
+// ErrNotFound is returned when a path does not exist on Drive.
+var ErrNotFound = errors.New("no such file or folder")
+
+// IsFolder reports whether f is a folder.
+func IsFolder(f *googleDrive.File) bool {
+	return f.MimeType == FolderMimeType
+}
+
+// SetRoot makes the folder folderID the root that paths are resolved
+// against, instead of My Drive.
+func (d *DriveService) SetRoot(folderID string) {
+	d.root = folderID
+	d.rootID = ""
+}
+
+// Root returns the ID of the root folder; "root" stands for My Drive.
+func (d *DriveService) Root() string {
+	return d.root
+}
+
+// PathMatch is a file found by Glob together with its path.
+type PathMatch struct {
+	Path string
+	File *googleDrive.File
+}
+
+// splitPath returns the names along a slash-separated path from the root.
+func splitPath(path string) []string {
+	path = strings.Trim(p.Clean("/"+path), "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+// Resolve returns the file at a slash-separated path below the root folder.
+// The empty path and "/" are the root folder itself.
+func (d *DriveService) Resolve(path string) (*googleDrive.File, error) {
+	cur, err := d.rootFolder()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range splitPath(path) {
+		if !IsFolder(cur) {
+			return nil, fmt.Errorf("%s: %w", path, ErrNotFound)
+		}
+		next, err := d.findChild(cur, name)
+		if err != nil {
+			return nil, err
+		}
+		if next == nil {
+			return nil, fmt.Errorf("%s: %w", path, ErrNotFound)
+		}
+		cur = next
+	}
+	return cur, nil
+}
+
+// Glob returns the files matching a slash-separated pattern, using
+// path.Match syntax in each name. Folders are only listed where the
+// pattern has wildcards.
+func (d *DriveService) Glob(pattern string) ([]PathMatch, error) {
+	root, err := d.rootFolder()
+	if err != nil {
+		return nil, err
+	}
+	matches := []PathMatch{{Path: "", File: root}}
+	for _, name := range splitPath(pattern) {
+		var next []PathMatch
+		for _, m := range matches {
+			if !IsFolder(m.File) {
+				continue
+			}
+			if !strings.ContainsAny(name, `*?[\`) {
+				f, err := d.findChild(m.File, name)
+				if err != nil {
+					return nil, err
+				}
+				if f != nil {
+					next = append(next, PathMatch{Path: p.Join(m.Path, f.Name), File: f})
+				}
+				continue
+			}
+			children, err := d.ListChildren(m.File)
+			if err != nil {
+				return nil, err
+			}
+			for _, f := range children {
+				ok, err := p.Match(name, f.Name)
+				if err != nil {
+					return nil, fmt.Errorf("bad pattern %q: %w", pattern, err)
+				}
+				if ok {
+					next = append(next, PathMatch{Path: p.Join(m.Path, f.Name), File: f})
+				}
+			}
+		}
+		matches = next
+	}
+	return matches, nil
+}
+
+// CreateFolder creates a folder called name in parentID.
+func (d *DriveService) CreateFolder(name, parentID string) (*googleDrive.File, error) {
+	folder := &googleDrive.File{Name: name, MimeType: FolderMimeType, Parents: []string{parentID}}
+	f, err := d.client.Files.Create(folder).Fields(fileFields).SupportsAllDrives(true).Do()
+	if err != nil {
+		return nil, fmt.Errorf("unable to create folder: %w", err)
+	}
+	return f, nil
+}
+
+// MkdirAll returns the folder at path, creating it and any missing parents.
+func (d *DriveService) MkdirAll(path string) (*googleDrive.File, error) {
+	cur, err := d.rootFolder()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range splitPath(path) {
+		next, err := d.findChild(cur, name)
+		if err != nil {
+			return nil, err
+		}
+		if next == nil && (cur.Id == SharedDrivesID || cur.Id == SharedWithMeID) {
+			return nil, fmt.Errorf("%s: nothing can be created in %s", name, cur.Name)
+		}
+		if next == nil {
+			next, err = d.CreateFolder(name, cur.Id)
+			if err != nil {
+				return nil, err
+			}
+		} else if !IsFolder(next) {
+			return nil, fmt.Errorf("%s is not a folder", name)
+		}
+		cur = next
+	}
+	return cur, nil
+}
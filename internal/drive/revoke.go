@@ -0,0 +1,59 @@
+package drive
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/oauth2"
+)
+
+// revokeURL is Google's OAuth token revocation endpoint.
+var revokeURL = "https://oauth2.googleapis.com/revoke"
+
+// RevokeToken invalidates tok at Google. The refresh token is revoked when
+// present, which also revokes the access tokens issued from it and the
+// consent itself. A token Google no longer knows counts as revoked.
+func RevokeToken(ctx context.Context, tok *oauth2.Token) error {
+	value := tok.RefreshToken
+	if value == "" {
+		value = tok.AccessToken
+	}
+	if value == "" {
+		return errors.New("token is empty")
+	}
+	form := url.Values{"token": {value}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, revokeURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("unable to revoke token: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	var e struct {
+		Error       string `json:"error"`
+		Description string `json:"error_description"`
+	}
+	json.Unmarshal(body, &e)
+	if e.Error == "invalid_token" {
+		log.Printf("Token was already revoked or expired")
+		return nil
+	}
+	if e.Error != "" {
+		return fmt.Errorf("unable to revoke token: %s: %s", e.Error, e.Description)
+	}
+	return fmt.Errorf("unable to revoke token: %s", resp.Status)
+}
@@ -0,0 +1,55 @@
+package drive
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+func TestRevokeToken(t *testing.T) {
+	var status int
+	var body, revoked string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		revoked = r.FormValue("token")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		io.WriteString(w, body)
+	}))
+	defer srv.Close()
+	defer func(url string) { revokeURL = url }(revokeURL)
+	revokeURL = srv.URL
+
+	for _, tt := range []struct {
+		status int
+		body   string
+		err    string
+	}{
+		{status: http.StatusOK},
+		// a token Google no longer knows is as good as revoked
+		{status: http.StatusBadRequest, body: `{"error":"invalid_token","error_description":"Token expired or revoked"}`},
+		{status: http.StatusBadRequest, body: `{"error":"invalid_request","error_description":"Bad token"}`, err: "invalid_request: Bad token"},
+		{status: http.StatusServiceUnavailable, body: "down", err: "503"},
+	} {
+		status, body, revoked = tt.status, tt.body, ""
+		err := RevokeToken(context.Background(), &oauth2.Token{AccessToken: "access", RefreshToken: "refresh"})
+		if (err == nil) != (tt.err == "") || err != nil && !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("status %d %s: err = %v, want %q", tt.status, tt.body, err, tt.err)
+		}
+		if revoked != "refresh" {
+			t.Errorf("status %d: revoked %q, want the refresh token", tt.status, revoked)
+		}
+	}
+
+	status, body = http.StatusOK, ""
+	if err := RevokeToken(context.Background(), &oauth2.Token{AccessToken: "access"}); err != nil || revoked != "access" {
+		t.Errorf("access token only: revoked %q, err %v", revoked, err)
+	}
+	if err := RevokeToken(context.Background(), &oauth2.Token{}); err == nil {
+		t.Error("empty token revoked")
+	}
+}
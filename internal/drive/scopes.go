@@ -0,0 +1,62 @@
+package drive
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"google.golang.org/api/drive/v3"
+)
+
+// scopeNames maps the short names of the Drive OAuth scopes to their URLs.
+var scopeNames = map[string]string{
+	"drive":                   drive.DriveScope,
+	"drive.readonly":          drive.DriveReadonlyScope,
+	"drive.file":              drive.DriveFileScope,
+	"drive.metadata.readonly": drive.DriveMetadataReadonlyScope,
+}
+
+// ParseScopes turns short scope names ("drive.readonly") or scope URLs into
+// scope URLs. No scopes select full access to Drive.
+func ParseScopes(names []string) ([]string, error) {
+	if len(names) == 0 {
+		return []string{drive.DriveScope}, nil
+	}
+	scopes := make([]string, 0, len(names))
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if url, ok := scopeNames[name]; ok {
+			scopes = append(scopes, url)
+			continue
+		}
+		if strings.HasPrefix(name, "https://www.googleapis.com/auth/") {
+			scopes = append(scopes, name)
+			continue
+		}
+		known := make([]string, 0, len(scopeNames))
+		for short := range scopeNames {
+			known = append(known, short)
+		}
+		sort.Strings(known)
+		return nil, fmt.Errorf("unknown scope %q (want %s or a scope URL)", name, strings.Join(known, ", "))
+	}
+	return scopes, nil
+}
+
+// readOnlyScopes are the Drive scopes that grant no write access.
+var readOnlyScopes = map[string]bool{
+	drive.DriveReadonlyScope:         true,
+	drive.DriveMetadataReadonlyScope: true,
+	drive.DrivePhotosReadonlyScope:   true,
+}
+
+// ReadOnlyScopes reports whether scopes grant no write access to Drive.
+// Scopes not known to be read-only, like drive.appdata, count as writable.
+func ReadOnlyScopes(scopes []string) bool {
+	for _, scope := range scopes {
+		if !readOnlyScopes[scope] {
+			return false
+		}
+	}
+	return true
+}
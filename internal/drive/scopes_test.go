@@ -0,0 +1,49 @@
+package drive
+
+import (
+	"reflect"
+	"testing"
+
+	"google.golang.org/api/drive/v3"
+)
+
+func TestParseScopes(t *testing.T) {
+	for _, tt := range []struct {
+		names []string
+		want  []string
+	}{
+		{nil, []string{drive.DriveScope}},
+		{[]string{"drive.readonly"}, []string{drive.DriveReadonlyScope}},
+		{[]string{" drive.file ", "drive.metadata.readonly"}, []string{drive.DriveFileScope, drive.DriveMetadataReadonlyScope}},
+		{[]string{"https://www.googleapis.com/auth/drive.appdata"}, []string{"https://www.googleapis.com/auth/drive.appdata"}},
+	} {
+		got, err := ParseScopes(tt.names)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseScopes(%q) = %q, %v, want %q", tt.names, got, err, tt.want)
+		}
+	}
+	for _, names := range [][]string{{"drive.write"}, {"drive", "https://example.com/auth/drive"}} {
+		if _, err := ParseScopes(names); err == nil {
+			t.Errorf("ParseScopes(%q) accepted an unknown scope", names)
+		}
+	}
+}
+
+func TestReadOnlyScopes(t *testing.T) {
+	for _, tt := range []struct {
+		scopes []string
+		want   bool
+	}{
+		{[]string{drive.DriveReadonlyScope}, true},
+		{[]string{drive.DriveReadonlyScope, drive.DriveMetadataReadonlyScope}, true},
+		{[]string{drive.DriveScope}, false},
+		{[]string{drive.DriveReadonlyScope, drive.DriveFileScope}, false},
+		{[]string{drive.DrivePhotosReadonlyScope}, true},
+		{[]string{drive.DriveAppdataScope}, false},
+		{[]string{drive.DriveReadonlyScope, "https://www.googleapis.com/auth/drive.future"}, false},
+	} {
+		if got := ReadOnlyScopes(tt.scopes); got != tt.want {
+			t.Errorf("ReadOnlyScopes(%q) = %v, want %v", tt.scopes, got, tt.want)
+		}
+	}
+}
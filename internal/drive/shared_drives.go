@@ -0,0 +1,203 @@
+package drive
+
+import (
+	"fmt"
+	"strings"
+
+	googleDrive "google.golang.org/api/drive/v3"
+)
+
+// SharedDrivesDir is the virtual folder at the top of My Drive that holds
+// one folder per shared drive.
+const SharedDrivesDir = "SharedDrives"
+
+// SharedDrivesID is the ID of the SharedDrivesDir folder. It is not a
+// Drive ID, so nothing can be created in it.
+const SharedDrivesID = "gdrivefs:shared-drives"
+
+// SetSharedDrives sets whether SharedDrivesDir is shown at the top of My
+// Drive. It is by default.
+func (d *DriveService) SetSharedDrives(enabled bool) {
+	d.sharedDrives = enabled
+}
+
+// SharedDrives reports whether shared drives are shown under
+// SharedDrivesDir, which is only the case when the root is My Drive.
+func (d *DriveService) SharedDrives() bool {
+	return d.sharedDrives && d.root == "root"
+}
+
+// SetRootFolder makes folder the root that paths are resolved against, like
+// SetRoot, remembering the shared drive it is in.
+func (d *DriveService) SetRootFolder(folder *googleDrive.File) {
+	d.root = folder.Id
+	d.rootID = ""
+	d.rootDrive = folder.DriveId
+}
+
+// RootDrive returns the ID of the shared drive holding the root folder, or
+// "" if it is in My Drive.
+func (d *DriveService) RootDrive() string {
+	return d.rootDrive
+}
+
+// ListSharedDrives returns the shared drives the user is a member of, as
+// folders named after them. Names are made unique and free of slashes so
+// that they can serve as paths.
+func (d *DriveService) ListSharedDrives() ([]*googleDrive.File, error) {
+	var folders []*googleDrive.File
+	seen := map[string]bool{}
+	pageTok := ""
+	for {
+		req := d.client.Drives.List().PageSize(100).
+			Fields("nextPageToken, drives(id,name,capabilities(canAddChildren,canEdit))")
+		if pageTok != "" {
+			req = req.PageToken(pageTok)
+		}
+		resp, err := req.Do()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list shared drives: %w", err)
+		}
+		for _, drv := range resp.Drives {
+			folder := driveFolder(drv)
+			if seen[folder.Name] {
+				folder.Name = fmt.Sprintf("%s (%s)", folder.Name, drv.Id)
+			}
+			seen[folder.Name] = true
+			folders = append(folders, folder)
+		}
+		if resp.NextPageToken == "" {
+			break
+		}
+		pageTok = resp.NextPageToken
+	}
+	return folders, nil
+}
+
+// ListDriveFiles retrieves all non-trashed files in the shared drive driveID.
+func (d *DriveService) ListDriveFiles(driveID string) ([]*googleDrive.File, error) {
+	var files []*googleDrive.File
+	pageTok := ""
+	for {
+		req := d.client.Files.List().Q("trashed=false").Fields("nextPageToken, files(" + fileFields + ")").PageSize(1000).
+			Corpora("drive").DriveId(driveID).SupportsAllDrives(true).IncludeItemsFromAllDrives(true)
+		if pageTok != "" {
+			req = req.PageToken(pageTok)
+		}
+		resp, err := req.Do()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list files of shared drive %s: %w", driveID, err)
+		}
+		files = append(files, resp.Files...)
+		if resp.NextPageToken == "" {
+			break
+		}
+		pageTok = resp.NextPageToken
+	}
+	return files, nil
+}
+
+// SharedDrivesFolder returns the virtual SharedDrivesDir folder.
+func SharedDrivesFolder() *googleDrive.File {
+	return &googleDrive.File{
+		Id:           SharedDrivesID,
+		Name:         SharedDrivesDir,
+		MimeType:     FolderMimeType,
+		Capabilities: &googleDrive.FileCapabilities{},
+	}
+}
+
+// driveFolder returns the top folder of a shared drive, whose ID is the
+// drive's. It can be filled but not renamed, moved or trashed.
+func driveFolder(drv *googleDrive.Drive) *googleDrive.File {
+	caps := &googleDrive.FileCapabilities{}
+	if drv.Capabilities != nil {
+		caps.CanAddChildren = drv.Capabilities.CanAddChildren
+	}
+	return &googleDrive.File{
+		Id:           drv.Id,
+		Name:         strings.ReplaceAll(drv.Name, "/", "_"),
+		MimeType:     FolderMimeType,
+		DriveId:      drv.Id,
+		Capabilities: caps,
+	}
+}
+
+// IsVirtual reports whether f is SharedDrivesDir, SharedWithMeDir or the
+// top folder of a shared drive, which the mount shows as folders but
+// cannot change.
+func IsVirtual(f *googleDrive.File) bool {
+	return f.Id == SharedDrivesID || f.Id == SharedWithMeID || (f.DriveId != "" && f.Id == f.DriveId)
+}
+
+// RootID returns the ID of the root folder, fetching it the first time:
+// "root" is only an alias for the ID My Drive's files have as parent.
+func (d *DriveService) RootID() (string, error) {
+	if d.rootID != "" {
+		return d.rootID, nil
+	}
+	root, err := d.rootFolder()
+	if err != nil {
+		return "", err
+	}
+	return root.Id, nil
+}
+
+// rootFolder fetches the root folder, remembering its ID so that its
+// children can include SharedDrivesDir and SharedWithMeDir.
+func (d *DriveService) rootFolder() (*googleDrive.File, error) {
+	root, err := d.GetFile(d.root)
+	if err != nil {
+		return nil, err
+	}
+	d.rootID = root.Id
+	return root, nil
+}
+
+// findChild is FindFile that also finds SharedDrivesDir and SharedWithMeDir
+// at the top of My Drive and the files in them.
+func (d *DriveService) findChild(parent *googleDrive.File, name string) (*googleDrive.File, error) {
+	if parent.Id == SharedDrivesID || parent.Id == SharedWithMeID {
+		children, err := d.ListChildren(parent)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range children {
+			if f.Name == name {
+				return f, nil
+			}
+		}
+		return nil, nil
+	}
+	if parent.Id == d.rootID {
+		if name == SharedDrivesDir && d.SharedDrives() {
+			return SharedDrivesFolder(), nil
+		}
+		if name == SharedWithMeDir && d.SharedWithMe() {
+			return SharedWithMeFolder(), nil
+		}
+	}
+	return d.FindFile(parent.Id, name)
+}
+
+// ListChildren lists the files in folder, which may be SharedDrivesDir or
+// SharedWithMeDir or, at the top of My Drive, include them.
+func (d *DriveService) ListChildren(folder *googleDrive.File) ([]*googleDrive.File, error) {
+	switch folder.Id {
+	case SharedDrivesID:
+		return d.ListSharedDrives()
+	case SharedWithMeID:
+		return d.ListSharedWithMe()
+	}
+	files, err := d.ListFilesInFolder(folder.Id)
+	if err != nil {
+		return nil, err
+	}
+	if folder.Id == d.rootID && d.SharedDrives() {
+		files = append(files, SharedDrivesFolder())
+	}
+	if folder.Id == d.rootID && d.SharedWithMe() {
+		files = append(files, SharedWithMeFolder())
+	}
+	return files, nil
+}
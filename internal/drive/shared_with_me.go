@@ -0,0 +1,90 @@
+package drive
+
+import (
+	"fmt"
+	"strings"
+
+	googleDrive "google.golang.org/api/drive/v3"
+)
+
+// SharedWithMeDir is the virtual folder at the top of My Drive that holds
+// the files others shared with the user.
+const SharedWithMeDir = "SharedWithMe"
+
+// SharedWithMeID is the ID of the SharedWithMeDir folder. It is not a
+// Drive ID, so nothing can be created in it.
+const SharedWithMeID = "gdrivefs:shared-with-me"
+
+// ShortcutMimeType is the MIME type Drive gives shortcuts.
+const ShortcutMimeType = "application/vnd.google-apps.shortcut"
+
+// SetSharedWithMe sets whether SharedWithMeDir is shown at the top of My
+// Drive. It is by default.
+func (d *DriveService) SetSharedWithMe(enabled bool) {
+	d.sharedWithMe = enabled
+}
+
+// SharedWithMe reports whether shared files are shown under
+// SharedWithMeDir, which is only the case when the root is My Drive.
+func (d *DriveService) SharedWithMe() bool {
+	return d.sharedWithMe && d.root == "root"
+}
+
+// ListSharedWithMe returns the non-trashed files shared with the user, as
+// in Drive's "Shared with me". Files inside shared folders are not
+// included. Names are made unique and free of slashes so that they can
+// serve as paths.
+func (d *DriveService) ListSharedWithMe() ([]*googleDrive.File, error) {
+	var files []*googleDrive.File
+	seen := map[string]bool{}
+	pageTok := ""
+	for {
+		req := d.client.Files.List().Q("sharedWithMe=true and trashed=false").Fields("nextPageToken, files(" + fileFields + ")").PageSize(1000)
+		if pageTok != "" {
+			req = req.PageToken(pageTok)
+		}
+		resp, err := req.Do()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list files shared with me: %w", err)
+		}
+		for _, f := range resp.Files {
+			f.Name = strings.ReplaceAll(f.Name, "/", "_")
+			if seen[f.Name] {
+				f.Name = fmt.Sprintf("%s (%s)", f.Name, f.Id)
+			}
+			seen[f.Name] = true
+			files = append(files, f)
+		}
+		if resp.NextPageToken == "" {
+			break
+		}
+		pageTok = resp.NextPageToken
+	}
+	return files, nil
+}
+
+// SharedWithMeFolder returns the virtual SharedWithMeDir folder.
+func SharedWithMeFolder() *googleDrive.File {
+	return &googleDrive.File{
+		Id:           SharedWithMeID,
+		Name:         SharedWithMeDir,
+		MimeType:     FolderMimeType,
+		Capabilities: &googleDrive.FileCapabilities{},
+	}
+}
+
+// CreateShortcut creates a shortcut called name to the file targetID in
+// parentID. This is how Drive adds files shared with the user to My Drive.
+func (d *DriveService) CreateShortcut(targetID, name, parentID string) (*googleDrive.File, error) {
+	shortcut := &googleDrive.File{
+		Name:            name,
+		MimeType:        ShortcutMimeType,
+		Parents:         []string{parentID},
+		ShortcutDetails: &googleDrive.FileShortcutDetails{TargetId: targetID},
+	}
+	f, err := d.client.Files.Create(shortcut).Fields(fileFields).SupportsAllDrives(true).Do()
+	if err != nil {
+		return nil, fmt.Errorf("unable to create shortcut: %w", err)
+	}
+	return f, nil
+}
@@ -0,0 +1,125 @@
+package drive
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"golang.org/x/oauth2"
+)
+
+// pbkdf2Iterations follows the OWASP recommendation for PBKDF2-HMAC-SHA256.
+const pbkdf2Iterations = 600000
+
+// encryptedToken is the on-disk form of an encrypted token: the token JSON
+// sealed with AES-256-GCM under a key derived from the passphrase.
+type encryptedToken struct {
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"`
+	Iterations int    `json:"iterations"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// isEncryptedToken reports whether data is an encrypted token file.
+func isEncryptedToken(data []byte) bool {
+	var enc encryptedToken
+	return json.Unmarshal(data, &enc) == nil && len(enc.Ciphertext) > 0
+}
+
+// hasEncryptedToken reports whether file holds an encrypted token.
+func hasEncryptedToken(file string) bool {
+	data, err := os.ReadFile(file)
+	return err == nil && isEncryptedToken(data)
+}
+
+// encryptedStore keeps the token in a passphrase-encrypted file.
+type encryptedStore struct {
+	file       string
+	passphrase string
+}
+
+func (s *encryptedStore) Load() (*oauth2.Token, error) {
+	data, err := os.ReadFile(s.file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNoToken
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open token file: %v", err)
+	}
+	if !isEncryptedToken(data) {
+		// a plaintext token is for the file store, which migrates it
+		return nil, ErrNoToken
+	}
+	var enc encryptedToken
+	if err := json.Unmarshal(data, &enc); err != nil {
+		return nil, fmt.Errorf("failed to decode token: %v", err)
+	}
+	if enc.Version != 1 || enc.KDF != "pbkdf2-sha256" {
+		return nil, fmt.Errorf("unsupported encrypted token format (version %d, %s)", enc.Version, enc.KDF)
+	}
+	gcm, err := s.cipher(enc.Salt, enc.Iterations)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := gcm.Open(nil, enc.Nonce, enc.Ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decrypt token file %s: wrong passphrase or corrupted file", s.file)
+	}
+	tok := &oauth2.Token{}
+	if err := json.Unmarshal(plain, tok); err != nil {
+		return nil, fmt.Errorf("failed to decode token: %v", err)
+	}
+	return tok, nil
+}
+
+func (s *encryptedStore) Save(tok *oauth2.Token) error {
+	plain, err := json.Marshal(tok)
+	if err != nil {
+		return err
+	}
+	enc := encryptedToken{Version: 1, KDF: "pbkdf2-sha256", Iterations: pbkdf2Iterations, Salt: make([]byte, 16)}
+	if _, err := rand.Read(enc.Salt); err != nil {
+		return err
+	}
+	gcm, err := s.cipher(enc.Salt, enc.Iterations)
+	if err != nil {
+		return err
+	}
+	enc.Nonce = make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(enc.Nonce); err != nil {
+		return err
+	}
+	enc.Ciphertext = gcm.Seal(nil, enc.Nonce, plain, nil)
+	data, err := json.MarshalIndent(enc, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeTokenFile(s.file, data)
+}
+
+func (s *encryptedStore) Delete() error {
+	return fileStore(s.file).Delete()
+}
+
+func (s *encryptedStore) String() string { return s.file + " (encrypted)" }
+
+// cipher derives the AES-GCM cipher for salt from the passphrase.
+func (s *encryptedStore) cipher(salt []byte, iterations int) (cipher.AEAD, error) {
+	key, err := pbkdf2.Key(sha256.New, s.passphrase, salt, iterations, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
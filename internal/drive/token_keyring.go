@@ -0,0 +1,55 @@
+package drive
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"golang.org/x/oauth2"
+)
+
+// keyringService names the keyring entries holding tokens.
+const keyringService = "gdrivefs"
+
+// errKeyringNotFound is returned by the keyring helpers for missing entries.
+var errKeyringNotFound = errors.New("keyring entry not found")
+
+// keyringStore keeps the token in the OS keyring under account.
+type keyringStore struct {
+	account string
+}
+
+func (s *keyringStore) Load() (*oauth2.Token, error) {
+	data, err := keyringGet(keyringService, s.account)
+	if errors.Is(err, errKeyringNotFound) {
+		return nil, ErrNoToken
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read token from keyring: %v", err)
+	}
+	tok := &oauth2.Token{}
+	if err := json.Unmarshal(data, tok); err != nil {
+		return nil, fmt.Errorf("failed to decode token: %v", err)
+	}
+	return tok, nil
+}
+
+func (s *keyringStore) Save(tok *oauth2.Token) error {
+	data, err := json.Marshal(tok)
+	if err != nil {
+		return err
+	}
+	if err := keyringSet(keyringService, s.account, data); err != nil {
+		return fmt.Errorf("unable to save token to keyring: %v", err)
+	}
+	return nil
+}
+
+func (s *keyringStore) Delete() error {
+	if err := keyringDelete(keyringService, s.account); err != nil && !errors.Is(err, errKeyringNotFound) {
+		return fmt.Errorf("unable to delete token from keyring: %v", err)
+	}
+	return nil
+}
+
+func (s *keyringStore) String() string { return "keyring entry " + s.account }
@@ -0,0 +1,61 @@
+package drive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+
+	"golang.org/x/oauth2"
+)
+
+// persistingTokenSource refreshes tokens through base and saves every new
+// access token, so that restarts start from the latest one.
+type persistingTokenSource struct {
+	base oauth2.TokenSource
+	save func(*oauth2.Token) error
+
+	mu   sync.Mutex
+	last string // access token last saved
+}
+
+// newPersistingTokenSource returns a source refreshing token with config and
+// saving refreshed tokens with save.
+func newPersistingTokenSource(config *oauth2.Config, token *oauth2.Token, save func(*oauth2.Token) error) *persistingTokenSource {
+	return &persistingTokenSource{
+		base: config.TokenSource(context.Background(), token),
+		save: save,
+		last: token.AccessToken,
+	}
+}
+
+// Token implements oauth2.TokenSource.
+func (s *persistingTokenSource) Token() (*oauth2.Token, error) {
+	tok, err := s.base.Token()
+	if err != nil {
+		if isInvalidGrant(err) {
+			return nil, fmt.Errorf("refresh token was revoked or has expired, sign in again: %w", err)
+		}
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if tok.AccessToken != s.last {
+		// the refresh response carries no refresh token, but the
+		// refresher copies the old one onto the new token
+		if err := s.save(tok); err != nil {
+			log.Printf("Unable to save refreshed token: %v", err)
+		} else {
+			s.last = tok.AccessToken
+		}
+	}
+	return tok, nil
+}
+
+// isInvalidGrant reports whether err is Google refusing the refresh token,
+// as happens when it was revoked, expired or the password changed.
+func isInvalidGrant(err error) bool {
+	var rerr *oauth2.RetrieveError
+	return errors.As(err, &rerr) && rerr.ErrorCode == "invalid_grant"
+}
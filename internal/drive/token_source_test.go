@@ -0,0 +1,79 @@
+package drive
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// testToken returns a token as Google issues it.
+func testToken(access string) *oauth2.Token {
+	return &oauth2.Token{AccessToken: access, RefreshToken: "refresh", TokenType: "Bearer", Expiry: time.Now().Add(time.Hour).Round(time.Second)}
+}
+
+// tokenSequence hands out its tokens in turn, repeating the last one.
+type tokenSequence struct {
+	tokens []*oauth2.Token
+	err    error
+}
+
+func (s *tokenSequence) Token() (*oauth2.Token, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	tok := s.tokens[0]
+	if len(s.tokens) > 1 {
+		s.tokens = s.tokens[1:]
+	}
+	return tok, nil
+}
+
+func TestPersistingTokenSource(t *testing.T) {
+	var saved []string
+	failSave := false
+	src := &persistingTokenSource{
+		base: &tokenSequence{tokens: []*oauth2.Token{testToken("a1"), testToken("a2"), testToken("a2"), testToken("a3"), testToken("a3")}},
+		save: func(tok *oauth2.Token) error {
+			if failSave {
+				return errors.New("disk full")
+			}
+			saved = append(saved, tok.AccessToken)
+			return nil
+		},
+		last: "a1",
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := src.Token(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if strings.Join(saved, ",") != "a2" {
+		t.Errorf("saved %v, want only the refreshed a2", saved)
+	}
+
+	// a failed save is retried with the next call
+	failSave = true
+	src.Token()
+	failSave = false
+	src.Token()
+	if strings.Join(saved, ",") != "a2,a3" {
+		t.Errorf("saved %v, want a3 saved after the failure", saved)
+	}
+}
+
+func TestPersistingTokenSourceRevoked(t *testing.T) {
+	src := &persistingTokenSource{
+		base: &tokenSequence{err: &oauth2.RetrieveError{ErrorCode: "invalid_grant"}},
+		save: func(*oauth2.Token) error { return nil },
+	}
+	_, err := src.Token()
+	if err == nil || !strings.Contains(err.Error(), "sign in again") {
+		t.Errorf("Token = %v, want a sign-in hint", err)
+	}
+	if !IsAuthError(err) || IsNetworkError(err) {
+		t.Errorf("revoked token not classified as an auth error: %v", err)
+	}
+}
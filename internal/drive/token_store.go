@@ -0,0 +1,198 @@
+package drive
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/oauth2"
+)
+
+// Token store backends.
+const (
+	// StoreFile keeps the token as plain JSON in the token file.
+	StoreFile = "file"
+	// StoreEncrypted keeps the token in the token file encrypted with a
+	// passphrase from $GDRIVE_TOKEN_PASSPHRASE.
+	StoreEncrypted = "encrypted"
+	// StoreKeyring keeps the token in the OS keyring: the Secret Service on
+	// Linux and BSD, the login keychain on macOS and the Credential Manager
+	// on Windows.
+	StoreKeyring = "keyring"
+)
+
+// PassphraseEnv names the environment variable holding the passphrase of
+// the encrypted token store.
+const PassphraseEnv = "GDRIVE_TOKEN_PASSPHRASE"
+
+// ErrNoToken is returned by TokenStore.Load when no token is stored.
+var ErrNoToken = errors.New("no token stored")
+
+// TokenStore keeps an OAuth token between runs.
+type TokenStore interface {
+	// Load returns the stored token, or ErrNoToken.
+	Load() (*oauth2.Token, error)
+	// Save replaces the stored token.
+	Save(*oauth2.Token) error
+	// Delete removes the stored token. Deleting a missing token is not an
+	// error.
+	Delete() error
+	// String describes where the token is kept.
+	String() string
+}
+
+// ParseStore validates a token store name.
+func ParseStore(s string) (string, error) {
+	switch s {
+	case "", StoreFile:
+		return StoreFile, nil
+	case StoreEncrypted, StoreKeyring:
+		return s, nil
+	}
+	return "", fmt.Errorf("unknown token store %q (want file, encrypted or keyring)", s)
+}
+
+// NewTokenStore returns the token store of kind for the token file. The
+// keyring entry is named after the file, so each token file has its own.
+func NewTokenStore(kind, tokenFile string) (TokenStore, error) {
+	kind, err := ParseStore(kind)
+	if err != nil {
+		return nil, err
+	}
+	switch kind {
+	case StoreEncrypted:
+		passphrase := os.Getenv(PassphraseEnv)
+		if passphrase == "" {
+			return nil, fmt.Errorf("the encrypted token store needs a passphrase in $%s", PassphraseEnv)
+		}
+		return &encryptedStore{file: tokenFile, passphrase: passphrase}, nil
+	case StoreKeyring:
+		account, err := filepath.Abs(tokenFile)
+		if err != nil {
+			return nil, err
+		}
+		return &keyringStore{account: account}, nil
+	}
+	return fileStore(tokenFile), nil
+}
+
+// MigrateToken moves a token kept in another backend for the same token
+// file into store, if store holds none. Backends that cannot be opened,
+// like the encrypted store without a passphrase, are skipped, except that
+// an encrypted token file is an error rather than a reason to sign in again
+// and overwrite it.
+func MigrateToken(store TokenStore, kind, tokenFile string) error {
+	if _, err := store.Load(); !errors.Is(err, ErrNoToken) {
+		return nil
+	}
+	for _, other := range []string{StoreFile, StoreEncrypted, StoreKeyring} {
+		if other == kind {
+			continue
+		}
+		from, err := NewTokenStore(other, tokenFile)
+		if err != nil {
+			if other == StoreEncrypted && hasEncryptedToken(tokenFile) {
+				return fmt.Errorf("token file %s is encrypted: %v", tokenFile, err)
+			}
+			continue
+		}
+		tok, err := from.Load()
+		if err != nil {
+			continue
+		}
+		if err := store.Save(tok); err != nil {
+			return fmt.Errorf("unable to migrate token from %s: %v", from, err)
+		}
+		// the file backends share the token file, which Save replaced
+		if !sameFile(from, store) {
+			if err := from.Delete(); err != nil {
+				log.Printf("Migrated token but could not delete it from %s: %v", from, err)
+			}
+		}
+		log.Printf("Migrated token from %s to %s", from, store)
+		return nil
+	}
+	return nil
+}
+
+// sameFile reports whether a and b both keep their token in the same file.
+func sameFile(a, b TokenStore) bool {
+	return tokenFileOf(a) != "" && tokenFileOf(a) == tokenFileOf(b)
+}
+
+func tokenFileOf(s TokenStore) string {
+	switch s := s.(type) {
+	case fileStore:
+		return string(s)
+	case *encryptedStore:
+		return s.file
+	}
+	return ""
+}
+
+// fileStore keeps the token as plain JSON, readable only by the user.
+type fileStore string
+
+func (f fileStore) Load() (*oauth2.Token, error) {
+	data, err := os.ReadFile(string(f))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNoToken
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open token file: %v", err)
+	}
+	if isEncryptedToken(data) {
+		// an encrypted token is for the encrypted store, which migrates it
+		return nil, ErrNoToken
+	}
+	tok := &oauth2.Token{}
+	if err := json.Unmarshal(data, tok); err != nil {
+		return nil, fmt.Errorf("failed to decode token: %v", err)
+	}
+	return tok, nil
+}
+
+func (f fileStore) Save(tok *oauth2.Token) error {
+	data, err := json.Marshal(tok)
+	if err != nil {
+		return err
+	}
+	return writeTokenFile(string(f), data)
+}
+
+func (f fileStore) Delete() error {
+	if err := os.Remove(string(f)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (f fileStore) String() string { return string(f) }
+
+// writeTokenFile atomically replaces file with data, readable only by the
+// user.
+func writeTokenFile(file string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return fmt.Errorf("Unable to create directory %v", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(file), ".token-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(0600); err != nil && !errors.Is(err, os.ErrInvalid) {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
@@ -0,0 +1,150 @@
+package drive
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// checkToken fails t unless store holds a token with access token want.
+func checkToken(t *testing.T, store TokenStore, want string) {
+	t.Helper()
+	tok, err := store.Load()
+	if err != nil {
+		t.Fatalf("Load from %s = %v", store, err)
+	}
+	if tok.AccessToken != want || tok.RefreshToken != "refresh" {
+		t.Errorf("Load from %s = %+v, want access token %s", store, tok, want)
+	}
+}
+
+func TestParseStore(t *testing.T) {
+	for in, want := range map[string]string{"": StoreFile, "file": StoreFile, "encrypted": StoreEncrypted, "keyring": StoreKeyring} {
+		if got, err := ParseStore(in); err != nil || got != want {
+			t.Errorf("ParseStore(%q) = %q, %v, want %q", in, got, err, want)
+		}
+	}
+	if _, err := ParseStore("vault"); err == nil {
+		t.Error("ParseStore accepted an unknown store")
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "tokens", "token.json")
+	store, err := NewTokenStore(StoreFile, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Load(); !errors.Is(err, ErrNoToken) {
+		t.Errorf("Load of missing token = %v, want ErrNoToken", err)
+	}
+	if err := store.Save(testToken("a1")); err != nil {
+		t.Fatal(err)
+	}
+	checkToken(t, store, "a1")
+	if info, err := os.Stat(file); err != nil || runtime.GOOS != "windows" && info.Mode().Perm() != 0600 {
+		t.Errorf("token file mode = %v, %v, want 0600", info.Mode(), err)
+	}
+	if err := store.Delete(); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete(); err != nil {
+		t.Errorf("Delete of missing token = %v", err)
+	}
+}
+
+func TestEncryptedStore(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "token.json")
+	t.Setenv(PassphraseEnv, "")
+	if _, err := NewTokenStore(StoreEncrypted, file); err == nil {
+		t.Error("encrypted store opened without a passphrase")
+	}
+
+	t.Setenv(PassphraseEnv, "correct horse")
+	store, err := NewTokenStore(StoreEncrypted, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Save(testToken("a1")); err != nil {
+		t.Fatal(err)
+	}
+	checkToken(t, store, "a1")
+	data, _ := os.ReadFile(file)
+	if strings.Contains(string(data), "a1") || strings.Contains(string(data), "refresh") {
+		t.Errorf("token stored in the clear: %s", data)
+	}
+	// an encrypted token is not the file store's
+	if _, err := fileStore(file).Load(); !errors.Is(err, ErrNoToken) {
+		t.Errorf("file store Load of encrypted token = %v, want ErrNoToken", err)
+	}
+
+	wrong := &encryptedStore{file: file, passphrase: "wrong"}
+	if _, err := wrong.Load(); err == nil || errors.Is(err, ErrNoToken) {
+		t.Errorf("Load with a wrong passphrase = %v, want a decryption error", err)
+	}
+}
+
+func TestMigrateTokenBothWays(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "token.json")
+	if err := fileStore(file).Save(testToken("a1")); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(PassphraseEnv, "correct horse")
+	encrypted, err := NewTokenStore(StoreEncrypted, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a plaintext token is not the encrypted store's
+	if _, err := encrypted.Load(); !errors.Is(err, ErrNoToken) {
+		t.Fatalf("Load of plaintext token = %v, want ErrNoToken", err)
+	}
+	if err := MigrateToken(encrypted, StoreEncrypted, file); err != nil {
+		t.Fatal(err)
+	}
+	checkToken(t, encrypted, "a1")
+	data, _ := os.ReadFile(file)
+	if !isEncryptedToken(data) {
+		t.Error("token file still in the clear after migration")
+	}
+
+	// nothing to do once the store has a token
+	if err := MigrateToken(encrypted, StoreEncrypted, file); err != nil {
+		t.Error(err)
+	}
+	checkToken(t, encrypted, "a1")
+
+	// back to the file store, decrypting with the passphrase
+	plain := fileStore(file)
+	if err := MigrateToken(plain, StoreFile, file); err != nil {
+		t.Fatal(err)
+	}
+	checkToken(t, plain, "a1")
+	data, _ = os.ReadFile(file)
+	if isEncryptedToken(data) {
+		t.Error("token file still encrypted after migrating back")
+	}
+}
+
+func TestMigrateEncryptedTokenWithoutPassphrase(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "token.json")
+	t.Setenv(PassphraseEnv, "correct horse")
+	encrypted, _ := NewTokenStore(StoreEncrypted, file)
+	if err := encrypted.Save(testToken("a1")); err != nil {
+		t.Fatal(err)
+	}
+	before, _ := os.ReadFile(file)
+
+	// without the passphrase the token cannot be moved, and must not be
+	// replaced by a new sign-in either
+	t.Setenv(PassphraseEnv, "")
+	err := MigrateToken(fileStore(file), StoreFile, file)
+	if err == nil || !strings.Contains(err.Error(), PassphraseEnv) {
+		t.Errorf("MigrateToken = %v, want an error asking for the passphrase", err)
+	}
+	if after, _ := os.ReadFile(file); string(after) != string(before) {
+		t.Error("encrypted token file changed")
+	}
+}
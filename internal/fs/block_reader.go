@@ -0,0 +1,87 @@
+package fs
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	gdrive "GDrive/internal/drive"
+	"github.com/winfsp/cgofuse/fuse"
+	googleDrive "google.golang.org/api/drive/v3"
+)
+
+// blockVersion identifies the content a file's cached blocks belong to.
+func blockVersion(file *googleDrive.File) string {
+	if file.Md5Checksum != "" {
+		return file.Md5Checksum
+	}
+	return fmt.Sprintf("v%d", file.Version)
+}
+
+// useBlocks reports whether reads of file go through the block cache.
+// Native Google files are exported whole and cannot be fetched by range.
+func (fs *GDriveFS) useBlocks(file *googleDrive.File) bool {
+	return fs.blocks != nil && file.Id != "" && !strings.HasPrefix(file.MimeType, "application/vnd.google-apps.")
+}
+
+// readBlocks serves a read from the block cache, fetching missing blocks
+// from Drive by range.
+func (fs *GDriveFS) readBlocks(file *googleDrive.File, buff []byte, offset int64) int {
+	if offset >= file.Size {
+		return 0
+	}
+	end := offset + int64(len(buff))
+	if end > file.Size {
+		end = file.Size
+	}
+	bs := fs.blocks.BlockSize()
+	n := 0
+	for pos := offset; pos < end; {
+		idx := pos / bs
+		block, errc := fs.block(file, idx)
+		if errc != 0 {
+			return errc
+		}
+		within := pos - idx*bs
+		if within >= int64(len(block)) {
+			break
+		}
+		c := copy(buff[n:end-offset], block[within:])
+		n += c
+		pos += int64(c)
+	}
+	return n
+}
+
+// block returns block idx of file from disk or Drive.
+func (fs *GDriveFS) block(file *googleDrive.File, idx int64) ([]byte, int) {
+	version := blockVersion(file)
+	data, ok, err := fs.blocks.ReadBlock(file.Id, version, idx)
+	if err != nil {
+		log.Printf("Block cache read error for %s: %v", file.Name, err)
+	}
+	if ok {
+		fs.prefetch.hit(blockKey(file, idx))
+		return data, 0
+	}
+	if fs.isOffline() {
+		return nil, -fuse.EIO
+	}
+	bs := fs.blocks.BlockSize()
+	length := bs
+	if rest := file.Size - idx*bs; rest < length {
+		length = rest
+	}
+	data, err = fs.Drive.DownloadRange(file.Id, idx*bs, length)
+	if err != nil {
+		if gdrive.IsNetworkError(err) {
+			fs.setOffline(true)
+		}
+		log.Printf("Download error for %s block %d: %v", file.Name, idx, err)
+		return nil, -fuse.EIO
+	}
+	if err := fs.blocks.WriteBlock(file.Id, version, idx, data); err != nil {
+		log.Printf("Block cache write error for %s: %v", file.Name, err)
+	}
+	return data, 0
+}
@@ -0,0 +1,83 @@
+package fs
+
+import (
+	"log"
+	"time"
+
+	"GDrive/internal/cache"
+	googleDrive "google.golang.org/api/drive/v3"
+)
+
+// Invalidation ops published after local changes reach Drive.
+const (
+	invalidateUpload = "upload"
+	invalidateRename = "rename"
+	invalidateDelete = "delete"
+)
+
+// announce tells other mounts sharing the Redis channel that file changed.
+func (fs *GDriveFS) announce(op string, file *googleDrive.File) {
+	if fs.bus == nil || file == nil || file.Id == "" {
+		return
+	}
+	inv := cache.Invalidation{Op: op, FileID: file.Id, Version: file.Version}
+	if err := fs.bus.Publish(inv); err != nil {
+		log.Printf("Failed to publish invalidation for %s: %v", file.Name, err)
+	}
+}
+
+// applyInvalidation evicts a file changed by another mount from the local
+// caches and brings its index entry up to date.
+func (fs *GDriveFS) applyInvalidation(inv cache.Invalidation) {
+	fs.invalidate(inv.FileID)
+
+	fs.mu.RLock()
+	var paths []string
+	for path, f := range fs.index {
+		if f.Id == inv.FileID {
+			paths = append(paths, path)
+		}
+	}
+	fs.mu.RUnlock()
+
+	switch {
+	case inv.Op == invalidateDelete:
+		fs.mu.Lock()
+		for _, path := range paths {
+			delete(fs.index, path)
+		}
+		fs.mu.Unlock()
+		return
+	case inv.Op == invalidateUpload && len(paths) > 0:
+		remote, err := fs.Drive.GetFile(inv.FileID)
+		if err != nil {
+			log.Printf("Failed to refresh %s after invalidation: %v", inv.FileID, err)
+			fs.scheduleRefresh()
+			return
+		}
+		fs.mu.Lock()
+		for _, path := range paths {
+			fs.index[path] = remote
+		}
+		fs.mu.Unlock()
+		return
+	}
+	// renames and files we have not seen yet need the full tree
+	fs.scheduleRefresh()
+}
+
+// scheduleRefresh rebuilds the index shortly, coalescing bursts of
+// invalidations into one listing.
+func (fs *GDriveFS) scheduleRefresh() {
+	fs.refreshMu.Lock()
+	defer fs.refreshMu.Unlock()
+	if fs.refreshTimer != nil {
+		fs.refreshTimer.Reset(2 * time.Second)
+		return
+	}
+	fs.refreshTimer = time.AfterFunc(2*time.Second, func() {
+		if err := fs.buildIndex(); err != nil {
+			log.Printf("index refresh err: %v", err)
+		}
+	})
+}
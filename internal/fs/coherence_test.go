@@ -0,0 +1,75 @@
+package fs
+
+import (
+	"testing"
+	"time"
+
+	"GDrive/internal/cache"
+
+	"github.com/alicebob/miniredis/v2"
+	googleDrive "google.golang.org/api/drive/v3"
+)
+
+// waitFor polls cond until it holds or a few seconds passed.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// indexEntry returns the index entry of path.
+func indexEntry(fs *GDriveFS, path string) (*googleDrive.File, bool) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+	f, ok := fs.index[path]
+	return f, ok
+}
+
+func TestInvalidationBetweenMounts(t *testing.T) {
+	mr := miniredis.RunT(t)
+	const channel = "gdrivefs:invalidate"
+	writer, reader := newTestFS(t), newTestFS(t)
+	fd := newFakeDrive(t, writer,
+		&googleDrive.File{Id: "f1", Name: "a.txt", Version: 1},
+		&googleDrive.File{Id: "f2", Name: "b.txt", Version: 1})
+	reader.Drive = writer.Drive
+	for _, id := range []string{"f1", "f2"} {
+		f, _ := fd.file(id)
+		reader.index[f.Name] = &f
+		reader.fileCache.Set(contentKey(&f), []byte("old"))
+	}
+
+	writer.bus = cache.NewInvalidationBus(mr.Addr(), channel)
+	reader.bus = cache.NewInvalidationBus(mr.Addr(), channel)
+	t.Cleanup(func() { close(reader.stop) })
+	go reader.bus.Subscribe(reader.stop, reader.applyInvalidation)
+	waitFor(t, "subscription", func() bool { return mr.PubSubNumSub(channel)[channel] == 1 })
+
+	// an upload through the writer refreshes the reader's entry and cache
+	old, _ := indexEntry(reader, "a.txt")
+	fd.edit("f1", "new")
+	updated, _ := fd.file("f1")
+	writer.announce(invalidateUpload, &updated)
+	waitFor(t, "upload invalidation", func() bool {
+		f, _ := indexEntry(reader, "a.txt")
+		return f.Version == updated.Version
+	})
+	if _, found, _ := reader.fileCache.Get(contentKey(old)); found {
+		t.Error("stale content kept after upload invalidation")
+	}
+
+	deleted, _ := fd.file("f2")
+	writer.announce(invalidateDelete, &deleted)
+	waitFor(t, "delete invalidation", func() bool {
+		_, ok := indexEntry(reader, "b.txt")
+		return !ok
+	})
+	if _, found, _ := reader.fileCache.Get(contentKey(&deleted)); found {
+		t.Error("content kept after delete invalidation")
+	}
+}
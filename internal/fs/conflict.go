@@ -0,0 +1,107 @@
+package fs
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	p "path"
+	"strings"
+	"time"
+
+	googleDrive "google.golang.org/api/drive/v3"
+)
+
+// ConflictPolicy decides what happens when a file changed on Drive after
+// the local copy being written was opened.
+type ConflictPolicy string
+
+const (
+	// ConflictKeepBoth uploads the local content as a "conflicted copy"
+	// next to the remote file.
+	ConflictKeepBoth ConflictPolicy = "keep-both"
+	// ConflictLocalWins overwrites the remote change.
+	ConflictLocalWins ConflictPolicy = "local-wins"
+	// ConflictRemoteWins discards the local change.
+	ConflictRemoteWins ConflictPolicy = "remote-wins"
+	// ConflictFail reports EBUSY from close and uploads nothing.
+	ConflictFail ConflictPolicy = "fail"
+)
+
+// errConflictRejected is returned when ConflictFail refuses an upload.
+var errConflictRejected = errors.New("conflicting change rejected by policy")
+
+// errConflictDiscarded is returned when ConflictRemoteWins drops an upload.
+var errConflictDiscarded = errors.New("conflicting change discarded by policy")
+
+// ParseConflictPolicy validates a policy name.
+func ParseConflictPolicy(s string) (ConflictPolicy, error) {
+	switch ConflictPolicy(s) {
+	case ConflictKeepBoth, ConflictLocalWins, ConflictRemoteWins, ConflictFail:
+		return ConflictPolicy(s), nil
+	}
+	return "", fmt.Errorf("unknown conflict policy %q (want keep-both, local-wins, remote-wins or fail)", s)
+}
+
+// remoteChanged reports whether remote is no longer the version captured in
+// base. The head revision only moves on content changes, so it is preferred
+// over the version counter, which also moves on metadata edits.
+func remoteChanged(base, remote *googleDrive.File) bool {
+	if base.HeadRevisionId != "" && remote.HeadRevisionId != "" {
+		return base.HeadRevisionId != remote.HeadRevisionId
+	}
+	return base.Version != remote.Version
+}
+
+// changedOnDrive is remoteChanged, except that version bumps from this
+// mount's own Drive lease writes do not count. Those matter for Google
+// formats, which have no head revision.
+func (fs *GDriveFS) changedOnDrive(base, remote *googleDrive.File) bool {
+	if !remoteChanged(base, remote) {
+		return false
+	}
+	if base.HeadRevisionId != "" && remote.HeadRevisionId != "" {
+		return true
+	}
+	return fs.locks == nil || !fs.locks.OwnChange(base.Id, base.Version, remote.Version)
+}
+
+// conflictCopyName returns the name used for the local side of a keep-both
+// resolution, e.g. "report (conflicted copy 2006-01-02 150405).txt".
+func conflictCopyName(name string, now time.Time) string {
+	ext := p.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	return fmt.Sprintf("%s (conflicted copy %s)%s", stem, now.Format("2006-01-02 150405"), ext)
+}
+
+// logConflict records a conflict and how it was resolved.
+func logConflict(path string, base, remote *googleDrive.File, policy ConflictPolicy) {
+	log.Printf("CONFLICT: %s changed on Drive since it was opened (base version %d rev %q, remote version %d rev %q modified %s); resolving with %s",
+		path, base.Version, base.HeadRevisionId, remote.Version, remote.HeadRevisionId, remote.ModifiedTime, policy)
+}
+
+// uploadConflicted writes the content in src for path according to the
+// conflict policy. It returns the uploaded file, or errConflictDiscarded or
+// errConflictRejected if nothing was uploaded.
+func (fs *GDriveFS) uploadConflicted(path, fileID, parentID, src string) (*googleDrive.File, error) {
+	if fs.conflictPolicy == ConflictRemoteWins {
+		return nil, errConflictDiscarded
+	}
+	if fs.conflictPolicy == ConflictFail {
+		return nil, errConflictRejected
+	}
+	content, err := os.Open(src)
+	if err != nil {
+		return nil, err
+	}
+	defer content.Close()
+	if fs.conflictPolicy == ConflictLocalWins {
+		return fs.Drive.UpdateFileContent(fileID, content)
+	}
+	copyName := conflictCopyName(p.Base(path), time.Now())
+	f, err := fs.Drive.UploadFileToFolder(copyName, parentID, content)
+	if err == nil {
+		log.Printf("Saved local version of %s as %s", path, copyName)
+	}
+	return f, err
+}
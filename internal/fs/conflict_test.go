@@ -0,0 +1,187 @@
+package fs
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/winfsp/cgofuse/fuse"
+	googleDrive "google.golang.org/api/drive/v3"
+)
+
+func TestParseConflictPolicy(t *testing.T) {
+	for _, name := range []string{"keep-both", "local-wins", "remote-wins", "fail"} {
+		if policy, err := ParseConflictPolicy(name); err != nil || string(policy) != name {
+			t.Errorf("ParseConflictPolicy(%q) = %q, %v", name, policy, err)
+		}
+	}
+	if _, err := ParseConflictPolicy("newest-wins"); err == nil {
+		t.Error("ParseConflictPolicy accepted an unknown policy")
+	}
+}
+
+func TestConflictCopyName(t *testing.T) {
+	now := time.Date(2024, 3, 5, 14, 7, 9, 0, time.UTC)
+	tests := map[string]string{
+		"report.txt":     "report (conflicted copy 2024-03-05 140709).txt",
+		"archive.tar.gz": "archive.tar (conflicted copy 2024-03-05 140709).gz",
+		"Makefile":       "Makefile (conflicted copy 2024-03-05 140709)",
+	}
+	for name, want := range tests {
+		if got := conflictCopyName(name, now); got != want {
+			t.Errorf("conflictCopyName(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestRemoteChanged(t *testing.T) {
+	tests := []struct {
+		name         string
+		base, remote googleDrive.File
+		want         bool
+	}{
+		{"same version", googleDrive.File{Version: 3}, googleDrive.File{Version: 3}, false},
+		{"new version", googleDrive.File{Version: 3}, googleDrive.File{Version: 4}, true},
+		{"metadata edit", googleDrive.File{Version: 3, HeadRevisionId: "r1"}, googleDrive.File{Version: 4, HeadRevisionId: "r1"}, false},
+		{"new revision", googleDrive.File{Version: 3, HeadRevisionId: "r1"}, googleDrive.File{Version: 4, HeadRevisionId: "r2"}, true},
+	}
+	for _, tt := range tests {
+		if got := remoteChanged(&tt.base, &tt.remote); got != tt.want {
+			t.Errorf("%s: remoteChanged = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestUploadConflictPolicies(t *testing.T) {
+	tests := []struct {
+		policy      ConflictPolicy
+		baseVersion int64
+		wantErr     error
+		wantRemote  string // content of the original file afterwards
+		wantCopy    bool   // whether a conflicted copy was uploaded
+	}{
+		{ConflictKeepBoth, 3, nil, "remote", true},
+		{ConflictLocalWins, 3, nil, "local", false},
+		{ConflictRemoteWins, 3, errConflictDiscarded, "remote", false},
+		{ConflictFail, 3, errConflictRejected, "remote", false},
+		// without a remote change every policy updates in place
+		{ConflictRemoteWins, 4, nil, "local", false},
+		{ConflictFail, 4, nil, "local", false},
+	}
+	for _, tt := range tests {
+		fs := newTestFS(t)
+		fs.conflictPolicy = tt.policy
+		fd := newFakeDrive(t, fs, &googleDrive.File{Id: "f1", Name: "a.txt", Version: 3})
+		fd.edit("f1", "remote")
+
+		uploaded, err := fs.upload("a.txt", &googleDrive.File{Id: "f1", Version: tt.baseVersion}, writeTemp(t, "local"))
+		if err != tt.wantErr {
+			t.Errorf("%s, base %d: upload error = %v, want %v", tt.policy, tt.baseVersion, err, tt.wantErr)
+		}
+		if (err == nil) != (uploaded != nil) {
+			t.Errorf("%s, base %d: upload = %v, %v", tt.policy, tt.baseVersion, uploaded, err)
+		}
+		if _, content := fd.file("f1"); content != tt.wantRemote {
+			t.Errorf("%s, base %d: remote content = %q, want %q", tt.policy, tt.baseVersion, content, tt.wantRemote)
+		}
+		var copied bool
+		fd.mu.Lock()
+		for _, f := range fd.files {
+			copied = copied || strings.HasPrefix(f.Name, "a (conflicted copy ")
+		}
+		fd.mu.Unlock()
+		if copied != tt.wantCopy {
+			t.Errorf("%s, base %d: conflicted copy uploaded = %v, want %v", tt.policy, tt.baseVersion, copied, tt.wantCopy)
+		}
+	}
+}
+
+// writeConflicting opens path for writing, has Drive change it meanwhile and
+// writes local content. It returns the open handle.
+func writeConflicting(t *testing.T, fs *GDriveFS, fd *fakeDrive, path, local string) uint64 {
+	t.Helper()
+	errc, fh := fs.Open(path, fuse.O_WRONLY|fuse.O_TRUNC)
+	if errc != 0 {
+		t.Fatalf("Open = %d", errc)
+	}
+	fd.edit("f1", "remote change")
+	if n := fs.Write(path, []byte(local), 0, fh); n != len(local) {
+		t.Fatalf("Write = %d", n)
+	}
+	return fh
+}
+
+// newConflictFS returns a filesystem with the policy whose Drive holds
+// a.txt as file f1.
+func newConflictFS(t *testing.T, policy ConflictPolicy) (*GDriveFS, *fakeDrive) {
+	t.Helper()
+	fs := newTestFS(t)
+	fs.conflictPolicy = policy
+	fd := newFakeDrive(t, fs, &googleDrive.File{Id: "f1", Name: "a.txt", Parents: []string{"root"}})
+	fd.edit("f1", "remote")
+	if err := fs.buildIndex(); err != nil {
+		t.Fatal(err)
+	}
+	return fs, fd
+}
+
+func TestFailPolicyReportedByFlush(t *testing.T) {
+	fs, fd := newConflictFS(t, ConflictFail)
+	fh := writeConflicting(t, fs, fd, "/a.txt", "local")
+
+	if errc := fs.Flush("/a.txt", fh); errc != -fuse.EBUSY {
+		t.Errorf("Flush = %d, want EBUSY", errc)
+	}
+	if errc := fs.Release("/a.txt", fh); errc != 0 {
+		t.Errorf("Release = %d, want 0", errc)
+	}
+	if _, content := fd.file("f1"); content != "remote change" {
+		t.Errorf("remote content = %q, want it untouched", content)
+	}
+	kept, _ := filepath.Glob(filepath.Join(fs.stateDir, "conflicts", "a (conflicted copy *).txt"))
+	if len(kept) != 1 || readFile(kept[0]) != "local" {
+		t.Errorf("rejected local version kept as %v", kept)
+	}
+}
+
+func TestRemoteWinsDiscardsOnRelease(t *testing.T) {
+	fs, fd := newConflictFS(t, ConflictRemoteWins)
+	fh := writeConflicting(t, fs, fd, "/a.txt", "a much longer local version")
+
+	if errc := fs.Flush("/a.txt", fh); errc != 0 {
+		t.Errorf("Flush = %d, want 0", errc)
+	}
+	if errc := fs.Release("/a.txt", fh); errc != 0 {
+		t.Errorf("Release = %d, want 0", errc)
+	}
+	if _, content := fd.file("f1"); content != "remote change" {
+		t.Errorf("remote content = %q, want it untouched", content)
+	}
+	var stat fuse.Stat_t
+	if errc := fs.Getattr("/a.txt", &stat, ^uint64(0)); errc != 0 || stat.Size != int64(len("remote change")) {
+		t.Errorf("Getattr after discard = %d, size %d, want the remote size", errc, stat.Size)
+	}
+}
+
+func TestReplayDiscardedByRemoteWins(t *testing.T) {
+	fs := newTestFS(t)
+	fs.conflictPolicy = ConflictRemoteWins
+	fd := newFakeDrive(t, fs, &googleDrive.File{Id: "f1", Name: "a.txt", Version: 5})
+	fs.queue.add(&queuedOp{Kind: opUpload, Path: "a.txt", FileID: "f1", BaseVersion: 3}, writeTemp(t, "local"))
+	spool := fs.queue.Ops[0].Spool
+
+	if err := fs.replayQueue(); err != nil {
+		t.Fatalf("replayQueue = %v", err)
+	}
+	if fs.queue.pending() != 0 || len(fs.queue.Conflicts) != 0 {
+		t.Errorf("after replay: %d ops, %d conflicts, want none", fs.queue.pending(), len(fs.queue.Conflicts))
+	}
+	if f, _ := fd.file("f1"); f.Version != 5 {
+		t.Errorf("remote version = %d, want 5 untouched", f.Version)
+	}
+	if _, err := os.Stat(spool); !os.IsNotExist(err) {
+		t.Errorf("spool of a discarded upload was kept: %v", err)
+	}
+}
@@ -2,6 +2,7 @@ package fs
 
 import (
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/exec"
@@ -12,6 +13,9 @@ import (
 	"time"
 
 	"github.com/winfsp/cgofuse/fuse"
+	"GDrive/internal/cache"
+	"GDrive/internal/control"
+	"GDrive/internal/lock"
 	gdrive "GDrive/internal/drive"
 	googleDrive "google.golang.org/api/drive/v3"
 	"sync"
@@ -26,46 +30,150 @@ type GDriveFS struct {
 	lastQuota  time.Time
 	mu         sync.RWMutex
 	index      map[string]*googleDrive.File
-	fileCache  map[string][]byte
+	fileCache  *cache.MemoryCache
+	readKeys   map[uint64]string
+	readData   map[uint64][]byte // content loaded by read handles
 	handles    map[uint64]*os.File
 	tempNames  map[uint64]string
+	bases      map[uint64]*googleDrive.File
+	leases     map[uint64]string
 	handleCtr  uint64
+	offline    bool
+	stateDir   string
+	queue      *opQueue
+	stop       chan struct{}
+	stopOnce   sync.Once
+	ready      chan struct{}
+	conflictPolicy ConflictPolicy
+	l2         cache.Cache
+	blocks     *cache.BlockCache
+	negative   *lookupFilter
+	prefetch   *prefetcher
+	control    *control.Server
+	host       *fuse.FileSystemHost
+	mountPoint string
+	bus        *cache.InvalidationBus
+	refreshMu    sync.Mutex
+	refreshTimer *time.Timer
+	locks      *lock.Manager
+	exclusiveCreate bool
+	readOnly   bool
+	uid, gid   uint32 // owner shown for every file
 }
 
-// Read handles file reading (read-only)
+// Read handles file reading; handles open for writing read their temp file
 func (fs *GDriveFS) Read(path string, buff []byte, offset int64, fh uint64) int {
-    cleaned := strings.TrimPrefix(path, "/")
     fs.mu.RLock()
-    data, ok := fs.fileCache[cleaned]
+    f, writable := fs.handles[fh]
     fs.mu.RUnlock()
-    if !ok {
-        fs.mu.RLock()
-        file, ok2 := fs.index[cleaned]
-        fs.mu.RUnlock()
-        if !ok2 {
-            return -fuse.ENOENT
-        }
-
-        content, err := fs.Drive.DownloadFile(file)
-        if err != nil {
-            log.Printf("Download error for %s: %v", cleaned, err)
+    if writable {
+        n, err := f.ReadAt(buff, offset)
+        if err != nil && err != io.EOF {
+            log.Printf("read error: %v", err)
             return -fuse.EIO
         }
-        data = content
-        fs.mu.Lock()
-        fs.fileCache[cleaned] = data
-        fs.mu.Unlock()
+        return n
+    }
+    cleaned := strings.TrimPrefix(path, "/")
+    fs.mu.RLock()
+    file, ok := fs.index[cleaned]
+    fs.mu.RUnlock()
+    if ok && fs.useBlocks(file) && fs.queue.pendingContent(cleaned) == "" {
+        n := fs.readBlocks(file, buff, offset)
+        if n > 0 {
+            fs.prefetch.observe(cleaned, file, offset, n)
+        }
+        return n
+    }
+    data, errc := fs.handleContent(cleaned, fh)
+    if errc != 0 {
+        return errc
     }
     if offset >= int64(len(data)) {
         return 0
     }
     n := copy(buff, data[offset:])
+    if ok {
+        fs.prefetch.observe(cleaned, file, offset, n)
+    }
     return n
 }
 
+// handleContent returns the content read handle fh serves, loading it on
+// the first read. The handle keeps it until it is released, so a file the
+// memory cache cannot hold is still downloaded only once per open.
+func (fs *GDriveFS) handleContent(cleaned string, fh uint64) ([]byte, int) {
+    fs.mu.RLock()
+    data, loaded := fs.readData[fh]
+    _, reading := fs.readKeys[fh]
+    fs.mu.RUnlock()
+    if loaded {
+        return data, 0
+    }
+    data, errc := fs.content(cleaned)
+    if errc == 0 && reading {
+        fs.mu.Lock()
+        if _, open := fs.readKeys[fh]; open {
+            fs.readData[fh] = data
+        }
+        fs.mu.Unlock()
+    }
+    return data, errc
+}
+
+// content returns the full content of path from the offline queue, cache or Drive
+func (fs *GDriveFS) content(cleaned string) ([]byte, int) {
+    fs.mu.RLock()
+    file, ok := fs.index[cleaned]
+    fs.mu.RUnlock()
+    if !ok {
+        return nil, -fuse.ENOENT
+    }
+    if spool := fs.queue.pendingContent(cleaned); spool != "" {
+        // newest content is still waiting in the offline queue
+        data, err := os.ReadFile(spool)
+        if err != nil {
+            log.Printf("Spool read error for %s: %v", cleaned, err)
+            return nil, -fuse.EIO
+        }
+        return data, 0
+    }
+    key := contentKey(file)
+    if data, ok, _ := fs.fileCache.Get(key); ok {
+        fs.prefetch.hit(key)
+        return data, 0
+    }
+
+    var data []byte
+    var err error
+    if data = fs.l2Get(file); data != nil {
+        // shared cache hit, no Drive call needed
+    } else if fs.isOffline() || file.Id == "" {
+        return nil, -fuse.EIO
+    } else {
+        data, err = fs.Drive.DownloadFile(file)
+        if gdrive.IsNetworkError(err) {
+            fs.setOffline(true)
+        } else if err == nil {
+            fs.l2Set(file, data)
+        }
+    }
+    if err != nil {
+        log.Printf("Download error for %s: %v", cleaned, err)
+        return nil, -fuse.EIO
+    }
+    if file.Id != "" {
+        fs.fileCache.Set(key, data)
+    }
+    return data, 0
+}
+
 // Write writes to a temp file mapped to the handle
 // Write writes to a temp file mapped to the handle
 func (fs *GDriveFS) Write(path string, buff []byte, offset int64, fh uint64) int {
+    if fs.readOnly {
+        return -fuse.EROFS
+    }
     fs.mu.RLock()
     f, ok := fs.handles[fh]
     fs.mu.RUnlock()
@@ -82,15 +190,26 @@ func (fs *GDriveFS) Write(path string, buff []byte, offset int64, fh uint64) int
 
 // Getattr gets file or directory attributes
 func (fs *GDriveFS) Getattr(path string, stat *fuse.Stat_t, fh uint64) int {
+    stat.Uid, stat.Gid = fs.uid, fs.gid
     if path == "/" || path == "" {
         stat.Mode = fuse.S_IFDIR | 0755
         stat.Nlink = 2
         return 0
     }
-    cleaned := strings.TrimPrefix(path, "/")
+    // files open for writing are sized by their temp file
     fs.mu.RLock()
-    file, ok := fs.index[cleaned]
+    tmp, writing := fs.handles[fh]
     fs.mu.RUnlock()
+    if writing {
+        if info, err := tmp.Stat(); err == nil {
+            stat.Mode = fuse.S_IFREG | 0644
+            stat.Size = info.Size()
+            stat.Nlink = 1
+            return 0
+        }
+    }
+    cleaned := strings.TrimPrefix(path, "/")
+    file, ok := fs.lookup(cleaned)
     if !ok {
         return -fuse.ENOENT
     }
@@ -111,12 +230,9 @@ func (fs *GDriveFS) Readdir(path string, fill func(name string, stat *fuse.Stat_
     prefix := ""
     if cleaned != "" {
         // verify dir exists
-        fs.mu.RLock()
-        if _, ok := fs.index[cleaned]; !ok {
-            fs.mu.RUnlock()
+        if _, ok := fs.lookup(cleaned); !ok {
             return -fuse.ENOENT
         }
-        fs.mu.RUnlock()
         prefix = cleaned + "/"
     }
     fill(".", nil, 0)
@@ -175,48 +291,176 @@ func (fs *GDriveFS) Statfs(path string, stat *fuse.Statfs_t) int {
     return 0
 }
 
+// Create opens an empty temp file for a new file, or truncates an existing one
 func (fs *GDriveFS) Create(path string, flags int, mode uint32) (int, uint64) {
+    if fs.readOnly {
+        return -fuse.EROFS, 0
+    }
     cleaned := strings.TrimPrefix(path, "/")
+    fs.mu.RLock()
+    existing := fs.index[cleaned]
+    fs.mu.RUnlock()
+    exclusive := flags&fuse.O_EXCL != 0 || fs.exclusiveCreate
+    if exclusive && existing != nil {
+        return -fuse.EEXIST, 0
+    }
+    if (existing != nil && !canEdit(existing)) || (existing == nil && !fs.canAddTo(cleaned)) {
+        return -fuse.EACCES, 0
+    }
+    lease, existing, errc := fs.leaseForCreate(cleaned, existing, exclusive)
+    if errc != 0 {
+        return errc, 0
+    }
+    fs.negative.add(cleaned)
+    errc, fh := fs.openHandle(cleaned, fs.captureBase(existing), nil)
+    fs.holdLease(fh, lease, errc)
+    if errc == 0 {
+        // the kernel looks the new file up right away, before Release
+        fs.mu.Lock()
+        if _, ok := fs.index[cleaned]; !ok {
+            fs.index[cleaned] = &googleDrive.File{Name: p.Base(cleaned)}
+        }
+        fs.mu.Unlock()
+    }
+    return errc, fh
+}
+
+// Open opens a file; write access gets a temp file seeded with the current content
+func (fs *GDriveFS) Open(path string, flags int) (int, uint64) {
+    if path == "/" {
+        return 0, 0
+    }
+    cleaned := strings.TrimPrefix(path, "/")
+    file, ok := fs.lookup(cleaned)
+    if !ok {
+        return -fuse.ENOENT, 0
+    }
+    if flags&fuse.O_ACCMODE == fuse.O_RDONLY {
+        // keep the whole content cached while the file is open; files
+        // read by block never use that key
+        pin := !fs.useBlocks(file)
+        key := contentKey(file)
+        if pin {
+            fs.fileCache.Pin(key)
+        }
+        fs.mu.Lock()
+        fs.handleCtr++
+        fh := fs.handleCtr
+        if pin {
+            fs.readKeys[fh] = key
+        }
+        fs.mu.Unlock()
+        return 0, fh
+    }
+    if fs.readOnly {
+        return -fuse.EROFS, 0
+    }
+    if !canEdit(file) {
+        return -fuse.EACCES, 0
+    }
+    lease, errc := fs.leaseForWrite(file)
+    if errc != 0 {
+        return errc, 0
+    }
+    base := fs.captureBase(file)
+    var seed []byte
+    if flags&fuse.O_TRUNC == 0 {
+        data, errc := fs.content(cleaned)
+        if errc != 0 {
+            fs.releaseLease(lease)
+            return errc, 0
+        }
+        seed = data
+    }
+    errc, fh := fs.openHandle(cleaned, base, seed)
+    fs.holdLease(fh, lease, errc)
+    return errc, fh
+}
+
+// holdLease ties lease to handle fh until Release, or drops it if opening
+// the handle failed
+func (fs *GDriveFS) holdLease(fh uint64, lease string, errc int) {
+    if lease == "" {
+        return
+    }
+    if errc != 0 {
+        fs.releaseLease(lease)
+        return
+    }
+    fs.mu.Lock()
+    fs.leases[fh] = lease
+    fs.mu.Unlock()
+}
+
+// captureBase returns the current remote state of file, which later uploads
+// are checked against to detect concurrent edits
+func (fs *GDriveFS) captureBase(file *googleDrive.File) *googleDrive.File {
+    if file == nil || file.Id == "" || fs.isOffline() {
+        return file
+    }
+    remote, err := fs.Drive.GetFile(file.Id)
+    if err != nil {
+        if gdrive.IsNetworkError(err) {
+            fs.setOffline(true)
+        }
+        return file
+    }
+    return remote
+}
+
+// openHandle creates a writable temp file for path holding seed
+func (fs *GDriveFS) openHandle(cleaned string, base *googleDrive.File, seed []byte) (int, uint64) {
     tmpFile, err := os.CreateTemp("", "gdfs-*")
     if err != nil {
         log.Printf("temp file create error: %v", err)
         return -fuse.EIO, 0
     }
+    if _, err := tmpFile.Write(seed); err != nil {
+        log.Printf("temp file write error: %v", err)
+        tmpFile.Close()
+        os.Remove(tmpFile.Name())
+        return -fuse.EIO, 0
+    }
     fs.mu.Lock()
     fs.handleCtr++
     fh := fs.handleCtr
     fs.handles[fh] = tmpFile
     fs.tempNames[fh] = cleaned
+    fs.bases[fh] = base
     fs.mu.Unlock()
     return 0, fh
 }
 
-func (fs *GDriveFS) Open(path string, flags int) (int, uint64) {
-    if path == "/" {
-        return 0, 0
-    }
-    cleaned := strings.TrimPrefix(path, "/")
-    fs.mu.RLock()
-    _, ok := fs.index[cleaned]
-    fs.mu.RUnlock()
-    if !ok {
-        return -fuse.ENOENT, 0
-    }
-    return 0, 0
-}
-
-// Release is called when file handle is closed; we upload the file if it was newly created
 // Release is called when file handle is closed; upload the temp file to Drive
 func (fs *GDriveFS) Release(path string, fh uint64) int {
     fs.mu.Lock()
     f, ok := fs.handles[fh]
     name := fs.tempNames[fh]
+    base := fs.bases[fh]
     delete(fs.handles, fh)
     delete(fs.tempNames, fh)
+    delete(fs.bases, fh)
+    lease := fs.leases[fh]
+    delete(fs.leases, fh)
+    readKey, reading := fs.readKeys[fh]
+    delete(fs.readKeys, fh)
+    delete(fs.readData, fh)
     fs.mu.Unlock()
+    if reading {
+        fs.fileCache.Unpin(readKey)
+    }
     if !ok {
+        // a read handle: its sequential stream is over
+        fs.mu.RLock()
+        file, found := fs.index[strings.TrimPrefix(path, "/")]
+        fs.mu.RUnlock()
+        if found {
+            fs.prefetch.forget(file.Id)
+        }
         return 0
     }
+    // the lease covers the upload, so release it only afterwards
+    defer fs.releaseLease(lease)
     // get size before close for Explorer
     statInfo, _ := f.Stat()
     fileSize := uint64(0)
@@ -225,44 +469,96 @@ func (fs *GDriveFS) Release(path string, fh uint64) int {
     }
     // temporarily expose in-memory size for Explorer
     fs.mu.Lock()
-    fs.index[name] = &googleDrive.File{Name: p.Base(name), Size: int64(fileSize)}
+    placeholder := &googleDrive.File{Name: p.Base(name), Size: int64(fileSize)}
+    if base != nil {
+        cp := *base
+        cp.Size = placeholder.Size
+        placeholder = &cp
+    }
+    fs.index[name] = placeholder
     fs.mu.Unlock()
+    fs.negative.add(name)
+    fs.prefetch.reset()
+    if base != nil && base.Id != "" {
+        fs.invalidate(base.Id)
+    }
     f.Close()
-    // Upload
-    tmpReader, err := os.Open(f.Name())
-    if err != nil {
-        log.Printf("open temp for upload err: %v", err)
+    defer os.Remove(f.Name())
+    if fs.isOffline() {
+        fs.queueUpload(name, f.Name(), base)
+        fs.saveIndex()
         return 0
     }
-    defer tmpReader.Close()
-    // Determine target parent folder ID based on path of the new file
-    baseName := p.Base(name)
-    parentID := "root"
-    parentPath := p.Dir(name)
-    if parentPath != "." && parentPath != "" {
-        fs.mu.RLock()
-        if pFile, ok := fs.index[parentPath]; ok {
-            parentID = pFile.Id
+    uploaded, err := fs.upload(name, base, f.Name())
+    if gdrive.IsNetworkError(err) {
+        log.Printf("upload failed, queuing for later: %v", err)
+        fs.setOffline(true)
+        fs.queueUpload(name, f.Name(), base)
+        fs.saveIndex()
+    } else if err == errConflictDiscarded {
+        // the index still shows the local size
+        log.Printf("local version of %s discarded, Drive has a newer one", name)
+        fs.buildIndex()
+    } else if err == errConflictRejected {
+        // the kernel ignores errors from release, Flush reported the conflict
+        kept := filepath.Join(fs.stateDir, "conflicts", conflictCopyName(p.Base(name), time.Now()))
+        if cerr := copyFile(f.Name(), kept); cerr != nil {
+            log.Printf("failed to keep rejected local version of %s: %v", name, cerr)
+        } else {
+            log.Printf("local version of %s not uploaded, kept at %s", name, kept)
         }
-        fs.mu.RUnlock()
-    }
-    
-    _, err = fs.Drive.UploadFileToFolder(baseName, parentID, tmpReader)
-    if err != nil {
+        fs.buildIndex()
+    } else if err != nil {
         log.Printf("upload failed: %v", err)
     } else {
         log.Printf("uploaded %s to Drive", name)
+        fs.announce(invalidateUpload, uploaded)
         // refresh index for subsequent reads
         if err := fs.buildIndex(); err != nil {
             log.Printf("index refresh err: %v", err)
         }
     }
-    os.Remove(f.Name())
     return 0
 }
 
+// upload sends the content in src to Drive for path. Existing files are
+// updated in place after checking base against the remote version; if the
+// remote moved on, the conflict policy decides what is written. It returns
+// the file written on Drive, or the policy's error if nothing was.
+func (fs *GDriveFS) upload(name string, base *googleDrive.File, src string) (*googleDrive.File, error) {
+    parentID := fs.parentIDFor(name)
+    if base != nil && base.Id != "" {
+        remote, err := fs.Drive.GetFile(base.Id)
+        if err != nil && !gdrive.IsNotFound(err) {
+            return nil, err
+        }
+        if err == nil && !remote.Trashed {
+            if fs.changedOnDrive(base, remote) {
+                logConflict(name, base, remote, fs.conflictPolicy)
+                return fs.uploadConflicted(name, base.Id, parentID, src)
+            }
+            content, err := os.Open(src)
+            if err != nil {
+                return nil, err
+            }
+            defer content.Close()
+            return fs.Drive.UpdateFileContent(base.Id, content)
+        }
+        log.Printf("%s was deleted on Drive while open, uploading as new file", name)
+    }
+    content, err := os.Open(src)
+    if err != nil {
+        return nil, err
+    }
+    defer content.Close()
+    return fs.Drive.UploadFileToFolder(p.Base(name), parentID, content)
+}
+
 // Truncate resizes a file (needed by Windows before writes)
 func (fs *GDriveFS) Truncate(path string, size int64, fh uint64) int {
+    if fs.readOnly {
+        return -fuse.EROFS
+    }
     fs.mu.RLock()
     f, ok := fs.handles[fh]
     fs.mu.RUnlock()
@@ -276,19 +572,118 @@ func (fs *GDriveFS) Truncate(path string, size int64, fh uint64) int {
     return 0
 }
 
-// Flush ensures data is written to disk for a handle
-// Rename moves/renames a file or directory locally (Drive change postponed)
+// Rename moves/renames a file or directory on Drive, or queues it while offline
 func (fs *GDriveFS) Rename(oldpath, newpath string) int {
+    if fs.readOnly {
+        return -fuse.EROFS
+    }
     oldclean := strings.TrimPrefix(oldpath, "/")
     newclean := strings.TrimPrefix(newpath, "/")
-    fs.mu.Lock()
+    fs.mu.RLock()
     f, ok := fs.index[oldclean]
-    if ok {
-        fs.index[newclean] = f
-        delete(fs.index, oldclean)
+    fs.mu.RUnlock()
+    if !ok {
+        return -fuse.ENOENT
+    }
+    if fs.addsToMyDrive(oldclean, newclean) {
+        return fs.addToMyDrive(f, newclean)
+    }
+    if errc := fs.checkRename(f, oldclean, newclean); errc != 0 {
+        return errc
+    }
+    id := driveFileID(f)
+    offline := fs.isOffline()
+    if !offline && f.Id != "" {
+        moved, err := fs.Drive.MoveFile(id, p.Base(newclean), fs.parentIDFor(oldclean), fs.parentIDFor(newclean))
+        if gdrive.IsNetworkError(err) {
+            fs.setOffline(true)
+            offline = true
+        } else if gdrive.IsPermissionDenied(err) {
+            log.Printf("rename refused: %v", err)
+            return -fuse.EACCES
+        } else if err != nil {
+            log.Printf("rename failed: %v", err)
+            return -fuse.EIO
+        } else {
+            fs.announce(invalidateRename, moved)
+        }
+    }
+    if offline && id != f.Id {
+        // the queue would move the shortcut's target
+        return -fuse.EAGAIN
+    }
+    if offline {
+        fs.queueRename(oldclean, newclean, f)
+    }
+    fs.mu.Lock()
+    for key, entry := range fs.index {
+        if key == oldclean || strings.HasPrefix(key, oldclean+"/") {
+            delete(fs.index, key)
+            fs.index[newclean+strings.TrimPrefix(key, oldclean)] = entry
+            fs.negative.add(newclean + strings.TrimPrefix(key, oldclean))
+        }
     }
     fs.mu.Unlock()
-    // TODO: call Drive API Files.Update to rename/move in background
+    fs.prefetch.reset()
+    if offline {
+        fs.saveIndex()
+    }
+    return 0
+}
+
+// Unlink moves a file to the Drive trash, or queues it while offline
+func (fs *GDriveFS) Unlink(path string) int {
+    if fs.readOnly {
+        return -fuse.EROFS
+    }
+    cleaned := strings.TrimPrefix(path, "/")
+    fs.mu.RLock()
+    f, ok := fs.index[cleaned]
+    fs.mu.RUnlock()
+    if !ok {
+        return -fuse.ENOENT
+    }
+    if gdrive.IsVirtual(f) {
+        return -fuse.EPERM
+    }
+    if f.Capabilities != nil && !f.Capabilities.CanTrash {
+        return -fuse.EACCES
+    }
+    id := driveFileID(f)
+    offline := fs.isOffline()
+    if !offline && f.Id != "" {
+        err := fs.Drive.TrashFile(id)
+        if gdrive.IsNetworkError(err) {
+            fs.setOffline(true)
+            offline = true
+        } else if gdrive.IsPermissionDenied(err) {
+            log.Printf("delete refused: %v", err)
+            return -fuse.EACCES
+        } else if err != nil {
+            log.Printf("delete failed: %v", err)
+            return -fuse.EIO
+        } else if id != f.Id {
+            // only the shortcut is gone, not the target's paths
+            fs.announce(invalidateDelete, &googleDrive.File{Id: id})
+        } else {
+            fs.announce(invalidateDelete, f)
+        }
+    }
+    if offline && id != f.Id {
+        return -fuse.EAGAIN
+    }
+    if offline {
+        fs.queueDelete(cleaned, f)
+    }
+    fs.mu.Lock()
+    delete(fs.index, cleaned)
+    fs.mu.Unlock()
+    if f.Id != "" && id == f.Id {
+        fs.invalidate(f.Id)
+    }
+    if offline {
+        fs.saveIndex()
+    }
     return 0
 }
 
@@ -297,12 +692,22 @@ func (fs *GDriveFS) Chmod(path string, mode uint32) int           { return 0 }
 func (fs *GDriveFS) Chown(path string, uid, gid uint32) int       { return 0 }
 func (fs *GDriveFS) Utimens(path string, tmsp []fuse.Timespec) int { return 0 }
 
+// Flush ensures data is written to disk for a handle; with the fail conflict
+// policy it reports EBUSY to close() when the file changed on Drive
 func (fs *GDriveFS) Flush(path string, fh uint64) int {
     fs.mu.RLock()
     f, ok := fs.handles[fh]
+    base := fs.bases[fh]
     fs.mu.RUnlock()
-    if ok {
-        f.Sync()
+    if !ok {
+        return 0
+    }
+    f.Sync()
+    if fs.conflictPolicy == ConflictFail && base != nil && base.Id != "" && !fs.isOffline() {
+        if remote, err := fs.Drive.GetFile(base.Id); err == nil && fs.changedOnDrive(base, remote) {
+            logConflict(strings.TrimPrefix(path, "/"), base, remote, fs.conflictPolicy)
+            return -fuse.EBUSY
+        }
     }
     return 0
 }
@@ -312,14 +717,62 @@ func (fs *GDriveFS) buildIndex() error {
     if fs.Drive == nil {
         return fmt.Errorf("Drive service not set")
     }
-    files, err := fs.Drive.ListAllFiles()
+    var files []*googleDrive.File
+    var err error
+    if drv := fs.Drive.RootDrive(); drv != "" {
+        files, err = fs.Drive.ListDriveFiles(drv)
+    } else {
+        files, err = fs.Drive.ListAllFiles()
+    }
+    if err != nil {
+        return err
+    }
+    tops := map[string]string{fs.Drive.Root(): ""}
+    if fs.Drive.Root() == "root" {
+        rootID, err := fs.Drive.RootID()
+        if err != nil {
+            return err
+        }
+        tops[rootID] = ""
+    }
+    shared, err := fs.listSharedDrives()
+    if err != nil {
+        return err
+    }
+    sharedWithMe, err := fs.listSharedWithMe()
     if err != nil {
         return err
     }
     fs.mu.Lock()
-    // Build maps
+    previous := fs.index
     fs.index = make(map[string]*googleDrive.File)
-    fs.fileCache = make(map[string][]byte)
+    addTree(fs.index, notSharedWithMe(files, sharedWithMe), tops)
+    if fs.Drive.SharedDrives() {
+        addSharedDrives(fs.index, shared)
+    }
+    if fs.Drive.SharedWithMe() {
+        addSharedWithMe(fs.index, files, sharedWithMe)
+    }
+    all := append(files, sharedWithMe...)
+    for _, drv := range shared {
+        all = append(all, drv.files...)
+    }
+    addShortcutTargets(fs.index, all)
+    fs.negative.rebuild(fs.index)
+    fs.mu.Unlock()
+    fs.prefetch.reset()
+    fs.dropStale(previous)
+    if err := fs.saveIndex(); err != nil {
+        log.Printf("Failed to persist index: %v", err)
+    }
+    return nil
+}
+
+// addTree adds files to index, resolving paths through their parents up
+// to one of the folders in tops, which maps folder IDs to their paths.
+// Files without parents count as children of "root"; files outside tops
+// are left out.
+func addTree(index map[string]*googleDrive.File, files []*googleDrive.File, tops map[string]string) {
     idToFile := make(map[string]*googleDrive.File)
     parentsMap := make(map[string][]string) // childID -> parents
     for _, f := range files {
@@ -331,8 +784,12 @@ func (fs *GDriveFS) buildIndex() error {
             parentsMap[f.Id] = []string{"root"}
         }
     }
-    // Build path for each
-    pathCache := map[string]string{"root": ""}
+    // Build path for each; files outside tops resolve to outsideRoot
+    const outsideRoot = "\x00"
+    pathCache := make(map[string]string, len(tops))
+    for id, path := range tops {
+        pathCache[id] = path
+    }
     var resolvePath func(id string) string
     resolvePath = func(id string) string {
         if p, ok := pathCache[id]; ok {
@@ -340,10 +797,13 @@ func (fs *GDriveFS) buildIndex() error {
         }
         prnts := parentsMap[id]
         if len(prnts) == 0 {
-            return "" // orphan
+            pathCache[id] = outsideRoot
+            return outsideRoot
         }
         parentPath := resolvePath(prnts[0]) // use first parent for now
-        if parentPath == "" {
+        if parentPath == outsideRoot {
+            pathCache[id] = outsideRoot
+        } else if parentPath == "" {
             pathCache[id] = idToFile[id].Name
         } else {
             pathCache[id] = p.Join(parentPath, idToFile[id].Name)
@@ -352,13 +812,33 @@ func (fs *GDriveFS) buildIndex() error {
     }
     for id := range idToFile {
         p := resolvePath(id)
-        if p == "" {
+        if p == "" || p == outsideRoot {
             continue
         }
-        fs.index[p] = idToFile[id]
+        index[p] = idToFile[id]
+    }
+}
+
+// Init is called once the filesystem is mounted
+func (fs *GDriveFS) Init() {
+    close(fs.ready)
+}
+
+// Destroy is called on unmount and stops background work
+func (fs *GDriveFS) Destroy() {
+    fs.stopOnce.Do(func() { close(fs.stop) })
+    if fs.control != nil {
+        fs.control.Close()
+    }
+    if fs.locks != nil {
+        fs.locks.Close()
+    }
+    st := fs.fileCache.Stats()
+    log.Printf("Memory cache: %d entries, %d bytes, %d hits, %d misses, %d evictions (%d bytes)",
+        st.Entries, st.Bytes, st.Hits, st.Misses, st.Evictions, st.EvictedBytes)
+    if fs.prefetch != nil {
+        log.Printf("Prefetch: %s", fs.prefetch.Stats())
     }
-    fs.mu.Unlock()
-    return nil
 }
 
 // refreshQuota updates quota information from Drive API
@@ -408,8 +888,101 @@ func cleanupMountPoint(mountPoint string) {
 	}
 }
 
+// NewGDriveFS creates a filesystem over drv and loads its index, falling back
+// to the persisted index in offline mode. Background work stops on Destroy.
+func NewGDriveFS(drv *gdrive.DriveService, opts Options) *GDriveFS {
+	opts = opts.withDefaults()
+	fs := &GDriveFS{
+		Drive:     drv,
+		index:     make(map[string]*googleDrive.File),
+		fileCache: cache.NewMemoryCache(opts.MemoryMaxBytes, opts.MemoryMaxEntries),
+		readKeys:  make(map[uint64]string),
+		readData:  make(map[uint64][]byte),
+		negative:  newLookupFilter(opts.NegativeTTL),
+		handles:   make(map[uint64]*os.File),
+		tempNames: make(map[uint64]string),
+		bases:     make(map[uint64]*googleDrive.File),
+		leases:    make(map[uint64]string),
+		stateDir:  opts.StateDir,
+		stop:      make(chan struct{}),
+		ready:     make(chan struct{}),
+		conflictPolicy: opts.ConflictPolicy,
+		exclusiveCreate: opts.ExclusiveCreate,
+		readOnly:  opts.ReadOnly,
+	}
+	if runtime.GOOS != "windows" {
+		// with default_permissions the kernel checks these
+		fs.uid, fs.gid = uint32(os.Getuid()), uint32(os.Getgid())
+	}
+	queue, err := loadQueue(opts.StateDir)
+	if err != nil {
+		log.Printf("Warning: %v", err)
+	}
+	fs.queue = queue
+	if opts.BlockCacheMaxBytes > 0 {
+		blocks, err := cache.NewBlockCache(opts.BlockCacheDir, opts.BlockCacheMaxBytes, opts.BlockSize)
+		if err != nil {
+			log.Printf("Warning: continuing without block cache: %v", err)
+		} else {
+			log.Printf("Using block cache at %s (%d of %d bytes used)", opts.BlockCacheDir, blocks.Size(), opts.BlockCacheMaxBytes)
+			fs.blocks = blocks
+		}
+	}
+	if opts.Cache != "" {
+		l2, err := cache.New(opts.cacheConfig())
+		if err != nil {
+			log.Printf("Warning: continuing without %s cache: %v", opts.Cache, err)
+		} else {
+			log.Printf("Using %s content cache", opts.Cache)
+			fs.l2 = l2
+		}
+	}
+    fs.refreshQuota()
+    if err := fs.buildIndex(); err != nil {
+        log.Printf("Failed to build index: %v", err)
+        if err := fs.loadIndex(); err != nil {
+            log.Printf("No persisted index available: %v", err)
+        } else {
+            log.Printf("Serving persisted index from %s", opts.StateDir)
+        }
+        fs.setOffline(true)
+    }
+    if !opts.DisablePrefetch {
+        fs.prefetch = newPrefetcher(fs, opts)
+        go fs.prefetch.prefetchLog(time.Minute)
+    }
+    if opts.RedisAddr != "" {
+        fs.bus = cache.NewInvalidationBus(opts.RedisAddr, opts.RedisChannel)
+        go fs.bus.Subscribe(fs.stop, fs.applyInvalidation)
+        log.Printf("Sharing invalidations on Redis channel %s", opts.RedisChannel)
+    }
+    switch opts.Lock {
+    case lock.BackendRedis:
+        fs.locks = lock.NewManager(lock.NewRedisBackend(opts.RedisAddr), opts.LockTTL)
+    case lock.BackendDrive:
+        fs.locks = lock.NewManager(lock.NewDriveBackend(drv), opts.LockTTL)
+    }
+    if fs.locks != nil {
+        log.Printf("Using %s write leases as owner %s", opts.Lock, fs.locks.Owner())
+    }
+	return fs
+}
+
+// Host is a mounted filesystem.
+type Host struct {
+	*fuse.FileSystemHost
+	done chan struct{}
+}
+
+// Done is closed once the filesystem has been unmounted, whether by
+// Unmount, the control socket or the OS.
+func (h *Host) Done() <-chan struct{} {
+	return h.done
+}
+
 // Mount initializes and mounts the FUSE filesystem and returns the host for unmounting
-func Mount(mountPoint string, drv *gdrive.DriveService) (*fuse.FileSystemHost, error) {
+func Mount(mountPoint string, drv *gdrive.DriveService, opts Options) (*Host, error) {
+	opts = opts.withDefaults()
 	// For drive letters, skip the absolute path conversion
 	if !strings.HasSuffix(mountPoint, ":") {
 		// Convert to absolute path for directory mounts
@@ -436,39 +1009,49 @@ func Mount(mountPoint string, drv *gdrive.DriveService) (*fuse.FileSystemHost, e
 
 	log.Printf("Mounting GDriveFS at %s", mountPoint)
 
-	// Initialize filesystem
-	fs := &GDriveFS{Drive: drv, handles: make(map[uint64]*os.File), tempNames: make(map[uint64]string)}
-    fs.refreshQuota()
-    if err := fs.buildIndex(); err != nil {
-        log.Printf("Failed to build index: %v", err)
-    }
-	
+	fs := NewGDriveFS(drv, opts)
+	// only a mount replays queued changes; warm and other users of the
+	// filesystem leave them for it
+	go fs.watchConnectivity(opts.ReconnectInterval)
+
 	// Create FUSE host
 	host := fuse.NewFileSystemHost(fs)
 	
-	// Set mount options - match memfs defaults
-	options := []string{
-		"-o", "debug",                  // Enable debug output
-		"-o", "umask=0",                 // Full permissions
-		"-o", "uid=-1",                  // Current user
-		"-o", "gid=-1",                  // Current group
-		"-o", "FileInfoTimeout=0",
-		"-o", "VolumeInfoTimeout=0",
-		"-o", "VolumeSerialNumber=0",
-		"-o", "FileSystemName=GDriveFS", // Name shown in Windows Explorer
-		"-o", "volname=GDrive",
-	}
+	options := opts.mountArgs()
+	log.Printf("Mount options: %s", strings.Join(options, " "))
 
 	// Try to unmount first in case of previous unclean shutdown
 	host.Unmount()
 
-	// Mount the filesystem
-	if !host.Mount(mountPoint, options) {
-		// If mount fails, clean up the mount point
-		cleanupMountPoint(mountPoint)
-		return nil, fmt.Errorf("mount failed - is the mount point in use?")
+	// Mount blocks until unmount, so serve it in the background and wait
+	// for Init to report the filesystem is up
+	result := make(chan bool, 1)
+	done := make(chan struct{})
+	go func() {
+		result <- host.Mount(mountPoint, options)
+		close(done)
+	}()
+	select {
+	case <-fs.ready:
+	case ok := <-result:
+		if !ok {
+			// If mount fails, clean up the mount point
+			fs.Destroy()
+			cleanupMountPoint(mountPoint)
+			return nil, fmt.Errorf("mount failed - is the mount point in use?")
+		}
+	}
+
+	fs.host = host
+	fs.mountPoint = mountPoint
+	if srv, err := control.Listen(opts.ControlSocket); err != nil {
+		log.Printf("Warning: control socket unavailable: %v", err)
+	} else {
+		fs.control = srv
+		fs.serveControl(srv)
+		log.Printf("Control socket listening at %s", opts.ControlSocket)
 	}
 
 	log.Println("Filesystem mounted successfully")
-	return host, nil
+	return &Host{FileSystemHost: host, done: done}, nil
 }
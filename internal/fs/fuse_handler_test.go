@@ -0,0 +1,282 @@
+package fs
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"GDrive/internal/cache"
+	gdrive "GDrive/internal/drive"
+
+	"github.com/winfsp/cgofuse/fuse"
+	googleDrive "google.golang.org/api/drive/v3"
+	"google.golang.org/api/option"
+)
+
+// newTestFS returns a filesystem with no Drive service, for operations that
+// do not reach Drive.
+func newTestFS(t *testing.T) *GDriveFS {
+	t.Helper()
+	stateDir := t.TempDir()
+	fs := &GDriveFS{
+		index:     make(map[string]*googleDrive.File),
+		fileCache: cache.NewMemoryCache(1<<20, 100),
+		readKeys:  make(map[uint64]string),
+		readData:  make(map[uint64][]byte),
+		negative:  newLookupFilter(time.Minute),
+		handles:   make(map[uint64]*os.File),
+		tempNames: make(map[uint64]string),
+		bases:     make(map[uint64]*googleDrive.File),
+		leases:    make(map[uint64]string),
+		stateDir:  stateDir,
+		queue:     &opQueue{dir: stateDir},
+		stop:      make(chan struct{}),
+		uid:       1000,
+		gid:       1000,
+	}
+	t.Cleanup(func() {
+		for _, f := range fs.handles {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	})
+	return fs
+}
+
+// fakeDrive serves the part of the Drive API the filesystem writes through:
+// listing, getting, downloading, creating, updating and trashing files. There are no
+// shared drives and nothing is shared with the user.
+type fakeDrive struct {
+	*httptest.Server
+	mu      sync.Mutex
+	files   map[string]*googleDrive.File
+	content map[string]string
+	nextID  int
+	// downloads counts content downloads
+	downloads int
+}
+
+// newFakeDrive points fs at a new fake Drive holding files.
+func newFakeDrive(t *testing.T, fs *GDriveFS, files ...*googleDrive.File) *fakeDrive {
+	t.Helper()
+	fd := &fakeDrive{files: make(map[string]*googleDrive.File), content: make(map[string]string)}
+	fd.files["root"] = &googleDrive.File{Id: "root", Name: "My Drive", MimeType: gdrive.FolderMimeType}
+	for _, f := range files {
+		fd.files[f.Id] = f
+	}
+	fd.Server = httptest.NewServer(fd)
+	t.Cleanup(fd.Close)
+	svc, err := googleDrive.NewService(context.Background(),
+		option.WithEndpoint(fd.URL+"/drive/v3/"), option.WithHTTPClient(fd.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs.Drive = gdrive.NewDriveService(svc)
+	return fd
+}
+
+// file returns a copy of the file with id and its content.
+func (fd *fakeDrive) file(id string) (googleDrive.File, string) {
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	if f, ok := fd.files[id]; ok {
+		return *f, fd.content[id]
+	}
+	return googleDrive.File{}, ""
+}
+
+// edit changes the content of the file with id as another client would.
+func (fd *fakeDrive) edit(id, content string) {
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	f := fd.files[id]
+	f.Version++
+	f.Size = int64(len(content))
+	fd.content[id] = content
+}
+
+// byName returns the first file called name, or nil.
+func (fd *fakeDrive) byName(name string) *googleDrive.File {
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	for _, f := range fd.files {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+func (fd *fakeDrive) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	upload := strings.HasPrefix(r.URL.Path, "/upload/")
+	id := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+	if id == "files" {
+		id = ""
+	}
+	if id == "drives" {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"drives":[]}`)
+		return
+	}
+	if id == "" && r.Method == http.MethodGet {
+		list := &googleDrive.FileList{Files: []*googleDrive.File{}}
+		for _, f := range fd.files {
+			if f.Id != "root" && !f.Trashed && !strings.Contains(r.URL.Query().Get("q"), "sharedWithMe") {
+				list.Files = append(list.Files, f)
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(list)
+		return
+	}
+
+	var meta googleDrive.File
+	var content string
+	if upload {
+		_, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		mr := multipart.NewReader(r.Body, params["boundary"])
+		part, err := mr.NextPart()
+		if err == nil {
+			err = json.NewDecoder(part).Decode(&meta)
+		}
+		if err == nil {
+			part, err = mr.NextPart()
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		data, _ := io.ReadAll(part)
+		content = string(data)
+	} else if r.Method != http.MethodGet {
+		json.NewDecoder(r.Body).Decode(&meta)
+	}
+
+	if r.Method == http.MethodPost {
+		fd.nextID++
+		id = "new-" + strconv.Itoa(fd.nextID)
+		fd.files[id] = &googleDrive.File{Id: id, Name: meta.Name, Parents: meta.Parents}
+	}
+	f, ok := fd.files[id]
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		io.WriteString(w, `{"error":{"code":404,"message":"File not found"}}`)
+		return
+	}
+	if r.Method == http.MethodGet && r.URL.Query().Get("alt") == "media" {
+		fd.downloads++
+		io.WriteString(w, fd.content[id])
+		return
+	}
+	if r.Method != http.MethodGet {
+		f.Version++
+		if upload {
+			fd.content[id] = content
+			f.Size = int64(len(content))
+			f.HeadRevisionId = "rev-" + strconv.FormatInt(f.Version, 10)
+		}
+		if meta.Name != "" {
+			f.Name = meta.Name
+		}
+		if meta.Trashed {
+			f.Trashed = true
+		}
+		if add := r.URL.Query().Get("addParents"); add != "" {
+			f.Parents = []string{add}
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(f)
+}
+
+func TestCreateVisibleBeforeRelease(t *testing.T) {
+	fs := newTestFS(t)
+	errc, fh := fs.Create("/new.txt", fuse.O_CREAT|fuse.O_WRONLY, 0644)
+	if errc != 0 {
+		t.Fatalf("Create = %d", errc)
+	}
+
+	var stat fuse.Stat_t
+	if errc := fs.Getattr("/new.txt", &stat, ^uint64(0)); errc != 0 {
+		t.Fatalf("Getattr by path after Create = %d", errc)
+	}
+	if stat.Mode != fuse.S_IFREG|0644 || stat.Size != 0 {
+		t.Errorf("Getattr = mode %o size %d, want empty regular file", stat.Mode, stat.Size)
+	}
+
+	if n := fs.Write("/new.txt", []byte("hello"), 0, fh); n != 5 {
+		t.Fatalf("Write = %d", n)
+	}
+	if errc := fs.Getattr("/new.txt", &stat, fh); errc != 0 || stat.Size != 5 {
+		t.Errorf("Getattr by handle = %d, size %d, want size 5", errc, stat.Size)
+	}
+}
+
+func TestGetattrOwner(t *testing.T) {
+	fs := newTestFS(t)
+	fs.index["dir"] = &googleDrive.File{Name: "dir", MimeType: "application/vnd.google-apps.folder"}
+	fs.index["dir/a"] = &googleDrive.File{Name: "a", Size: 3}
+	fs.negative.rebuild(fs.index)
+	for _, path := range []string{"/", "/dir", "/dir/a"} {
+		var stat fuse.Stat_t
+		if errc := fs.Getattr(path, &stat, ^uint64(0)); errc != 0 {
+			t.Fatalf("Getattr(%s) = %d", path, errc)
+		}
+		if stat.Uid != 1000 || stat.Gid != 1000 {
+			t.Errorf("Getattr(%s) owner = %d:%d, want 1000:1000", path, stat.Uid, stat.Gid)
+		}
+	}
+}
+
+func TestReadUncachedFileDownloadsOnce(t *testing.T) {
+	fs := newTestFS(t)
+	// the file does not fit the memory cache, so every Set evicts it
+	fs.fileCache = cache.NewMemoryCache(64, 100)
+	fd := newFakeDrive(t, fs, &googleDrive.File{Id: "f1", Name: "big.bin", Version: 1})
+	content := strings.Repeat("0123456789", 100)
+	fd.edit("f1", content)
+	remote, _ := fd.file("f1")
+	fs.index["big.bin"] = &remote
+	fs.negative.rebuild(fs.index)
+
+	errc, fh := fs.Open("/big.bin", fuse.O_RDONLY)
+	if errc != 0 {
+		t.Fatalf("Open = %d", errc)
+	}
+	var got []byte
+	buff := make([]byte, 128)
+	for {
+		n := fs.Read("/big.bin", buff, int64(len(got)), fh)
+		if n < 0 {
+			t.Fatalf("Read at %d = %d", len(got), n)
+		}
+		if n == 0 {
+			break
+		}
+		got = append(got, buff[:n]...)
+	}
+	if string(got) != content {
+		t.Fatalf("read %d bytes, want the %d byte file", len(got), len(content))
+	}
+	if fd.downloads != 1 {
+		t.Errorf("downloads = %d, want 1 for one open", fd.downloads)
+	}
+
+	fs.Release("/big.bin", fh)
+	if _, loaded := fs.readData[fh]; loaded {
+		t.Error("content kept after Release")
+	}
+}
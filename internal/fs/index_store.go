@@ -0,0 +1,46 @@
+package fs
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"GDrive/internal/cache"
+
+	googleDrive "google.golang.org/api/drive/v3"
+)
+
+const indexFileName = "index.json"
+
+// saveIndex writes the current path index to the state directory so that a
+// later mount can start without reaching Drive.
+func (fs *GDriveFS) saveIndex() error {
+	if fs.stateDir == "" {
+		return nil
+	}
+	fs.mu.RLock()
+	data, err := json.Marshal(fs.index)
+	fs.mu.RUnlock()
+	if err != nil {
+		return fmt.Errorf("failed to encode index: %v", err)
+	}
+	return cache.WriteFileAtomic(filepath.Join(fs.stateDir, indexFileName), data)
+}
+
+// loadIndex replaces the in-memory index with the persisted one.
+func (fs *GDriveFS) loadIndex() error {
+	data, err := os.ReadFile(filepath.Join(fs.stateDir, indexFileName))
+	if err != nil {
+		return fmt.Errorf("failed to read persisted index: %v", err)
+	}
+	index := make(map[string]*googleDrive.File)
+	if err := json.Unmarshal(data, &index); err != nil {
+		return fmt.Errorf("failed to decode persisted index: %v", err)
+	}
+	fs.mu.Lock()
+	fs.index = index
+	fs.mu.Unlock()
+	fs.negative.rebuild(index)
+	return nil
+}
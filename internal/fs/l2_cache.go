@@ -0,0 +1,77 @@
+package fs
+
+import (
+	"fmt"
+	"log"
+
+	googleDrive "google.golang.org/api/drive/v3"
+)
+
+// Both cache tiers are keyed by file ID plus content checksum (or version for
+// native Google files without one), so a changed file never matches a stale
+// entry and renames keep their cached content.
+
+// contentKey returns the cache key for the current content of file.
+func contentKey(file *googleDrive.File) string {
+	if file.Md5Checksum != "" {
+		return fileKeyPrefix(file.Id) + file.Md5Checksum
+	}
+	return fmt.Sprintf("%sv%d", fileKeyPrefix(file.Id), file.Version)
+}
+
+// fileKeyPrefix is shared by every cached version of a file.
+func fileKeyPrefix(fileID string) string {
+	return "gdrivefs:content:" + fileID + ":"
+}
+
+// invalidate drops every locally cached version of a file.
+func (fs *GDriveFS) invalidate(fileID string) {
+	fs.fileCache.DeletePrefix(fileKeyPrefix(fileID))
+	if fs.blocks != nil {
+		fs.blocks.Invalidate(fileID)
+	}
+}
+
+// dropStale removes in-process entries for files that were deleted or
+// changed since the previous index was built.
+func (fs *GDriveFS) dropStale(previous map[string]*googleDrive.File) {
+	fs.mu.RLock()
+	current := make(map[string]string, len(fs.index))
+	for _, f := range fs.index {
+		current[f.Id] = contentKey(f)
+	}
+	fs.mu.RUnlock()
+	for _, f := range previous {
+		if f.Id == "" {
+			continue
+		}
+		if key := contentKey(f); current[f.Id] != key {
+			fs.fileCache.Delete(key)
+		}
+	}
+}
+
+// l2Get returns cached content for file, or nil on a miss.
+func (fs *GDriveFS) l2Get(file *googleDrive.File) []byte {
+	if fs.l2 == nil || file.Id == "" {
+		return nil
+	}
+	data, found, err := fs.l2.Get(contentKey(file))
+	if err != nil {
+		log.Printf("Cache read error for %s: %v", file.Name, err)
+	}
+	if !found {
+		return nil
+	}
+	return data
+}
+
+// l2Set stores content for file.
+func (fs *GDriveFS) l2Set(file *googleDrive.File, data []byte) {
+	if fs.l2 == nil || file.Id == "" {
+		return
+	}
+	if err := fs.l2.Set(contentKey(file), data); err != nil {
+		log.Printf("Cache write error for %s: %v", file.Name, err)
+	}
+}
@@ -0,0 +1,64 @@
+package fs
+
+import (
+	"testing"
+	"time"
+
+	"GDrive/internal/cache"
+
+	"github.com/alicebob/miniredis/v2"
+	googleDrive "google.golang.org/api/drive/v3"
+)
+
+func TestContentKey(t *testing.T) {
+	tests := []struct {
+		file googleDrive.File
+		want string
+	}{
+		{googleDrive.File{Id: "f1", Md5Checksum: "abc", Version: 4}, "gdrivefs:content:f1:abc"},
+		{googleDrive.File{Id: "doc", Version: 4}, "gdrivefs:content:doc:v4"},
+	}
+	for _, tt := range tests {
+		if got := contentKey(&tt.file); got != tt.want {
+			t.Errorf("contentKey(%s) = %s, want %s", tt.file.Id, got, tt.want)
+		}
+	}
+}
+
+func TestL2SharedBetweenMounts(t *testing.T) {
+	mr := miniredis.RunT(t)
+	file := &googleDrive.File{Id: "f1", Name: "a.txt", Version: 1}
+	mounts := make([]*GDriveFS, 2)
+	var fd *fakeDrive
+	for i := range mounts {
+		fs := newTestFS(t)
+		fs.l2 = cache.NewRedisCache(mr.Addr(), time.Hour)
+		if fd == nil {
+			fd = newFakeDrive(t, fs, file)
+			fd.edit("f1", "shared")
+		} else {
+			fs.Drive = mounts[0].Drive
+		}
+		remote, _ := fd.file("f1")
+		fs.index["a.txt"] = &remote
+		mounts[i] = fs
+	}
+
+	for i, fs := range mounts {
+		data, errc := fs.content("a.txt")
+		if errc != 0 || string(data) != "shared" {
+			t.Fatalf("mount %d: content = %q, %d", i, data, errc)
+		}
+	}
+	if fd.downloads != 1 {
+		t.Errorf("downloads = %d, want 1 with the second mount served by Redis", fd.downloads)
+	}
+
+	// a new version is another key, so it is downloaded again
+	fd.edit("f1", "changed")
+	remote, _ := fd.file("f1")
+	mounts[1].index["a.txt"] = &remote
+	if data, _ := mounts[1].content("a.txt"); string(data) != "changed" || fd.downloads != 2 {
+		t.Errorf("after a change: content %q with %d downloads, want changed with 2", data, fd.downloads)
+	}
+}
@@ -0,0 +1,90 @@
+package fs
+
+import (
+	"errors"
+	"log"
+	p "path"
+
+	"GDrive/internal/lock"
+	"github.com/winfsp/cgofuse/fuse"
+	googleDrive "google.golang.org/api/drive/v3"
+)
+
+// Write leases keep two mounts from writing the same file at once. Existing
+// files are leased by ID from Open/Create until Release; new files are
+// leased by parent folder and name so concurrent creates of one path do not
+// produce duplicate Drive files. Nothing is leased while offline.
+
+// fileLease names the lease on an existing file.
+func fileLease(file *googleDrive.File) string {
+	return "file:" + file.Id
+}
+
+// createLease names the lease on creating name in the folder parentID.
+func createLease(parentID, name string) string {
+	return "create:" + parentID + "/" + name
+}
+
+// acquireLease takes a lease, mapping a lease held elsewhere to EBUSY.
+func (fs *GDriveFS) acquireLease(fileID, name string) int {
+	err := fs.locks.Acquire(fileID, name)
+	if errors.Is(err, lock.ErrLocked) {
+		log.Printf("%s is being written through another mount", name)
+		return -fuse.EBUSY
+	}
+	if err != nil {
+		log.Printf("Lease error: %v", err)
+		return -fuse.EIO
+	}
+	return 0
+}
+
+// leaseForWrite leases an existing file opened for writing. It returns the
+// lease name, or "" if no lease was taken.
+func (fs *GDriveFS) leaseForWrite(file *googleDrive.File) (string, int) {
+	if fs.locks == nil || file == nil || file.Id == "" || fs.isOffline() {
+		return "", 0
+	}
+	name := fileLease(file)
+	return name, fs.acquireLease(file.Id, name)
+}
+
+// leaseForCreate leases path for Create. For a path not in the index it
+// also asks Drive whether another mount created it meanwhile; that file is
+// returned so it is updated rather than duplicated, unless exclusive is set,
+// in which case the create fails with EEXIST.
+func (fs *GDriveFS) leaseForCreate(path string, existing *googleDrive.File, exclusive bool) (string, *googleDrive.File, int) {
+	if fs.locks == nil || fs.isOffline() {
+		return "", existing, 0
+	}
+	if existing != nil && existing.Id != "" {
+		name, errc := fs.leaseForWrite(existing)
+		return name, existing, errc
+	}
+	parentID := fs.parentIDFor(path)
+	name := createLease(parentID, p.Base(path))
+	if errc := fs.acquireLease(parentID, name); errc != 0 {
+		return "", nil, errc
+	}
+	found, err := fs.Drive.FindFile(parentID, p.Base(path))
+	if err != nil {
+		log.Printf("Failed to check Drive for %s: %v", path, err)
+		return name, existing, 0
+	}
+	if found != nil {
+		if exclusive {
+			fs.locks.Release(name)
+			return "", nil, -fuse.EEXIST
+		}
+		log.Printf("%s was created through another mount, updating it", path)
+		existing = found
+	}
+	return name, existing, 0
+}
+
+// releaseLease gives up a lease taken by leaseForWrite or leaseForCreate.
+func (fs *GDriveFS) releaseLease(name string) {
+	if fs.locks != nil && name != "" {
+		fs.locks.Release(name)
+	}
+}
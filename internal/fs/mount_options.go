@@ -0,0 +1,83 @@
+package fs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// DefaultMountPoint is where Drive is mounted when no mount point is given:
+// drive letter X: on Windows and ~/GDrive elsewhere.
+func DefaultMountPoint() string {
+	if runtime.GOOS == "windows" {
+		return "X:"
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "GDrive"
+	}
+	return filepath.Join(home, "GDrive")
+}
+
+// mountArgs returns the FUSE command-line options for the current OS,
+// followed by o.MountOptions.
+func (o Options) mountArgs() []string {
+	var opts []string
+	switch runtime.GOOS {
+	case "windows":
+		// WinFsp
+		opts = append(opts,
+			"umask=0",
+			"uid=-1",
+			"gid=-1",
+			"FileInfoTimeout=0",
+			"VolumeInfoTimeout=0",
+			"VolumeSerialNumber=0",
+			"FileSystemName=GDriveFS", // name shown in Windows Explorer
+			"volname=GDrive",
+		)
+	case "darwin":
+		// macFUSE
+		opts = append(opts, "fsname=gdrivefs", "volname=GDrive")
+		opts = append(opts, o.unixMountOptions()...)
+	default:
+		// libfuse on Linux and the BSDs
+		opts = append(opts, "fsname=gdrivefs", "subtype=gdrivefs")
+		opts = append(opts, o.unixMountOptions()...)
+	}
+	if o.ReadOnly && runtime.GOOS != "windows" {
+		// GDriveFS refuses changes itself; this lets the kernel and
+		// tools know up front
+		opts = append(opts, "ro")
+	}
+	if o.Debug {
+		opts = append(opts, "debug")
+	}
+	opts = append(opts, o.MountOptions...)
+
+	args := make([]string, 0, 2*len(opts))
+	for _, opt := range opts {
+		args = append(args, "-o", opt)
+	}
+	return args
+}
+
+// unixMountOptions returns the permission and caching options shared by
+// libfuse and macFUSE.
+func (o Options) unixMountOptions() []string {
+	var opts []string
+	if o.AllowOther {
+		opts = append(opts, "allow_other")
+	}
+	if o.DefaultPermissions {
+		opts = append(opts, "default_permissions")
+	}
+	if o.AttrTimeout > 0 {
+		opts = append(opts, fmt.Sprintf("attr_timeout=%g", o.AttrTimeout.Seconds()))
+	}
+	if o.EntryTimeout > 0 {
+		opts = append(opts, fmt.Sprintf("entry_timeout=%g", o.EntryTimeout.Seconds()))
+	}
+	return opts
+}
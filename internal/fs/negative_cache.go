@@ -0,0 +1,87 @@
+package fs
+
+import (
+	"sync"
+	"time"
+
+	"github.com/bits-and-blooms/bloom/v3"
+	googleDrive "google.golang.org/api/drive/v3"
+)
+
+// lookupFilter answers "does this path exist?" for the common negative case
+// (tools probing .git/config, node_modules/... and so on) without touching
+// the index. A bloom filter over all known paths rules out most misses; the
+// few false positives are remembered for a short TTL. Plain bloom filters
+// cannot delete, so removed paths stay "maybe present" until the next
+// rebuild, which only costs an index lookup.
+type lookupFilter struct {
+	mu     sync.Mutex
+	filter *bloom.BloomFilter
+	misses map[string]time.Time
+	ttl    time.Duration
+}
+
+func newLookupFilter(ttl time.Duration) *lookupFilter {
+	return &lookupFilter{filter: bloom.NewWithEstimates(1024, 0.01), misses: make(map[string]time.Time), ttl: ttl}
+}
+
+// rebuild replaces the filter with one covering exactly the given index.
+func (l *lookupFilter) rebuild(index map[string]*googleDrive.File) {
+	n := uint(len(index)) * 2
+	if n < 1024 {
+		n = 1024
+	}
+	filter := bloom.NewWithEstimates(n, 0.01)
+	for path := range index {
+		filter.AddString(path)
+	}
+	l.mu.Lock()
+	l.filter = filter
+	l.misses = make(map[string]time.Time)
+	l.mu.Unlock()
+}
+
+// add records a path that now exists.
+func (l *lookupFilter) add(path string) {
+	l.mu.Lock()
+	l.filter.AddString(path)
+	delete(l.misses, path)
+	l.mu.Unlock()
+}
+
+// missing reports whether path is known not to exist.
+func (l *lookupFilter) missing(path string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.filter.TestString(path) {
+		return true
+	}
+	expiry, ok := l.misses[path]
+	if ok && time.Now().After(expiry) {
+		delete(l.misses, path)
+		return false
+	}
+	return ok
+}
+
+// recordMiss remembers a path that passed the filter but is not indexed.
+func (l *lookupFilter) recordMiss(path string) {
+	l.mu.Lock()
+	l.misses[path] = time.Now().Add(l.ttl)
+	l.mu.Unlock()
+}
+
+// lookup returns the index entry for path, consulting the negative
+// lookup filter first.
+func (fs *GDriveFS) lookup(cleaned string) (*googleDrive.File, bool) {
+	if fs.negative.missing(cleaned) {
+		return nil, false
+	}
+	fs.mu.RLock()
+	file, ok := fs.index[cleaned]
+	fs.mu.RUnlock()
+	if !ok {
+		fs.negative.recordMiss(cleaned)
+	}
+	return file, ok
+}
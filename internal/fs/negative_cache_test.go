@@ -0,0 +1,88 @@
+package fs
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	googleDrive "google.golang.org/api/drive/v3"
+)
+
+func TestLookupFilterKnownPaths(t *testing.T) {
+	index := make(map[string]*googleDrive.File)
+	for i := 0; i < 5000; i++ {
+		index[fmt.Sprintf("dir/file-%d", i)] = &googleDrive.File{}
+	}
+	l := newLookupFilter(time.Minute)
+	l.rebuild(index)
+	// a bloom filter has no false negatives
+	for path := range index {
+		if l.missing(path) {
+			t.Fatalf("indexed %s reported missing", path)
+		}
+	}
+	ruledOut := 0
+	for i := 0; i < 1000; i++ {
+		if l.missing(fmt.Sprintf("dir/.git/probe-%d", i)) {
+			ruledOut++
+		}
+	}
+	if ruledOut < 950 {
+		t.Errorf("only %d of 1000 unknown paths ruled out by the filter", ruledOut)
+	}
+}
+
+func TestLookupFilterMisses(t *testing.T) {
+	l := newLookupFilter(time.Minute)
+	l.rebuild(map[string]*googleDrive.File{})
+
+	// a path that passes the filter is remembered as missing once looked up
+	l.add("gone")
+	if l.missing("gone") {
+		t.Fatal("added path reported missing")
+	}
+	l.recordMiss("gone")
+	if !l.missing("gone") {
+		t.Error("recorded miss not remembered")
+	}
+	l.add("gone")
+	if l.missing("gone") {
+		t.Error("re-added path still reported missing")
+	}
+
+	l.recordMiss("gone")
+	l.rebuild(map[string]*googleDrive.File{"gone": {}})
+	if l.missing("gone") {
+		t.Error("rebuild kept a stale miss")
+	}
+}
+
+func TestLookupFilterMissExpires(t *testing.T) {
+	l := newLookupFilter(-time.Second)
+	l.add("a")
+	l.recordMiss("a")
+	if l.missing("a") {
+		t.Error("expired miss still reported")
+	}
+}
+
+func TestLookupRecordsMiss(t *testing.T) {
+	fs := newTestFS(t)
+	fs.index["a"] = &googleDrive.File{Name: "a"}
+	fs.negative.rebuild(fs.index)
+	// "a" passes the filter; dropping it from the index makes it a false
+	// positive the filter only learns from a lookup
+	delete(fs.index, "a")
+	if _, ok := fs.lookup("a"); ok {
+		t.Fatal("lookup found a removed path")
+	}
+	if !fs.negative.missing("a") {
+		t.Error("lookup miss not recorded")
+	}
+
+	fs.index["b"] = &googleDrive.File{Name: "b"}
+	fs.negative.add("b")
+	if f, ok := fs.lookup("b"); !ok || f.Name != "b" {
+		t.Error("added path not found")
+	}
+}
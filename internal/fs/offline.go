@@ -0,0 +1,503 @@
+package fs
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	p "path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"GDrive/internal/cache"
+	gdrive "GDrive/internal/drive"
+	googleDrive "google.golang.org/api/drive/v3"
+)
+
+const queueFileName = "queue.json"
+
+// opKind identifies the kind of change held in the offline queue.
+type opKind string
+
+const (
+	opUpload opKind = "upload"
+	opRename opKind = "rename"
+	opDelete opKind = "delete"
+)
+
+// queuedOp is a local change accepted while Drive was unreachable.
+// BaseVersion, BaseRevision and BaseModified record the remote state the
+// change was made against; if Drive no longer matches on replay the op is a
+// conflict.
+type queuedOp struct {
+	Seq          uint64    `json:"seq"`
+	Kind         opKind    `json:"kind"`
+	Path         string    `json:"path"`
+	NewPath      string    `json:"newPath,omitempty"`
+	FileID       string    `json:"fileId,omitempty"`
+	ParentID     string    `json:"parentId,omitempty"`
+	NewParentID  string    `json:"newParentId,omitempty"`
+	BaseVersion  int64     `json:"baseVersion,omitempty"`
+	BaseRevision string    `json:"baseRevision,omitempty"`
+	BaseModified string    `json:"baseModified,omitempty"`
+	Spool        string    `json:"spool,omitempty"`
+	Queued       time.Time `json:"queued"`
+	Error        string    `json:"error,omitempty"`
+}
+
+// base returns the remote state op was made against.
+func (op *queuedOp) base() *googleDrive.File {
+	return &googleDrive.File{Id: op.FileID, Version: op.BaseVersion, HeadRevisionId: op.BaseRevision, ModifiedTime: op.BaseModified}
+}
+
+// setBase records f as the remote state op is made against.
+func (op *queuedOp) setBase(f *googleDrive.File) {
+	op.FileID, op.BaseVersion, op.BaseRevision, op.BaseModified = f.Id, f.Version, f.HeadRevisionId, f.ModifiedTime
+}
+
+// conflictError reports that the remote file changed after the local base.
+type conflictError struct {
+	op     *queuedOp
+	remote *googleDrive.File
+}
+
+func (e *conflictError) Error() string {
+	return fmt.Sprintf("conflict on %s: base version %d (%s), remote version %d (%s)",
+		e.op.Path, e.op.BaseVersion, e.op.BaseModified, e.remote.Version, e.remote.ModifiedTime)
+}
+
+// opQueue is the persisted, ordered list of pending offline changes.
+// Ops that conflict or are rejected by Drive are parked in Conflicts
+// together with their spooled content so nothing written locally is lost.
+type opQueue struct {
+	mu        sync.Mutex
+	dir       string
+	NextSeq   uint64      `json:"nextSeq"`
+	Ops       []*queuedOp `json:"ops"`
+	Conflicts []*queuedOp `json:"conflicts"`
+}
+
+// loadQueue reads the queue from dir, returning an empty queue if none exists.
+func loadQueue(dir string) (*opQueue, error) {
+	q := &opQueue{dir: dir}
+	data, err := os.ReadFile(filepath.Join(dir, queueFileName))
+	if os.IsNotExist(err) {
+		return q, nil
+	}
+	if err != nil {
+		return q, fmt.Errorf("failed to read offline queue: %v", err)
+	}
+	if err := json.Unmarshal(data, q); err != nil {
+		return q, fmt.Errorf("failed to decode offline queue: %v", err)
+	}
+	return q, nil
+}
+
+// save persists the queue. Caller must hold q.mu.
+func (q *opQueue) save() {
+	data, err := json.MarshalIndent(q, "", "  ")
+	if err == nil {
+		err = cache.WriteFileAtomic(filepath.Join(q.dir, queueFileName), data)
+	}
+	if err != nil {
+		log.Printf("Failed to persist offline queue: %v", err)
+	}
+}
+
+// add appends op to the queue, spooling src as its content if given.
+func (q *opQueue) add(op *queuedOp, src string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.NextSeq++
+	op.Seq = q.NextSeq
+	op.Queued = time.Now()
+	if src != "" {
+		spool := filepath.Join(q.dir, "spool", strconv.FormatUint(op.Seq, 10))
+		if err := copyFile(src, spool); err != nil {
+			return fmt.Errorf("failed to spool %s: %v", op.Path, err)
+		}
+		op.Spool = spool
+	}
+	q.Ops = append(q.Ops, op)
+	q.save()
+	return nil
+}
+
+// takeUpload removes a pending upload for path and returns it, so that a
+// newer write, rename or delete of the same path can supersede it.
+func (q *opQueue) takeUpload(path string) *queuedOp {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i := len(q.Ops) - 1; i >= 0; i-- {
+		op := q.Ops[i]
+		if op.Kind == opUpload && op.Path == path {
+			q.Ops = append(q.Ops[:i], q.Ops[i+1:]...)
+			q.save()
+			return op
+		}
+	}
+	return nil
+}
+
+// repath moves the queued ops on files below the directory oldpath to
+// newpath, so their content is found and new files are created there.
+func (q *opQueue) repath(oldpath, newpath string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	prefix := oldpath + "/"
+	moved := false
+	for _, op := range q.Ops {
+		if strings.HasPrefix(op.Path, prefix) {
+			op.Path = newpath + "/" + strings.TrimPrefix(op.Path, prefix)
+			moved = true
+		}
+		if strings.HasPrefix(op.NewPath, prefix) {
+			op.NewPath = newpath + "/" + strings.TrimPrefix(op.NewPath, prefix)
+			moved = true
+		}
+	}
+	if moved {
+		q.save()
+	}
+}
+
+// pendingContent returns the spool file holding the newest queued content
+// for path, or "" if there is none.
+func (q *opQueue) pendingContent(path string) string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i := len(q.Ops) - 1; i >= 0; i-- {
+		if op := q.Ops[i]; op.Kind == opUpload && op.Path == path {
+			return op.Spool
+		}
+	}
+	return ""
+}
+
+// peek returns a copy of the oldest pending op without removing it, so it
+// can be replayed while writers change the queue.
+func (q *opQueue) peek() *queuedOp {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.Ops) == 0 {
+		return nil
+	}
+	op := *q.Ops[0]
+	return &op
+}
+
+// pending reports the number of queued ops.
+func (q *opQueue) pending() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.Ops)
+}
+
+// complete drops a successfully applied op and rebases later ops on the
+// same file onto the version Drive returned, so they don't self-conflict.
+// An op superseded while it was replayed is already gone, along with its
+// spool.
+func (q *opQueue) complete(op *queuedOp, result *googleDrive.File) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.dequeue(op) && op.Spool != "" {
+		os.Remove(op.Spool)
+	}
+	if result == nil || op.FileID == "" {
+		q.save()
+		return
+	}
+	for _, later := range q.Ops {
+		if later.FileID == op.FileID {
+			later.setBase(result)
+		}
+	}
+	q.save()
+}
+
+// park moves op out of the replay order into Conflicts. A superseded op is
+// not parked, the newer change replaces it.
+func (q *opQueue) park(op *queuedOp, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if !q.dequeue(op) {
+		return
+	}
+	op.Error = err.Error()
+	q.Conflicts = append(q.Conflicts, op)
+	q.save()
+}
+
+// dequeue removes op from the head of Ops and reports whether it was still
+// there. Caller must hold q.mu.
+func (q *opQueue) dequeue(op *queuedOp) bool {
+	if len(q.Ops) == 0 || q.Ops[0].Seq != op.Seq {
+		return false
+	}
+	q.Ops = q.Ops[1:]
+	return true
+}
+
+// copyFile copies src to dst, creating dst's directory.
+func copyFile(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0700); err != nil {
+		return err
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// isOffline reports whether the filesystem is serving without Drive.
+func (fs *GDriveFS) isOffline() bool {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+	return fs.offline
+}
+
+// setOffline switches offline mode on or off, logging transitions.
+func (fs *GDriveFS) setOffline(offline bool) {
+	fs.mu.Lock()
+	changed := fs.offline != offline
+	fs.offline = offline
+	fs.mu.Unlock()
+	if !changed {
+		return
+	}
+	if offline {
+		log.Println("Drive unreachable, switching to offline mode")
+	} else {
+		log.Println("Drive reachable again, offline mode ended")
+	}
+}
+
+// parentIDFor returns the Drive ID of the directory containing path.
+func (fs *GDriveFS) parentIDFor(path string) string {
+	parentPath := p.Dir(path)
+	if parentPath == "." || parentPath == "" {
+		return fs.Drive.Root()
+	}
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+	if pFile, ok := fs.index[parentPath]; ok && pFile.Id != "" {
+		return pFile.Id
+	}
+	return fs.Drive.Root()
+}
+
+// queueUpload records new content for path. base is the file the content
+// replaces, or nil for a newly created file.
+func (fs *GDriveFS) queueUpload(path, src string, base *googleDrive.File) {
+	op := &queuedOp{Kind: opUpload, Path: path, ParentID: fs.parentIDFor(path)}
+	if prev := fs.queue.takeUpload(path); prev != nil {
+		// Keep the original base so the conflict check still covers
+		// the whole offline session.
+		op.setBase(prev.base())
+		os.Remove(prev.Spool)
+	} else if base != nil && base.Id != "" {
+		op.setBase(base)
+	}
+	if err := fs.queue.add(op, src); err != nil {
+		log.Printf("Failed to queue upload of %s: %v", path, err)
+		return
+	}
+	log.Printf("Queued upload of %s for later sync", path)
+}
+
+// queueRename records a rename of file from oldpath to newpath.
+func (fs *GDriveFS) queueRename(oldpath, newpath string, file *googleDrive.File) {
+	if prev := fs.queue.takeUpload(oldpath); prev != nil {
+		// Pending content follows the file; a file that only exists
+		// locally is simply uploaded under its new name.
+		prev.Path = newpath
+		prev.ParentID = fs.parentIDFor(newpath)
+		fs.requeue(prev)
+	}
+	// changes to files in a renamed directory follow it
+	fs.queue.repath(oldpath, newpath)
+	if file.Id == "" {
+		return
+	}
+	op := &queuedOp{
+		Kind: opRename, Path: oldpath, NewPath: newpath,
+		ParentID: fs.parentIDFor(oldpath), NewParentID: fs.parentIDFor(newpath),
+	}
+	op.setBase(file)
+	if err := fs.queue.add(op, ""); err != nil {
+		log.Printf("Failed to queue rename of %s: %v", oldpath, err)
+	}
+}
+
+// queueDelete records removal of file at path.
+func (fs *GDriveFS) queueDelete(path string, file *googleDrive.File) {
+	if prev := fs.queue.takeUpload(path); prev != nil {
+		os.Remove(prev.Spool)
+		if prev.FileID == "" {
+			// Never reached Drive, nothing to delete remotely.
+			return
+		}
+	}
+	if file.Id == "" {
+		return
+	}
+	op := &queuedOp{Kind: opDelete, Path: path}
+	op.setBase(file)
+	if err := fs.queue.add(op, ""); err != nil {
+		log.Printf("Failed to queue delete of %s: %v", path, err)
+	}
+}
+
+// requeue appends an op taken from the queue back onto it, keeping its spool.
+func (fs *GDriveFS) requeue(op *queuedOp) {
+	spool := op.Spool
+	op.Spool = ""
+	if err := fs.queue.add(op, spool); err != nil {
+		log.Printf("Failed to requeue %s: %v", op.Path, err)
+	}
+	os.Remove(spool)
+}
+
+// replayQueue applies queued ops in order. It stops at the first network
+// or auth error so the remaining ops are retried on the next reconnect.
+func (fs *GDriveFS) replayQueue() error {
+	for op := fs.queue.peek(); op != nil; op = fs.queue.peek() {
+		result, err := fs.applyOp(op)
+		if err == nil {
+			log.Printf("Synced queued %s of %s", op.Kind, op.Path)
+			fs.queue.complete(op, result)
+			if op.Kind == opDelete {
+				result = op.base()
+			}
+			fs.announce(string(op.Kind), result)
+			continue
+		}
+		if gdrive.IsNetworkError(err) || gdrive.IsAuthError(err) {
+			return err
+		}
+		if err == errConflictDiscarded {
+			log.Printf("Queued %s of %s discarded, Drive has a newer version", op.Kind, op.Path)
+			fs.queue.complete(op, nil)
+			continue
+		}
+		if _, ok := err.(*conflictError); ok {
+			log.Printf("%v; local change kept in %s", err, fs.stateDir)
+		} else {
+			log.Printf("Queued %s of %s rejected by Drive: %v", op.Kind, op.Path, err)
+		}
+		fs.queue.park(op, err)
+	}
+	return nil
+}
+
+// applyOp performs a single queued op against Drive after checking that the
+// remote file is still the version the local change was based on. Changed
+// files are handed to the conflict policy.
+func (fs *GDriveFS) applyOp(op *queuedOp) (*googleDrive.File, error) {
+	if op.FileID == "" {
+		return fs.performOp(op)
+	}
+	remote, err := fs.Drive.GetFile(op.FileID)
+	if err != nil {
+		if op.Kind == opDelete && gdrive.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if op.Kind == opDelete && remote.Trashed {
+		return nil, nil
+	}
+	if !fs.changedOnDrive(op.base(), remote) {
+		return fs.performOp(op)
+	}
+
+	logConflict(op.Path, op.base(), remote, fs.conflictPolicy)
+	switch {
+	case fs.conflictPolicy == ConflictFail:
+		return nil, &conflictError{op: op, remote: remote}
+	case op.Kind == opUpload:
+		parentID := op.ParentID
+		if parentID == "" {
+			parentID = fs.parentIDFor(op.Path)
+		}
+		return fs.uploadConflicted(op.Path, op.FileID, parentID, op.Spool)
+	case fs.conflictPolicy == ConflictLocalWins:
+		return fs.performOp(op)
+	}
+	// keep-both and remote-wins leave the remote file as it is
+	return nil, errConflictDiscarded
+}
+
+// performOp applies op to Drive unconditionally.
+func (fs *GDriveFS) performOp(op *queuedOp) (*googleDrive.File, error) {
+	switch op.Kind {
+	case opUpload:
+		f, err := os.Open(op.Spool)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		if op.FileID != "" {
+			return fs.Drive.UpdateFileContent(op.FileID, f)
+		}
+		parentID := op.ParentID
+		if parentID == "" {
+			parentID = fs.parentIDFor(op.Path)
+		}
+		return fs.Drive.UploadFileToFolder(p.Base(op.Path), parentID, f)
+	case opRename:
+		return fs.Drive.MoveFile(op.FileID, p.Base(op.NewPath), op.ParentID, op.NewParentID)
+	case opDelete:
+		return nil, fs.Drive.TrashFile(op.FileID)
+	}
+	return nil, fmt.Errorf("unknown queued op %q", op.Kind)
+}
+
+// reconcile replays the queue and refreshes the index from Drive.
+func (fs *GDriveFS) reconcile() {
+	// changes queued by an earlier read-write mount wait for the next one
+	if !fs.readOnly {
+		if err := fs.replayQueue(); err != nil {
+			log.Printf("Replay of offline queue interrupted: %v", err)
+			return
+		}
+	}
+	if err := fs.buildIndex(); err != nil {
+		log.Printf("index refresh err: %v", err)
+		return
+	}
+	fs.setOffline(false)
+}
+
+// watchConnectivity probes Drive while offline or while changes are queued,
+// and reconciles as soon as it answers.
+func (fs *GDriveFS) watchConnectivity(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if fs.isOffline() || fs.queue.pending() > 0 {
+			if _, _, err := fs.Drive.GetQuota(); err == nil {
+				fs.reconcile()
+			}
+		}
+		select {
+		case <-fs.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package fs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	gdrive "GDrive/internal/drive"
+
+	googleDrive "google.golang.org/api/drive/v3"
+)
+
+// writeTemp writes content to a new file and returns its path.
+func writeTemp(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "content")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// readFile returns the content of path, or "" if it cannot be read.
+func readFile(path string) string {
+	data, _ := os.ReadFile(path)
+	return string(data)
+}
+
+func TestQueuePersists(t *testing.T) {
+	dir := t.TempDir()
+	q, err := loadQueue(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := writeTemp(t, "v1")
+	if err := q.add(&queuedOp{Kind: opUpload, Path: "a.txt", FileID: "f1", BaseVersion: 3}, src); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.add(&queuedOp{Kind: opRename, Path: "a.txt", NewPath: "b.txt", FileID: "f1", BaseVersion: 3}, ""); err != nil {
+		t.Fatal(err)
+	}
+	q.park(q.peek(), errConflictRejected)
+	// the spool is a copy, later writes to the source don't reach it
+	os.WriteFile(src, []byte("v2"), 0600)
+
+	loaded, err := loadQueue(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.NextSeq != 2 || len(loaded.Ops) != 1 || len(loaded.Conflicts) != 1 {
+		t.Fatalf("loaded queue = seq %d, %d ops, %d conflicts, want 2, 1, 1",
+			loaded.NextSeq, len(loaded.Ops), len(loaded.Conflicts))
+	}
+	if op := loaded.Ops[0]; op.Seq != 2 || op.Kind != opRename || op.NewPath != "b.txt" || op.BaseVersion != 3 {
+		t.Errorf("loaded op = %+v", op)
+	}
+	parked := loaded.Conflicts[0]
+	if parked.Error != errConflictRejected.Error() || readFile(parked.Spool) != "v1" {
+		t.Errorf("parked op = %+v with content %q", parked, readFile(parked.Spool))
+	}
+}
+
+func TestQueueMissing(t *testing.T) {
+	q, err := loadQueue(t.TempDir())
+	if err != nil || q.pending() != 0 || q.peek() != nil {
+		t.Errorf("loadQueue of empty dir = %d ops, %v", q.pending(), err)
+	}
+}
+
+func TestQueueUploadKeepsFirstBase(t *testing.T) {
+	fs := newTestFS(t)
+	newFakeDrive(t, fs)
+	base := &googleDrive.File{Id: "f1", Version: 3}
+	fs.queueUpload("a.txt", writeTemp(t, "first"), base)
+	fs.queueUpload("a.txt", writeTemp(t, "second"), &googleDrive.File{Id: "f1", Version: 4})
+
+	if n := fs.queue.pending(); n != 1 {
+		t.Fatalf("pending = %d, want 1", n)
+	}
+	op := fs.queue.peek()
+	if op.BaseVersion != 3 || readFile(op.Spool) != "second" {
+		t.Errorf("queued upload = base %d content %q, want base 3 content second", op.BaseVersion, readFile(op.Spool))
+	}
+	if readFile(fs.queue.pendingContent("a.txt")) != "second" {
+		t.Errorf("pendingContent is not the newest write")
+	}
+}
+
+func TestReplayQueue(t *testing.T) {
+	fs := newTestFS(t)
+	fd := newFakeDrive(t, fs, &googleDrive.File{Id: "f1", Name: "a.txt", Version: 3})
+	fs.queue.add(&queuedOp{Kind: opUpload, Path: "a.txt", FileID: "f1", BaseVersion: 3}, writeTemp(t, "new"))
+	fs.queue.add(&queuedOp{Kind: opRename, Path: "a.txt", NewPath: "b.txt", FileID: "f1", BaseVersion: 3}, "")
+	fs.queue.add(&queuedOp{Kind: opUpload, Path: "c.txt", ParentID: "root"}, writeTemp(t, "created"))
+	spool := fs.queue.Ops[0].Spool
+
+	if err := fs.replayQueue(); err != nil {
+		t.Fatalf("replayQueue = %v", err)
+	}
+	if fs.queue.pending() != 0 || len(fs.queue.Conflicts) != 0 {
+		t.Fatalf("after replay: %d ops, %d conflicts, want none", fs.queue.pending(), len(fs.queue.Conflicts))
+	}
+	// the rename was rebased onto the upload's version, not a conflict
+	if f, content := fd.file("f1"); f.Name != "b.txt" || content != "new" {
+		t.Errorf("f1 = %q with %q, want b.txt with new", f.Name, content)
+	}
+	if f := fd.byName("c.txt"); f == nil {
+		t.Error("c.txt was not created")
+	}
+	if _, err := os.Stat(spool); !os.IsNotExist(err) {
+		t.Errorf("spool of a synced upload was kept: %v", err)
+	}
+}
+
+func TestReplayQueueParksConflict(t *testing.T) {
+	fs := newTestFS(t)
+	fs.conflictPolicy = ConflictFail
+	fd := newFakeDrive(t, fs, &googleDrive.File{Id: "f1", Name: "a.txt", Version: 5})
+	fs.queue.add(&queuedOp{Kind: opUpload, Path: "a.txt", FileID: "f1", BaseVersion: 3}, writeTemp(t, "local"))
+
+	if err := fs.replayQueue(); err != nil {
+		t.Fatalf("replayQueue = %v", err)
+	}
+	if fs.queue.pending() != 0 || len(fs.queue.Conflicts) != 1 {
+		t.Fatalf("after replay: %d ops, %d conflicts, want 0, 1", fs.queue.pending(), len(fs.queue.Conflicts))
+	}
+	if parked := fs.queue.Conflicts[0]; parked.Error == "" || readFile(parked.Spool) != "local" {
+		t.Errorf("parked op = %+v with content %q", parked, readFile(parked.Spool))
+	}
+	if f, _ := fd.file("f1"); f.Version != 5 {
+		t.Errorf("remote version = %d, want 5 untouched", f.Version)
+	}
+}
+
+func TestReplayQueueStopsOffline(t *testing.T) {
+	fs := newTestFS(t)
+	fd := newFakeDrive(t, fs)
+	fd.Close()
+	fs.queue.add(&queuedOp{Kind: opUpload, Path: "a.txt", FileID: "f1", BaseVersion: 3}, writeTemp(t, "local"))
+
+	err := fs.replayQueue()
+	if !gdrive.IsNetworkError(err) {
+		t.Fatalf("replayQueue = %v, want a network error", err)
+	}
+	if fs.queue.pending() != 1 || len(fs.queue.Conflicts) != 0 {
+		t.Errorf("after failed replay: %d ops, %d conflicts, want 1, 0", fs.queue.pending(), len(fs.queue.Conflicts))
+	}
+}
+
+func TestRenameDirectoryOfflineMovesPending(t *testing.T) {
+	fs := newTestFS(t)
+	dir := &googleDrive.File{Id: "d1", Name: "dir", MimeType: gdrive.FolderMimeType, Parents: []string{"root"}}
+	file := &googleDrive.File{Id: "f1", Name: "a.txt", Parents: []string{"d1"}, Version: 3}
+	fd := newFakeDrive(t, fs, dir, file)
+	fs.index["dir"], fs.index["dir/a.txt"] = dir, file
+	fs.negative.rebuild(fs.index)
+	fs.setOffline(true)
+	fs.queueUpload("dir/a.txt", writeTemp(t, "local"), file)
+	fs.queueUpload("dir/new.txt", writeTemp(t, "created"), nil)
+
+	if errc := fs.Rename("/dir", "/moved"); errc != 0 {
+		t.Fatalf("Rename = %d", errc)
+	}
+	if spool := fs.queue.pendingContent("dir/a.txt"); spool != "" {
+		t.Errorf("pending content left at the old path: %s", spool)
+	}
+	if data, errc := fs.content("moved/a.txt"); errc != 0 || string(data) != "local" {
+		t.Errorf("content of moved/a.txt = %q, %d, want the pending local content", data, errc)
+	}
+
+	fs.setOffline(false)
+	if err := fs.replayQueue(); err != nil {
+		t.Fatalf("replayQueue = %v", err)
+	}
+	if fs.queue.pending() != 0 || len(fs.queue.Conflicts) != 0 {
+		t.Fatalf("after replay: %d ops, %d conflicts, want none", fs.queue.pending(), len(fs.queue.Conflicts))
+	}
+	if f, content := fd.file("f1"); content != "local" || f.Parents[0] != "d1" {
+		t.Errorf("f1 = %q in %v, want local in d1", content, f.Parents)
+	}
+	if f, _ := fd.file("d1"); f.Name != "moved" {
+		t.Errorf("directory name = %q, want moved", f.Name)
+	}
+	if f := fd.byName("new.txt"); f == nil || f.Parents[0] != "d1" {
+		t.Errorf("new.txt = %+v, want it created in the renamed directory", f)
+	}
+}
+
+func TestQueueCompleteSuperseded(t *testing.T) {
+	q := &opQueue{dir: t.TempDir()}
+	q.add(&queuedOp{Kind: opUpload, Path: "a.txt", FileID: "f1", BaseVersion: 3}, writeTemp(t, "old"))
+	op := q.peek()
+	op.Path = "changed"
+	if q.Ops[0].Path != "a.txt" {
+		t.Fatal("peek returned the queued op, not a copy")
+	}
+
+	// a newer write replaces the op while it is replayed
+	old := q.takeUpload("a.txt")
+	os.Remove(old.Spool)
+	q.add(&queuedOp{Kind: opUpload, Path: "a.txt", FileID: "f1", BaseVersion: 3}, writeTemp(t, "newer"))
+
+	q.complete(op, &googleDrive.File{Id: "f1", Version: 4})
+	if len(q.Ops) != 1 || readFile(q.Ops[0].Spool) != "newer" {
+		t.Fatalf("newer upload was dropped: %+v", q.Ops)
+	}
+	if q.Ops[0].BaseVersion != 4 {
+		t.Errorf("newer upload base = %d, want 4 from the replayed op", q.Ops[0].BaseVersion)
+	}
+	q.park(op, errConflictRejected)
+	if len(q.Ops) != 1 || len(q.Conflicts) != 0 {
+		t.Errorf("superseded op was parked: %d ops, %d conflicts", len(q.Ops), len(q.Conflicts))
+	}
+}
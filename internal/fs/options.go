@@ -0,0 +1,217 @@
+package fs
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"GDrive/internal/cache"
+)
+
+// Options configures a mount. Zero values select the defaults.
+type Options struct {
+	// StateDir holds the persisted index and the offline operation queue.
+	// Defaults to GDriveFS under the user cache directory.
+	StateDir string
+
+	// ControlSocket is the Unix socket a running mount accepts commands on.
+	// Defaults to "control.sock" under StateDir.
+	ControlSocket string
+
+	// ReconnectInterval is how often Drive is probed while offline.
+	ReconnectInterval time.Duration
+
+	// ConflictPolicy resolves writes to files changed remotely since they
+	// were opened. Defaults to ConflictKeepBoth.
+	ConflictPolicy ConflictPolicy
+
+	// NegativeTTL is how long a path found missing is remembered.
+	// Defaults to 5 seconds.
+	NegativeTTL time.Duration
+
+	// MemoryMaxBytes and MemoryMaxEntries bound the in-process content
+	// cache. Default to 512 MiB and 10000 entries.
+	MemoryMaxBytes   int64
+	MemoryMaxEntries int
+
+	// BlockCacheMaxBytes enables the persistent on-disk block cache with
+	// this size cap. Zero disables it.
+	BlockCacheMaxBytes int64
+
+	// BlockCacheDir is where blocks are stored across remounts.
+	// Defaults to "blocks" under StateDir.
+	BlockCacheDir string
+
+	// BlockSize is the unit fetched from Drive and cached. Defaults to 4 MiB.
+	BlockSize int64
+
+	// DisablePrefetch turns off background readahead and sibling prefetch.
+	DisablePrefetch bool
+
+	// PrefetchWorkers is the number of concurrent prefetch downloads.
+	// Defaults to 4.
+	PrefetchWorkers int
+
+	// PrefetchMaxWindow caps the sequential readahead window. It starts at
+	// one block and doubles while reads stay sequential. Defaults to 64 MiB.
+	PrefetchMaxWindow int64
+
+	// PrefetchSiblings caps how many following files of a directory read
+	// in name order are fetched ahead. Defaults to 8.
+	PrefetchSiblings int
+
+	// PrefetchBandwidth limits prefetch downloads in bytes per second.
+	// Zero means unlimited.
+	PrefetchBandwidth int64
+
+	// PrefetchMemory bounds the bytes being prefetched at once; whole files
+	// larger than this are never prefetched. Defaults to 128 MiB.
+	PrefetchMemory int64
+
+	// Cache selects the second-level content cache behind the in-process
+	// one: cache.BackendMemory, cache.BackendDisk, cache.BackendRedis, or
+	// empty for none. Setting only RedisAddr selects Redis.
+	Cache string
+
+	// CacheDir is where the disk cache keeps content.
+	// Defaults to "cache" under StateDir.
+	CacheDir string
+
+	// CacheMaxBytes bounds the memory and disk caches. Defaults to 10 GiB.
+	CacheMaxBytes int64
+
+	// RedisAddr is the Redis server shared between mounts,
+	// e.g. "localhost:6379".
+	RedisAddr string
+
+	// RedisTTL is how long downloaded content is kept in Redis.
+	RedisTTL time.Duration
+
+	// RedisChannel is the pub/sub channel on RedisAddr used to tell other
+	// mounts about uploads, renames and deletes. Defaults to
+	// "gdrivefs:invalidate".
+	RedisChannel string
+
+	// Lock selects where write leases shared between mounts are kept:
+	// lock.BackendRedis (on RedisAddr), lock.BackendDrive (appProperties of
+	// the file or its parent folder), or empty for no leases.
+	Lock string
+
+	// LockTTL is how long a lease survives without renewal, which bounds
+	// how long a crashed mount blocks other writers. Defaults to 30 seconds.
+	LockTTL time.Duration
+
+	// ExclusiveCreate makes every create fail with EEXIST if the path
+	// already exists, as if O_EXCL had been passed.
+	ExclusiveCreate bool
+
+	// ReadOnly makes every change through the mount fail with EROFS, and
+	// mounts read-only on Linux and macOS.
+	ReadOnly bool
+
+	// MountOptions are extra FUSE options passed as "-o opt", after the
+	// ones chosen for the current OS.
+	MountOptions []string
+
+	// Debug makes FUSE trace every filesystem call.
+	Debug bool
+
+	// AllowOther lets other users access the mount (Linux and macOS; needs
+	// user_allow_other in /etc/fuse.conf when not mounting as root).
+	AllowOther bool
+
+	// DefaultPermissions makes the kernel check file modes (Linux and macOS).
+	DefaultPermissions bool
+
+	// AttrTimeout and EntryTimeout are how long the kernel caches attributes
+	// and name lookups (Linux and macOS). Zero keeps the FUSE default.
+	AttrTimeout  time.Duration
+	EntryTimeout time.Duration
+}
+
+// DefaultControlSocket is where a mount with default options listens.
+func DefaultControlSocket() string {
+	return Options{}.SocketPath()
+}
+
+// SocketPath is where a mount with these options listens.
+func (o Options) SocketPath() string {
+	return o.withDefaults().ControlSocket
+}
+
+// withDefaults fills in unset fields.
+func (o Options) withDefaults() Options {
+	if o.StateDir == "" {
+		dir, err := os.UserCacheDir()
+		if err != nil {
+			dir = os.TempDir()
+		}
+		o.StateDir = filepath.Join(dir, "GDriveFS")
+	}
+	if o.ControlSocket == "" {
+		o.ControlSocket = filepath.Join(o.StateDir, "control.sock")
+	}
+	if o.ReconnectInterval == 0 {
+		o.ReconnectInterval = 30 * time.Second
+	}
+	if o.NegativeTTL == 0 {
+		o.NegativeTTL = 5 * time.Second
+	}
+	if o.MemoryMaxBytes == 0 {
+		o.MemoryMaxBytes = 512 << 20
+	}
+	if o.MemoryMaxEntries == 0 {
+		o.MemoryMaxEntries = 10000
+	}
+	if o.BlockCacheDir == "" {
+		o.BlockCacheDir = filepath.Join(o.StateDir, "blocks")
+	}
+	if o.BlockSize == 0 {
+		o.BlockSize = 4 << 20
+	}
+	if o.PrefetchWorkers == 0 {
+		o.PrefetchWorkers = 4
+	}
+	if o.PrefetchMaxWindow == 0 {
+		o.PrefetchMaxWindow = 64 << 20
+	}
+	if o.PrefetchSiblings == 0 {
+		o.PrefetchSiblings = 8
+	}
+	if o.PrefetchMemory == 0 {
+		o.PrefetchMemory = 128 << 20
+	}
+	if o.Cache == "" && o.RedisAddr != "" {
+		o.Cache = cache.BackendRedis
+	}
+	if o.CacheDir == "" {
+		o.CacheDir = filepath.Join(o.StateDir, "cache")
+	}
+	if o.CacheMaxBytes == 0 {
+		o.CacheMaxBytes = 10 << 30
+	}
+	if o.RedisChannel == "" {
+		o.RedisChannel = "gdrivefs:invalidate"
+	}
+	if o.RedisTTL == 0 {
+		o.RedisTTL = 24 * time.Hour
+	}
+	if o.LockTTL == 0 {
+		o.LockTTL = 30 * time.Second
+	}
+	if o.ConflictPolicy == "" {
+		o.ConflictPolicy = ConflictKeepBoth
+	}
+	return o
+}
+
+// cacheConfig describes the second-level cache selected by o.
+func (o Options) cacheConfig() cache.Config {
+	return cache.Config{
+		Backend:   o.Cache,
+		MaxBytes:  o.CacheMaxBytes,
+		Dir:       o.CacheDir,
+		RedisAddr: o.RedisAddr,
+		TTL:       o.RedisTTL,
+	}
+}
@@ -0,0 +1,426 @@
+package fs
+
+import (
+	"fmt"
+	"log"
+	p "path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	googleDrive "google.golang.org/api/drive/v3"
+)
+
+// PrefetchStats reports how well prefetching predicts reads.
+type PrefetchStats struct {
+	Issued    uint64 // prefetch jobs queued
+	Fetched   uint64 // jobs that downloaded data
+	Bytes     uint64 // bytes downloaded by prefetch
+	Hits      uint64 // reads served from prefetched data
+	Dropped   uint64 // jobs skipped because the queue or budget was full
+	Sequences uint64 // sequential streams detected
+	Siblings  uint64 // sibling sequences detected
+}
+
+// HitRate is the fraction of fetched jobs that were later read.
+func (s PrefetchStats) HitRate() float64 {
+	if s.Fetched == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Fetched)
+}
+
+func (s PrefetchStats) String() string {
+	return fmt.Sprintf("%d issued, %d fetched (%d bytes), %d hits (%.0f%%), %d dropped, %d sequential streams, %d sibling runs",
+		s.Issued, s.Fetched, s.Bytes, s.Hits, s.HitRate()*100, s.Dropped, s.Sequences, s.Siblings)
+}
+
+// prefetchedTTL is how long prefetched data is waited on to be read before
+// it counts as a miss.
+const prefetchedTTL = 10 * time.Minute
+
+// prefetchJob is a unit of background work: one block of a file, or a whole
+// file when the block cache is off.
+type prefetchJob struct {
+	key   string
+	path  string
+	file  *googleDrive.File
+	block int64 // -1 for a whole file
+	size  int64
+}
+
+// stream tracks sequential reads within one file.
+type stream struct {
+	next   int64 // offset right after the last read
+	window int64 // current readahead in bytes
+	ahead  int64 // offset up to which prefetch was issued
+}
+
+// dirRun tracks in-order access to the files of one directory.
+type dirRun struct {
+	last string
+	run  int
+}
+
+// prefetcher watches reads and downloads what is likely to be read next:
+// growing readahead within sequentially read files, and the following
+// files of a directory being walked in name order. Work is done by a fixed
+// pool of workers within a bandwidth and an in-flight memory budget.
+type prefetcher struct {
+	fs   *GDriveFS
+	opts Options
+
+	mu         sync.Mutex
+	streams    map[string]*stream
+	dirs       map[string]*dirRun
+	listings   map[string][]string // dir -> sorted child names
+	inflight   map[string]bool
+	prefetched map[string]time.Time // key -> when it was fetched
+	budgetUsed int64
+
+	jobs    chan prefetchJob
+	limiter *rateLimiter
+	stats   PrefetchStats
+}
+
+func newPrefetcher(fs *GDriveFS, opts Options) *prefetcher {
+	pf := &prefetcher{
+		fs:         fs,
+		opts:       opts,
+		streams:    make(map[string]*stream),
+		dirs:       make(map[string]*dirRun),
+		listings:   make(map[string][]string),
+		inflight:   make(map[string]bool),
+		prefetched: make(map[string]time.Time),
+		jobs:       make(chan prefetchJob, 256),
+		limiter:    newRateLimiter(opts.PrefetchBandwidth),
+	}
+	for i := 0; i < opts.PrefetchWorkers; i++ {
+		go pf.worker()
+	}
+	return pf
+}
+
+// observe is called after every successful read.
+func (pf *prefetcher) observe(path string, file *googleDrive.File, offset int64, n int) {
+	if pf == nil || file.Id == "" || file.Size <= 0 {
+		return
+	}
+	pf.observeSequential(path, file, offset, int64(n))
+	if offset == 0 {
+		pf.observeSibling(path)
+	}
+}
+
+// observeSequential grows a readahead window while reads stay contiguous.
+func (pf *prefetcher) observeSequential(path string, file *googleDrive.File, offset, n int64) {
+	if !pf.fs.useBlocks(file) {
+		// whole files are fetched on first read, nothing to read ahead
+		return
+	}
+	bs := pf.fs.blocks.BlockSize()
+	pf.mu.Lock()
+	st, ok := pf.streams[file.Id]
+	if !ok || offset != st.next {
+		st = &stream{window: bs}
+		pf.streams[file.Id] = st
+	} else if st.window < pf.opts.PrefetchMaxWindow {
+		if st.window == bs {
+			pf.stats.Sequences++
+		}
+		st.window *= 2
+		if st.window > pf.opts.PrefetchMaxWindow {
+			st.window = pf.opts.PrefetchMaxWindow
+		}
+	}
+	st.next = offset + n
+	from := st.next
+	if st.ahead > from {
+		from = st.ahead
+	}
+	to := st.next + st.window
+	if to > file.Size {
+		to = file.Size
+	}
+	if to > st.ahead {
+		st.ahead = to
+	}
+	pf.mu.Unlock()
+
+	for idx := from / bs; idx*bs < to; idx++ {
+		pf.enqueueBlock(path, file, idx)
+	}
+}
+
+// observeSibling detects a directory being read in name order and queues
+// the next files.
+func (pf *prefetcher) observeSibling(path string) {
+	dir, name := p.Dir(path), p.Base(path)
+	names := pf.listing(dir)
+	pos := sort.SearchStrings(names, name)
+	if pos >= len(names) || names[pos] != name {
+		return
+	}
+
+	pf.mu.Lock()
+	run, ok := pf.dirs[dir]
+	if !ok {
+		run = &dirRun{}
+		pf.dirs[dir] = run
+	}
+	prev := sort.SearchStrings(names, run.last)
+	if run.last != "" && prev < len(names) && names[prev] == run.last && prev+1 == pos {
+		run.run++
+		if run.run == 2 {
+			pf.stats.Siblings++
+		}
+	} else {
+		run.run = 0
+	}
+	run.last = name
+	ahead := run.run
+	pf.mu.Unlock()
+
+	// wait for two consecutive steps before trusting the pattern, then
+	// look further ahead the longer the run goes on
+	if ahead < 2 {
+		return
+	}
+	if ahead > pf.opts.PrefetchSiblings {
+		ahead = pf.opts.PrefetchSiblings
+	}
+	for _, next := range names[pos+1 : min(pos+1+ahead, len(names))] {
+		nextPath := next
+		if dir != "." {
+			nextPath = dir + "/" + next
+		}
+		pf.fs.mu.RLock()
+		file, ok := pf.fs.index[nextPath]
+		pf.fs.mu.RUnlock()
+		if !ok || file.Id == "" || file.MimeType == "application/vnd.google-apps.folder" {
+			continue
+		}
+		if pf.fs.useBlocks(file) {
+			pf.enqueueBlock(nextPath, file, 0)
+		} else if file.Size <= pf.opts.PrefetchMemory {
+			pf.enqueue(prefetchJob{key: contentKey(file), path: nextPath, file: file, block: -1, size: file.Size})
+		}
+	}
+}
+
+// listing returns the sorted child names of dir, cached until the index
+// is rebuilt.
+func (pf *prefetcher) listing(dir string) []string {
+	pf.mu.Lock()
+	names, ok := pf.listings[dir]
+	pf.mu.Unlock()
+	if ok {
+		return names
+	}
+	prefix := ""
+	if dir != "." {
+		prefix = dir + "/"
+	}
+	pf.fs.mu.RLock()
+	for key := range pf.fs.index {
+		if rest := strings.TrimPrefix(key, prefix); strings.HasPrefix(key, prefix) && rest != "" && !strings.Contains(rest, "/") {
+			names = append(names, rest)
+		}
+	}
+	pf.fs.mu.RUnlock()
+	sort.Strings(names)
+	pf.mu.Lock()
+	pf.listings[dir] = names
+	pf.mu.Unlock()
+	return names
+}
+
+// reset forgets cached listings after the index changed.
+func (pf *prefetcher) reset() {
+	if pf == nil {
+		return
+	}
+	pf.mu.Lock()
+	pf.listings = make(map[string][]string)
+	pf.mu.Unlock()
+}
+
+// enqueueBlock queues block idx of file unless it is already cached.
+func (pf *prefetcher) enqueueBlock(path string, file *googleDrive.File, idx int64) {
+	bs := pf.fs.blocks.BlockSize()
+	if idx*bs >= file.Size || pf.fs.blocks.HasBlock(file.Id, blockVersion(file), idx) {
+		return
+	}
+	size := bs
+	if rest := file.Size - idx*bs; rest < size {
+		size = rest
+	}
+	pf.enqueue(prefetchJob{key: blockKey(file, idx), path: path, file: file, block: idx, size: size})
+}
+
+// enqueue hands job to the workers if it fits the memory budget.
+func (pf *prefetcher) enqueue(job prefetchJob) {
+	pf.mu.Lock()
+	if _, done := pf.prefetched[job.key]; done || pf.inflight[job.key] {
+		pf.mu.Unlock()
+		return
+	}
+	if pf.budgetUsed+job.size > pf.opts.PrefetchMemory {
+		pf.stats.Dropped++
+		pf.mu.Unlock()
+		return
+	}
+	pf.inflight[job.key] = true
+	pf.budgetUsed += job.size
+	pf.stats.Issued++
+	pf.mu.Unlock()
+
+	select {
+	case pf.jobs <- job:
+	default:
+		pf.finish(job, false)
+		pf.mu.Lock()
+		pf.stats.Dropped++
+		pf.mu.Unlock()
+	}
+}
+
+// worker runs prefetch jobs until the filesystem is destroyed.
+func (pf *prefetcher) worker() {
+	for {
+		select {
+		case <-pf.fs.stop:
+			return
+		case job := <-pf.jobs:
+			if pf.fs.isOffline() {
+				pf.finish(job, false)
+				continue
+			}
+			pf.limiter.wait(job.size)
+			var errc int
+			if job.block >= 0 {
+				_, errc = pf.fs.block(job.file, job.block)
+			} else {
+				_, errc = pf.fs.content(job.path)
+			}
+			pf.finish(job, errc == 0)
+		}
+	}
+}
+
+// finish releases a job's budget and records a successful fetch.
+func (pf *prefetcher) finish(job prefetchJob, fetched bool) {
+	pf.mu.Lock()
+	defer pf.mu.Unlock()
+	delete(pf.inflight, job.key)
+	pf.budgetUsed -= job.size
+	if fetched {
+		pf.prefetched[job.key] = time.Now()
+		pf.stats.Fetched++
+		pf.stats.Bytes += uint64(job.size)
+	}
+}
+
+// hit records a read served by prefetched data.
+func (pf *prefetcher) hit(key string) {
+	if pf == nil {
+		return
+	}
+	pf.mu.Lock()
+	if _, ok := pf.prefetched[key]; ok {
+		delete(pf.prefetched, key)
+		pf.stats.Hits++
+	}
+	pf.mu.Unlock()
+}
+
+// forget drops the sequential stream of a closed file.
+func (pf *prefetcher) forget(fileID string) {
+	if pf == nil {
+		return
+	}
+	pf.mu.Lock()
+	delete(pf.streams, fileID)
+	pf.mu.Unlock()
+}
+
+// expire forgets prefetched data fetched before cutoff that was never read;
+// it counts as a miss.
+func (pf *prefetcher) expire(cutoff time.Time) {
+	pf.mu.Lock()
+	defer pf.mu.Unlock()
+	for key, fetched := range pf.prefetched {
+		if fetched.Before(cutoff) {
+			delete(pf.prefetched, key)
+		}
+	}
+}
+
+// Stats returns a snapshot of the prefetch counters.
+func (pf *prefetcher) Stats() PrefetchStats {
+	if pf == nil {
+		return PrefetchStats{}
+	}
+	pf.mu.Lock()
+	defer pf.mu.Unlock()
+	return pf.stats
+}
+
+// blockKey identifies a block for prefetch bookkeeping.
+func blockKey(file *googleDrive.File, idx int64) string {
+	return fmt.Sprintf("%s#%d", contentKey(file), idx)
+}
+
+// rateLimiter is a token bucket over bytes per second.
+type rateLimiter struct {
+	rate   int64
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(bytesPerSec int64) *rateLimiter {
+	return &rateLimiter{rate: bytesPerSec, tokens: float64(bytesPerSec), last: time.Now()}
+}
+
+// wait blocks until n bytes may be transferred. A zero rate is unlimited.
+func (r *rateLimiter) wait(n int64) {
+	if r.rate <= 0 {
+		return
+	}
+	r.mu.Lock()
+	now := time.Now()
+	r.tokens += now.Sub(r.last).Seconds() * float64(r.rate)
+	if r.tokens > float64(r.rate) {
+		r.tokens = float64(r.rate)
+	}
+	r.last = now
+	r.tokens -= float64(n)
+	deficit := -r.tokens
+	r.mu.Unlock()
+	if deficit > 0 {
+		time.Sleep(time.Duration(deficit / float64(r.rate) * float64(time.Second)))
+	}
+}
+
+// prefetchLog periodically logs prefetch statistics while enabled, and
+// expires prefetched data not read within prefetchedTTL.
+func (pf *prefetcher) prefetchLog(interval time.Duration) {
+	var last uint64
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-pf.fs.stop:
+			return
+		case now := <-ticker.C:
+			pf.expire(now.Add(-prefetchedTTL))
+			st := pf.Stats()
+			if st.Issued != last {
+				last = st.Issued
+				log.Printf("Prefetch: %s", st)
+			}
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package fs
+
+import (
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"GDrive/internal/cache"
+
+	googleDrive "google.golang.org/api/drive/v3"
+)
+
+// newTestPrefetcher gives fs a block cache of 16 byte blocks and a
+// prefetcher without workers, so queued jobs stay in flight.
+func newTestPrefetcher(t *testing.T, fs *GDriveFS) *prefetcher {
+	t.Helper()
+	blocks, err := cache.NewBlockCache(t.TempDir(), 0, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs.blocks = blocks
+	fs.prefetch = &prefetcher{
+		fs:         fs,
+		opts:       Options{PrefetchMaxWindow: 64, PrefetchSiblings: 2, PrefetchMemory: 1 << 20},
+		streams:    make(map[string]*stream),
+		dirs:       make(map[string]*dirRun),
+		listings:   make(map[string][]string),
+		inflight:   make(map[string]bool),
+		prefetched: make(map[string]time.Time),
+		jobs:       make(chan prefetchJob, 256),
+		limiter:    newRateLimiter(0),
+	}
+	return fs.prefetch
+}
+
+// queued returns the sorted keys of the queued prefetch jobs.
+func (pf *prefetcher) queued() []string {
+	pf.mu.Lock()
+	defer pf.mu.Unlock()
+	var keys []string
+	for key := range pf.inflight {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// blockKeys returns the sorted keys of blocks idx of file.
+func blockKeys(file *googleDrive.File, idx ...int64) []string {
+	var keys []string
+	for _, i := range idx {
+		keys = append(keys, blockKey(file, i))
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestPrefetchSequentialStream(t *testing.T) {
+	fs := newTestFS(t)
+	pf := newTestPrefetcher(t, fs)
+	file := &googleDrive.File{Id: "f1", Name: "a.bin", Size: 1000, Version: 1}
+	fs.index["a.bin"] = file
+
+	// each contiguous read doubles the window, up to 64 bytes
+	steps := []struct {
+		offset int64
+		window int64
+		queued []int64
+	}{
+		{0, 16, []int64{1}},
+		{16, 32, []int64{1, 2, 3}},
+		{32, 64, []int64{1, 2, 3, 4, 5, 6}},
+		{48, 64, []int64{1, 2, 3, 4, 5, 6, 7}},
+	}
+	for _, step := range steps {
+		pf.observe("a.bin", file, step.offset, 16)
+		if st := pf.streams["f1"]; st == nil || st.window != step.window {
+			t.Fatalf("after read at %d: stream = %+v, want window %d", step.offset, st, step.window)
+		}
+		if got, want := pf.queued(), blockKeys(file, step.queued...); strings.Join(got, " ") != strings.Join(want, " ") {
+			t.Errorf("after read at %d: queued %v, want %v", step.offset, got, want)
+		}
+	}
+	if s := pf.Stats(); s.Sequences != 1 || s.Issued != 7 {
+		t.Errorf("stats = %+v, want 1 sequence and 7 jobs", s)
+	}
+
+	// a jump starts over
+	pf.observe("a.bin", file, 500, 16)
+	if st := pf.streams["f1"]; st.window != 16 || st.next != 516 {
+		t.Errorf("after jump: stream = %+v, want window 16 at 516", st)
+	}
+
+	fs.Release("/a.bin", 7)
+	if _, ok := pf.streams["f1"]; ok {
+		t.Error("stream kept after Release")
+	}
+}
+
+// readWhole caches the single block of file as reading it does, and shows
+// the read to pf.
+func readWhole(t *testing.T, pf *prefetcher, path string, file *googleDrive.File) {
+	t.Helper()
+	if err := pf.fs.blocks.WriteBlock(file.Id, blockVersion(file), 0, make([]byte, file.Size)); err != nil {
+		t.Fatal(err)
+	}
+	pf.observe(path, file, 0, int(file.Size))
+}
+
+func TestPrefetchSiblings(t *testing.T) {
+	fs := newTestFS(t)
+	pf := newTestPrefetcher(t, fs)
+	fs.index["dir"] = &googleDrive.File{Id: "d", Name: "dir", MimeType: "application/vnd.google-apps.folder"}
+	files := make(map[string]*googleDrive.File)
+	for _, name := range []string{"a", "b", "c", "d", "e", "f"} {
+		files[name] = &googleDrive.File{Id: "id-" + name, Name: name, Size: 10, Version: 1}
+		fs.index["dir/"+name] = files[name]
+	}
+
+	// two steps in name order are needed before anything is prefetched
+	for _, name := range []string{"a", "b"} {
+		readWhole(t, pf, "dir/"+name, files[name])
+	}
+	if got := pf.queued(); len(got) != 0 {
+		t.Fatalf("queued %v after two files, want nothing", got)
+	}
+	readWhole(t, pf, "dir/c", files["c"])
+	want := append(blockKeys(files["d"], 0), blockKeys(files["e"], 0)...)
+	sort.Strings(want)
+	if got := pf.queued(); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("queued %v, want the first block of d and e", got)
+	}
+	if s := pf.Stats(); s.Siblings != 1 {
+		t.Errorf("stats = %+v, want 1 sibling run", s)
+	}
+
+	// going back breaks the run
+	readWhole(t, pf, "dir/a", files["a"])
+	if run := pf.dirs["dir"]; run.run != 0 || run.last != "a" {
+		t.Errorf("run after going back = %+v", run)
+	}
+}
+
+func TestPrefetchExpire(t *testing.T) {
+	fs := newTestFS(t)
+	pf := newTestPrefetcher(t, fs)
+	now := time.Now()
+	pf.prefetched["old"] = now.Add(-time.Hour)
+	pf.prefetched["new"] = now
+
+	pf.expire(now.Add(-prefetchedTTL))
+	if _, ok := pf.prefetched["old"]; ok {
+		t.Error("unread prefetch older than the TTL kept")
+	}
+	pf.hit("old")
+	pf.hit("new")
+	if s := pf.Stats(); s.Hits != 1 || len(pf.prefetched) != 0 {
+		t.Errorf("hits = %d with %d prefetched left, want 1 and 0", s.Hits, len(pf.prefetched))
+	}
+}
@@ -0,0 +1,127 @@
+package fs
+
+import (
+	gdrive "GDrive/internal/drive"
+	"log"
+	p "path"
+	"strings"
+
+	"github.com/winfsp/cgofuse/fuse"
+	googleDrive "google.golang.org/api/drive/v3"
+)
+
+// sharedDrive is a shared drive's top folder with the files in it.
+type sharedDrive struct {
+	folder *googleDrive.File
+	files  []*googleDrive.File
+}
+
+// listSharedDrives lists the shared drives and their files for the index,
+// or nothing if they are not shown. Failing to list the drives themselves
+// only leaves them out, e.g. with a token whose scopes do not cover them.
+func (fs *GDriveFS) listSharedDrives() ([]sharedDrive, error) {
+	if !fs.Drive.SharedDrives() {
+		return nil, nil
+	}
+	folders, err := fs.Drive.ListSharedDrives()
+	if gdrive.IsNetworkError(err) {
+		return nil, err
+	}
+	if err != nil {
+		log.Printf("Shared drives left out: %v", err)
+		return nil, nil
+	}
+	drives := make([]sharedDrive, 0, len(folders))
+	for _, folder := range folders {
+		files, err := fs.Drive.ListDriveFiles(folder.Id)
+		if err != nil {
+			return nil, err
+		}
+		drives = append(drives, sharedDrive{folder: folder, files: files})
+	}
+	return drives, nil
+}
+
+// addSharedDrives adds the SharedDrives folder with the given drives to
+// index. A My Drive folder of the same name is hidden behind it.
+func addSharedDrives(index map[string]*googleDrive.File, drives []sharedDrive) {
+	top := gdrive.SharedDrivesFolder()
+	addVirtualFolder(index, top)
+	for _, drv := range drives {
+		prefix := p.Join(top.Name, drv.folder.Name)
+		index[prefix] = drv.folder
+		addTree(index, drv.files, map[string]string{drv.folder.Id: prefix})
+	}
+}
+
+// addVirtualFolder adds a virtual folder at the top of index, hiding a My
+// Drive folder of the same name.
+func addVirtualFolder(index map[string]*googleDrive.File, folder *googleDrive.File) {
+	top := folder.Name
+	if _, ok := index[top]; ok {
+		log.Printf("%s in My Drive is hidden by the virtual folder of that name", top)
+		for path := range index {
+			if path == top || strings.HasPrefix(path, top+"/") {
+				delete(index, path)
+			}
+		}
+	}
+	index[top] = folder
+}
+
+// canEdit reports whether the content of f may be changed. Files not on
+// Drive yet and files listed without capabilities may be.
+func canEdit(f *googleDrive.File) bool {
+	return f.Capabilities == nil || f.Capabilities.CanEdit
+}
+
+// canAddTo reports whether a file may be created at path, judging by the
+// capabilities of the folder it goes in.
+func (fs *GDriveFS) canAddTo(path string) bool {
+	dir := p.Dir(path)
+	if dir == "." {
+		return true
+	}
+	fs.mu.RLock()
+	parent, ok := fs.index[dir]
+	fs.mu.RUnlock()
+	return !ok || parent.Capabilities == nil || parent.Capabilities.CanAddChildren
+}
+
+// checkRename returns the error for moving f from oldpath to newpath if
+// its capabilities forbid that, or 0. Moves between drives are left to
+// Drive, which decides them by ownership and the drives' settings.
+func (fs *GDriveFS) checkRename(f *googleDrive.File, oldpath, newpath string) int {
+	if gdrive.IsVirtual(f) {
+		return -fuse.EPERM
+	}
+	if !fs.canAddTo(newpath) {
+		return -fuse.EACCES
+	}
+	caps := f.Capabilities
+	if caps == nil {
+		return 0
+	}
+	if p.Base(oldpath) != p.Base(newpath) && !caps.CanRename {
+		return -fuse.EACCES
+	}
+	if p.Dir(oldpath) != p.Dir(newpath) && f.DriveId != "" && f.DriveId == fs.driveOf(newpath) && !caps.CanMoveItemWithinDrive {
+		return -fuse.EACCES
+	}
+	return 0
+}
+
+// driveOf returns the ID of the shared drive the folder containing path
+// is in, or "" for My Drive.
+func (fs *GDriveFS) driveOf(path string) string {
+	dir := p.Dir(path)
+	if dir == "." {
+		return fs.Drive.RootDrive()
+	}
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+	if parent, ok := fs.index[dir]; ok {
+		return parent.DriveId
+	}
+	return ""
+}
@@ -0,0 +1,47 @@
+package fs
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	gdrive "GDrive/internal/drive"
+
+	googleDrive "google.golang.org/api/drive/v3"
+)
+
+// indexPaths returns the paths in index, sorted.
+func indexPaths(index map[string]*googleDrive.File) string {
+	paths := make([]string, 0, len(index))
+	for path := range index {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return strings.Join(paths, ",")
+}
+
+func TestAddSharedDrives(t *testing.T) {
+	index := make(map[string]*googleDrive.File)
+	addTree(index, []*googleDrive.File{
+		{Id: "d1", Name: "doc.txt", Parents: []string{"rootid"}},
+		{Id: "m1", Name: "SharedDrives", MimeType: gdrive.FolderMimeType, Parents: []string{"rootid"}},
+		{Id: "m2", Name: "hidden.txt", Parents: []string{"m1"}},
+	}, map[string]string{"rootid": ""})
+	team := &googleDrive.File{Id: "drv1", DriveId: "drv1", Name: "Team", MimeType: gdrive.FolderMimeType}
+	addSharedDrives(index, []sharedDrive{{folder: team, files: []*googleDrive.File{
+		{Id: "t1", Name: "plan.txt", DriveId: "drv1", Parents: []string{"drv1"}},
+		{Id: "t2", Name: "sub", DriveId: "drv1", MimeType: gdrive.FolderMimeType, Parents: []string{"drv1"}},
+		{Id: "t3", Name: "deep.txt", DriveId: "drv1", Parents: []string{"t2"}},
+	}}})
+
+	want := "SharedDrives,SharedDrives/Team,SharedDrives/Team/plan.txt,SharedDrives/Team/sub,SharedDrives/Team/sub/deep.txt,doc.txt"
+	if got := indexPaths(index); got != want {
+		t.Errorf("index = %s, want %s", got, want)
+	}
+	if f := index["SharedDrives"]; f.Id != gdrive.SharedDrivesID || !gdrive.IsVirtual(f) {
+		t.Errorf("SharedDrives = %+v, want the virtual folder hiding the My Drive one", f)
+	}
+	if f := index["SharedDrives/Team"]; f != team || !gdrive.IsVirtual(f) {
+		t.Errorf("SharedDrives/Team = %+v, want the drive's top folder", f)
+	}
+}
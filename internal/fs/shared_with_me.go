@@ -0,0 +1,167 @@
+package fs
+
+import (
+	gdrive "GDrive/internal/drive"
+	"log"
+	p "path"
+	"strings"
+
+	"github.com/winfsp/cgofuse/fuse"
+	googleDrive "google.golang.org/api/drive/v3"
+)
+
+// shortcutProperty marks an index entry as a shortcut shown as its target.
+// The entry is a copy of the target, so that reads get the target's
+// content, with the shortcut's ID kept in this app property.
+const shortcutProperty = "gdrivefs.shortcut"
+
+// listSharedWithMe lists the files shared with the user for the index, or
+// nothing if they are not shown. Like shared drives, they are only left out
+// if Drive refuses to list them.
+func (fs *GDriveFS) listSharedWithMe() ([]*googleDrive.File, error) {
+	if !fs.Drive.SharedWithMe() {
+		return nil, nil
+	}
+	files, err := fs.Drive.ListSharedWithMe()
+	if gdrive.IsNetworkError(err) {
+		return nil, err
+	}
+	if err != nil {
+		log.Printf("Files shared with me left out: %v", err)
+		return nil, nil
+	}
+	return files, nil
+}
+
+// notSharedWithMe returns files without the shared files that are not in a
+// My Drive folder. Drive lists those without parents, so they would
+// otherwise end up at the top of My Drive.
+func notSharedWithMe(files, shared []*googleDrive.File) []*googleDrive.File {
+	if len(shared) == 0 {
+		return files
+	}
+	skip := make(map[string]bool, len(shared))
+	for _, f := range shared {
+		skip[f.Id] = true
+	}
+	kept := make([]*googleDrive.File, 0, len(files))
+	for _, f := range files {
+		if !skip[f.Id] || len(f.Parents) > 0 {
+			kept = append(kept, f)
+		}
+	}
+	return kept
+}
+
+// addSharedWithMe adds the SharedWithMe folder to index with the shared
+// files in it and, for shared folders, their contents found in files.
+func addSharedWithMe(index map[string]*googleDrive.File, files, shared []*googleDrive.File) {
+	top := gdrive.SharedWithMeFolder()
+	addVirtualFolder(index, top)
+	tops := make(map[string]string, len(shared))
+	all := make([]*googleDrive.File, 0, len(files)+len(shared))
+	all = append(all, files...)
+	for _, f := range shared {
+		tops[f.Id] = p.Join(top.Name, f.Name)
+		// the listed names were made unique, so they go last
+		all = append(all, f)
+	}
+	addTree(index, all, tops)
+}
+
+// addShortcutTargets replaces the shortcuts in index whose targets are in
+// files with views of their targets, and fills folder shortcuts with the
+// target's contents. Shortcuts inside those are left as they are.
+func addShortcutTargets(index map[string]*googleDrive.File, files []*googleDrive.File) {
+	byID := make(map[string]*googleDrive.File, len(files))
+	for _, f := range files {
+		byID[f.Id] = f
+	}
+	shortcuts := make(map[string]*googleDrive.File)
+	for path, f := range index {
+		if f.MimeType == gdrive.ShortcutMimeType && f.ShortcutDetails != nil {
+			shortcuts[path] = f
+		}
+	}
+	for path, sc := range shortcuts {
+		target, ok := byID[sc.ShortcutDetails.TargetId]
+		if !ok {
+			continue
+		}
+		if gdrive.IsFolder(target) {
+			addTree(index, files, map[string]string{target.Id: path})
+		}
+		index[path] = shortcutView(sc, target)
+	}
+}
+
+// shortcutView returns the index entry for the shortcut sc to target. It
+// can be edited like the target, but renamed, moved and trashed like the
+// shortcut.
+func shortcutView(sc, target *googleDrive.File) *googleDrive.File {
+	view := *target
+	view.Name = sc.Name
+	view.Parents = sc.Parents
+	view.DriveId = sc.DriveId
+	view.AppProperties = map[string]string{shortcutProperty: sc.Id}
+	if target.Capabilities != nil && sc.Capabilities != nil {
+		caps := *target.Capabilities
+		caps.CanRename = sc.Capabilities.CanRename
+		caps.CanTrash = sc.Capabilities.CanTrash
+		caps.CanMoveItemWithinDrive = sc.Capabilities.CanMoveItemWithinDrive
+		view.Capabilities = &caps
+	}
+	return &view
+}
+
+// driveFileID returns the ID to rename, move or trash for the index entry
+// f: the shortcut's for shortcut views, else f's own.
+func driveFileID(f *googleDrive.File) string {
+	if id := f.AppProperties[shortcutProperty]; id != "" {
+		return id
+	}
+	return f.Id
+}
+
+// addsToMyDrive reports whether renaming oldpath to newpath takes a file
+// shared with the user into My Drive.
+func (fs *GDriveFS) addsToMyDrive(oldpath, newpath string) bool {
+	top := gdrive.SharedWithMeDir + "/"
+	return fs.Drive.SharedWithMe() && strings.HasPrefix(oldpath, top) &&
+		!strings.HasPrefix(newpath, top) && fs.driveOf(newpath) == ""
+}
+
+// addToMyDrive adds the shared file f to My Drive at newpath by creating a
+// shortcut, as Drive's "Add to My Drive" does. f stays in SharedWithMe.
+func (fs *GDriveFS) addToMyDrive(f *googleDrive.File, newpath string) int {
+	if gdrive.IsVirtual(f) {
+		return -fuse.EPERM
+	}
+	if !fs.canAddTo(newpath) {
+		return -fuse.EACCES
+	}
+	if f.Id == "" || fs.isOffline() {
+		return -fuse.EAGAIN
+	}
+	sc, err := fs.Drive.CreateShortcut(f.Id, p.Base(newpath), fs.parentIDFor(newpath))
+	if gdrive.IsNetworkError(err) {
+		fs.setOffline(true)
+		return -fuse.EAGAIN
+	} else if gdrive.IsPermissionDenied(err) {
+		log.Printf("adding to My Drive refused: %v", err)
+		return -fuse.EACCES
+	} else if err != nil {
+		log.Printf("adding to My Drive failed: %v", err)
+		return -fuse.EIO
+	}
+	log.Printf("added %s to My Drive as %s", f.Name, newpath)
+	fs.mu.Lock()
+	fs.index[newpath] = shortcutView(sc, f)
+	fs.mu.Unlock()
+	fs.negative.add(newpath)
+	if gdrive.IsFolder(f) {
+		// the folder's contents come with the next listing
+		fs.scheduleRefresh()
+	}
+	return 0
+}
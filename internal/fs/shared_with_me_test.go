@@ -0,0 +1,94 @@
+package fs
+
+import (
+	"strings"
+	"testing"
+
+	gdrive "GDrive/internal/drive"
+
+	googleDrive "google.golang.org/api/drive/v3"
+)
+
+// sharedFiles returns a listing of My Drive with a folder and a file shared
+// with the user, and another shared file added to My Drive. Drive lists the
+// shared items without parents.
+func sharedFiles() (files, shared []*googleDrive.File) {
+	folder := &googleDrive.File{Id: "sf", Name: "team", MimeType: gdrive.FolderMimeType}
+	lone := &googleDrive.File{Id: "sl", Name: "notes.txt"}
+	added := &googleDrive.File{Id: "sa", Name: "added.txt", Parents: []string{"rootid"}}
+	files = []*googleDrive.File{
+		{Id: "d1", Name: "doc.txt", Parents: []string{"rootid"}},
+		{Id: "in", Name: "inner.txt", Parents: []string{"sf"}},
+		folder, lone, added,
+	}
+	return files, []*googleDrive.File{folder, lone, added}
+}
+
+func TestNotSharedWithMe(t *testing.T) {
+	files, shared := sharedFiles()
+	if got := notSharedWithMe(files, nil); len(got) != len(files) {
+		t.Errorf("notSharedWithMe without shared files dropped %d files", len(files)-len(got))
+	}
+	var ids []string
+	for _, f := range notSharedWithMe(files, shared) {
+		ids = append(ids, f.Id)
+	}
+	if got := strings.Join(ids, ","); got != "d1,in,sa" {
+		t.Errorf("notSharedWithMe kept %s, want d1,in,sa", got)
+	}
+}
+
+func TestAddSharedWithMe(t *testing.T) {
+	files, shared := sharedFiles()
+	index := make(map[string]*googleDrive.File)
+	tops := map[string]string{"rootid": ""}
+	addTree(index, notSharedWithMe(files, shared), tops)
+	addSharedWithMe(index, files, shared)
+
+	want := "SharedWithMe,SharedWithMe/added.txt,SharedWithMe/notes.txt,SharedWithMe/team,SharedWithMe/team/inner.txt,added.txt,doc.txt"
+	if got := indexPaths(index); got != want {
+		t.Errorf("index = %s, want %s", got, want)
+	}
+	if f := index["SharedWithMe"]; !gdrive.IsVirtual(f) {
+		t.Errorf("SharedWithMe = %+v, want the virtual folder", f)
+	}
+	if f := index["SharedWithMe/team/inner.txt"]; f.Id != "in" {
+		t.Errorf("SharedWithMe/team/inner.txt = %s, want in", f.Id)
+	}
+}
+
+func TestAddShortcutTargets(t *testing.T) {
+	files, _ := sharedFiles()
+	files[2].Capabilities = &googleDrive.FileCapabilities{CanEdit: true, CanRename: true, CanAddChildren: true}
+	link := &googleDrive.File{
+		Id: "sc1", Name: "link", Parents: []string{"rootid"}, MimeType: gdrive.ShortcutMimeType,
+		ShortcutDetails: &googleDrive.FileShortcutDetails{TargetId: "sf"},
+		Capabilities:    &googleDrive.FileCapabilities{CanRename: false, CanTrash: true},
+	}
+	dangling := &googleDrive.File{
+		Id: "sc2", Name: "gone", Parents: []string{"rootid"}, MimeType: gdrive.ShortcutMimeType,
+		ShortcutDetails: &googleDrive.FileShortcutDetails{TargetId: "missing"},
+	}
+	index := map[string]*googleDrive.File{"link": link, "gone": dangling}
+	addShortcutTargets(index, files)
+
+	if got := indexPaths(index); got != "gone,link,link/inner.txt" {
+		t.Errorf("index = %s, want gone,link,link/inner.txt", got)
+	}
+	view := index["link"]
+	if view.Id != "sf" || view.Name != "link" || !gdrive.IsFolder(view) || view.Parents[0] != "rootid" {
+		t.Errorf("link = %+v, want a view of team named link", view)
+	}
+	if caps := view.Capabilities; !caps.CanEdit || !caps.CanAddChildren || caps.CanRename || !caps.CanTrash {
+		t.Errorf("link capabilities = %+v, want edits from team and renames from the shortcut", caps)
+	}
+	if id := driveFileID(view); id != "sc1" {
+		t.Errorf("driveFileID(link) = %s, want the shortcut sc1", id)
+	}
+	if index["gone"] != dangling || driveFileID(dangling) != "sc2" {
+		t.Errorf("shortcut without a listed target was changed: %+v", index["gone"])
+	}
+	if files[2].Name != "team" || files[2].AppProperties != nil {
+		t.Errorf("target was modified: %+v", files[2])
+	}
+}
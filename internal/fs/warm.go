@@ -0,0 +1,178 @@
+package fs
+
+import (
+	"fmt"
+	"io"
+	"log"
+	p "path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"GDrive/internal/control"
+)
+
+// WarmReport summarises a cache warming run.
+type WarmReport struct {
+	Files           int   `json:"files"`
+	Downloaded      int   `json:"downloaded"`
+	AlreadyCached   int   `json:"alreadyCached"`
+	Skipped         int   `json:"skipped"`
+	Failed          int   `json:"failed"`
+	BytesDownloaded int64 `json:"bytesDownloaded"`
+	BytesCached     int64 `json:"bytesCached"`
+}
+
+// Warm downloads every file matching patterns into the persistent caches.
+// Patterns are paths or path.Match globs relative to the mount root; a
+// pattern matching a directory covers everything below it. One line per
+// file is written to progress.
+func (fs *GDriveFS) Warm(patterns []string, parallel int, progress io.Writer) (WarmReport, error) {
+	var report WarmReport
+	if fs.blocks == nil && fs.l2 == nil {
+		return report, fmt.Errorf("no persistent cache configured (enable the block cache or a second-level cache)")
+	}
+	paths, err := fs.match(patterns)
+	if err != nil {
+		return report, err
+	}
+	if parallel < 1 {
+		parallel = 1
+	}
+	report.Files = len(paths)
+
+	var mu sync.Mutex
+	done := 0
+	work := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < parallel; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range work {
+				status, downloaded, cached := fs.warmFile(path)
+				mu.Lock()
+				done++
+				switch status {
+				case "downloaded":
+					report.Downloaded++
+				case "cached":
+					report.AlreadyCached++
+				case "failed":
+					report.Failed++
+				default:
+					report.Skipped++
+				}
+				report.BytesDownloaded += downloaded
+				report.BytesCached += cached
+				fmt.Fprintf(progress, "[%d/%d] %s: %s\n", done, len(paths), path, status)
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, path := range paths {
+		work <- path
+	}
+	close(work)
+	wg.Wait()
+	return report, nil
+}
+
+// warmFile caches one file and reports what happened and how many bytes
+// were downloaded and already present.
+func (fs *GDriveFS) warmFile(path string) (status string, downloaded, cached int64) {
+	fs.mu.RLock()
+	file, ok := fs.index[path]
+	fs.mu.RUnlock()
+	if !ok || file.Id == "" {
+		return "skipped (not on Drive)", 0, 0
+	}
+	if fs.useBlocks(file) {
+		bs := fs.blocks.BlockSize()
+		version := blockVersion(file)
+		for idx := int64(0); idx*bs < file.Size; idx++ {
+			size := bs
+			if rest := file.Size - idx*bs; rest < size {
+				size = rest
+			}
+			if fs.blocks.HasBlock(file.Id, version, idx) {
+				cached += size
+				continue
+			}
+			if _, errc := fs.block(file, idx); errc != 0 {
+				return "failed", downloaded, cached
+			}
+			downloaded += size
+		}
+		if downloaded == 0 {
+			return "cached", 0, cached
+		}
+		return "downloaded", downloaded, cached
+	}
+	if fs.l2 == nil {
+		return "skipped (Google document, no second-level cache)", 0, 0
+	}
+	if info, found, _ := fs.l2.Stat(contentKey(file)); found {
+		return "cached", 0, info.Size
+	}
+	data, errc := fs.content(path)
+	if errc != 0 {
+		return "failed", 0, 0
+	}
+	return "downloaded", int64(len(data)), 0
+}
+
+// match expands patterns against the index into a sorted list of files.
+func (fs *GDriveFS) match(patterns []string) ([]string, error) {
+	trimmed := make([]string, len(patterns))
+	for i, pat := range patterns {
+		trimmed[i] = strings.Trim(pat, "/")
+		if _, err := p.Match(trimmed[i], ""); err != nil {
+			return nil, fmt.Errorf("bad pattern %q: %v", pat, err)
+		}
+	}
+	var paths []string
+	fs.mu.RLock()
+	for key, file := range fs.index {
+		if file.MimeType == "application/vnd.google-apps.folder" {
+			continue
+		}
+		if matchesAny(trimmed, key) {
+			paths = append(paths, key)
+		}
+	}
+	fs.mu.RUnlock()
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// matchesAny reports whether key or one of its parent directories matches
+// one of patterns. An empty pattern matches everything.
+func matchesAny(patterns []string, key string) bool {
+	for _, pat := range patterns {
+		if pat == "" {
+			return true
+		}
+		for k := key; k != "." && k != ""; k = p.Dir(k) {
+			if ok, _ := p.Match(pat, k); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// serveControl registers the mount's control socket actions.
+func (fs *GDriveFS) serveControl(srv *control.Server) {
+	srv.Handle("warm", func(req control.Request, progress io.Writer) (interface{}, error) {
+		return fs.Warm(req.Paths, req.Parallel, progress)
+	})
+	srv.Handle("unmount", func(req control.Request, progress io.Writer) (interface{}, error) {
+		log.Printf("Unmount requested over control socket")
+		// unmount after the reply is sent, since it closes the socket
+		time.AfterFunc(100*time.Millisecond, func() { fs.host.Unmount() })
+		return map[string]string{"mountPoint": fs.mountPoint}, nil
+	})
+	go srv.Serve()
+}
@@ -0,0 +1,57 @@
+package fs
+
+import (
+	"reflect"
+	"testing"
+
+	gdrive "GDrive/internal/drive"
+
+	googleDrive "google.golang.org/api/drive/v3"
+)
+
+func TestMatchesAny(t *testing.T) {
+	for _, tt := range []struct {
+		patterns []string
+		key      string
+		want     bool
+	}{
+		{[]string{""}, "a/b.txt", true},
+		{[]string{"a/b.txt"}, "a/b.txt", true},
+		{[]string{"a"}, "a/b/c.txt", true},
+		{[]string{"a/b"}, "a/bc.txt", false},
+		{[]string{"*.jpg"}, "x.jpg", true},
+		{[]string{"*.jpg"}, "dir/x.jpg", false},
+		{[]string{"images/*.jpg"}, "images/x.jpg", true},
+		{[]string{"images/*"}, "images/sub/x.jpg", true},
+		{[]string{"data/train-?"}, "data/train-1/part.bin", true},
+		{[]string{"docs", "*.jpg"}, "x.jpg", true},
+		{[]string{"docs"}, "documents/a.txt", false},
+		{nil, "a.txt", false},
+	} {
+		if got := matchesAny(tt.patterns, tt.key); got != tt.want {
+			t.Errorf("matchesAny(%q, %s) = %v, want %v", tt.patterns, tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	fs := newTestFS(t)
+	fs.index["images"] = &googleDrive.File{Name: "images", MimeType: gdrive.FolderMimeType}
+	for _, key := range []string{"images/a.jpg", "images/b.png", "notes.txt"} {
+		fs.index[key] = &googleDrive.File{}
+	}
+	patterns := []string{"/images/", "*.txt"}
+	got, err := fs.match(patterns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"images/a.jpg", "images/b.png", "notes.txt"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("match = %q, want %q", got, want)
+	}
+	if patterns[0] != "/images/" {
+		t.Errorf("match changed the caller's patterns to %q", patterns)
+	}
+	if _, err := fs.match([]string{"[a"}); err == nil {
+		t.Error("match accepted a malformed pattern")
+	}
+}
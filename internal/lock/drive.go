@@ -0,0 +1,157 @@
+package lock
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	gdrive "GDrive/internal/drive"
+)
+
+// propertyStore is the part of the Drive service leases are kept in.
+type propertyStore interface {
+	GetAppProperties(fileID string) (map[string]string, int64, error)
+	SetAppProperties(fileID string, props map[string]string) (int64, error)
+}
+
+// DriveBackend records leases in the appProperties of the anchoring Drive
+// file, as "<owner>|<expiry in unix milliseconds>". It needs no extra
+// infrastructure, but it is best-effort: Drive has no compare-and-set, so
+// two owners that both read a lease as free and write it at nearly the
+// same time can each read back their own record and both hold the lease.
+// Reading the record back after writing only narrows that window.
+//
+// Every write bumps the file's version, so the backend remembers the
+// versions its own writes moved between; see OwnChange.
+type DriveBackend struct {
+	drv propertyStore
+
+	mu    sync.Mutex
+	bumps map[string]map[int64]int64 // file ID -> version before -> after own write
+}
+
+// NewDriveBackend stores leases through drv.
+func NewDriveBackend(drv *gdrive.DriveService) *DriveBackend {
+	return newDriveBackend(drv)
+}
+
+func newDriveBackend(drv propertyStore) *DriveBackend {
+	return &DriveBackend{drv: drv, bumps: make(map[string]map[int64]int64)}
+}
+
+// propertyKey maps a lease name to an appProperties key short enough for
+// Drive's 124 byte limit on key plus value.
+func propertyKey(name string) string {
+	sum := sha1.Sum([]byte(name))
+	return "gdrivefs-lock-" + hex.EncodeToString(sum[:8])
+}
+
+// record returns the owner and expiry stored for name on fileID, and the
+// file's version.
+func (d *DriveBackend) record(fileID, name string) (string, time.Time, int64, error) {
+	props, version, err := d.drv.GetAppProperties(fileID)
+	if err != nil {
+		return "", time.Time{}, 0, err
+	}
+	owner, expiry, ok := strings.Cut(props[propertyKey(name)], "|")
+	if !ok {
+		return "", time.Time{}, version, nil
+	}
+	ms, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil {
+		return "", time.Time{}, version, nil
+	}
+	return owner, time.UnixMilli(ms), version, nil
+}
+
+// write stores value for name on fileID, whose version was before, and
+// remembers the version the write moved it to.
+func (d *DriveBackend) write(fileID, name, value string, before int64) error {
+	after, err := d.drv.SetAppProperties(fileID, map[string]string{propertyKey(name): value})
+	if err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.bumps[fileID] == nil {
+		d.bumps[fileID] = make(map[int64]int64)
+	}
+	d.bumps[fileID][before] = after
+	return nil
+}
+
+// leaseValue is the record of a lease for owner expiring after ttl.
+func leaseValue(owner string, ttl time.Duration) string {
+	return fmt.Sprintf("%s|%d", owner, time.Now().Add(ttl).UnixMilli())
+}
+
+// Acquire implements Backend. Expired records are taken over.
+func (d *DriveBackend) Acquire(fileID, name, owner string, ttl time.Duration) (bool, error) {
+	current, expiry, version, err := d.record(fileID, name)
+	if err != nil {
+		return false, err
+	}
+	if current != "" && current != owner && time.Now().Before(expiry) {
+		return false, nil
+	}
+	if err := d.write(fileID, name, leaseValue(owner, ttl), version); err != nil {
+		return false, err
+	}
+	current, _, _, err = d.record(fileID, name)
+	if err != nil {
+		return false, err
+	}
+	return current == owner, nil
+}
+
+// Renew implements Backend.
+func (d *DriveBackend) Renew(fileID, name, owner string, ttl time.Duration) (bool, error) {
+	current, _, version, err := d.record(fileID, name)
+	if err != nil {
+		return false, err
+	}
+	if current != owner {
+		return false, nil
+	}
+	return true, d.write(fileID, name, leaseValue(owner, ttl), version)
+}
+
+// Release implements Backend. The record is cleared rather than removed,
+// which other owners read as free.
+func (d *DriveBackend) Release(fileID, name, owner string) error {
+	defer func() {
+		d.mu.Lock()
+		delete(d.bumps, fileID)
+		d.mu.Unlock()
+	}()
+	current, _, version, err := d.record(fileID, name)
+	if err != nil || current != owner {
+		return err
+	}
+	return d.write(fileID, name, "", version)
+}
+
+// OwnChange reports whether the version of fileID moved from from to to
+// only through this backend's lease writes, so that the content did not
+// change. A change by someone else between reading and writing a lease is
+// counted as own; the window is one request long.
+func (d *DriveBackend) OwnChange(fileID string, from, to int64) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	bumps := d.bumps[fileID]
+	for v, steps := from, 0; steps <= len(bumps); steps++ {
+		if v == to {
+			return true
+		}
+		next, ok := bumps[v]
+		if !ok {
+			return false
+		}
+		v = next
+	}
+	return false
+}
@@ -0,0 +1,121 @@
+package lock
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeProperties is an in-memory propertyStore that bumps a file's version
+// on every write, as Drive does.
+type fakeProperties struct {
+	mu       sync.Mutex
+	props    map[string]map[string]string
+	versions map[string]int64
+}
+
+func newFakeProperties() *fakeProperties {
+	return &fakeProperties{props: make(map[string]map[string]string), versions: make(map[string]int64)}
+}
+
+func (f *fakeProperties) GetAppProperties(fileID string) (map[string]string, int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	props := make(map[string]string)
+	for k, v := range f.props[fileID] {
+		props[k] = v
+	}
+	return props, f.versions[fileID], nil
+}
+
+func (f *fakeProperties) SetAppProperties(fileID string, props map[string]string) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.props[fileID] == nil {
+		f.props[fileID] = make(map[string]string)
+	}
+	for k, v := range props {
+		f.props[fileID][k] = v
+	}
+	f.versions[fileID] += 2
+	return f.versions[fileID], nil
+}
+
+// edit stands for a change by someone else.
+func (f *fakeProperties) edit(fileID string) int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.versions[fileID]++
+	return f.versions[fileID]
+}
+
+func TestDriveBackendLease(t *testing.T) {
+	b := newDriveBackend(newFakeProperties())
+	if ok, err := b.Acquire("f", "file:f", "a", time.Minute); !ok || err != nil {
+		t.Fatalf("Acquire by a = %v, %v", ok, err)
+	}
+	if ok, _ := b.Acquire("f", "file:f", "b", time.Minute); ok {
+		t.Error("Acquire by b succeeded while a holds the lease")
+	}
+	if ok, _ := b.Renew("f", "file:f", "b", time.Minute); ok {
+		t.Error("Renew by b succeeded")
+	}
+	if ok, err := b.Renew("f", "file:f", "a", time.Minute); !ok || err != nil {
+		t.Errorf("Renew by a = %v, %v", ok, err)
+	}
+	if err := b.Release("f", "file:f", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := b.Acquire("f", "file:f", "b", time.Minute); !ok {
+		t.Error("Acquire by b failed after release")
+	}
+}
+
+func TestDriveBackendTakesOverExpired(t *testing.T) {
+	b := newDriveBackend(newFakeProperties())
+	b.Acquire("f", "file:f", "a", -time.Second)
+	if ok, _ := b.Acquire("f", "file:f", "b", time.Minute); !ok {
+		t.Error("expired lease not taken over")
+	}
+}
+
+func TestDriveBackendOwnChange(t *testing.T) {
+	store := newFakeProperties()
+	b := newDriveBackend(store)
+	b.Acquire("f", "file:f", "a", time.Minute)
+	_, base, _ := store.GetAppProperties("f")
+	b.Renew("f", "file:f", "a", time.Minute)
+	b.Renew("f", "file:f", "a", time.Minute)
+	_, now, _ := store.GetAppProperties("f")
+
+	if !b.OwnChange("f", base, now) {
+		t.Errorf("renewals from %d to %d not recognized as own", base, now)
+	}
+	if !b.OwnChange("f", base, base) {
+		t.Error("unchanged version not recognized as own")
+	}
+	if b.OwnChange("g", base, now) {
+		t.Error("change of another file recognized as own")
+	}
+
+	edited := store.edit("f")
+	if b.OwnChange("f", base, edited) {
+		t.Error("edit by someone else recognized as own")
+	}
+	b.Renew("f", "file:f", "a", time.Minute)
+	_, after, _ := store.GetAppProperties("f")
+	if b.OwnChange("f", base, after) {
+		t.Error("renewal after an edit by someone else hides the edit")
+	}
+	if !b.OwnChange("f", edited, after) {
+		t.Error("renewal after the edit not recognized as own")
+	}
+}
+
+func TestManagerRaisesShortTTL(t *testing.T) {
+	m := NewManager(newDriveBackend(newFakeProperties()), 0)
+	defer m.Close()
+	if m.ttl != MinTTL {
+		t.Errorf("ttl = %s, want %s", m.ttl, MinTTL)
+	}
+}
@@ -0,0 +1,180 @@
+// Package lock provides advisory write leases shared between mounts of the
+// same Drive, so that two writers do not update or create a file at once.
+package lock
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Supported lease backends.
+const (
+	BackendRedis = "redis"
+	BackendDrive = "drive"
+)
+
+// MinTTL is the shortest lease ttl. Leases are renewed three times per ttl,
+// so shorter ones would be renewed more often than Drive can be asked.
+const MinTTL = 3 * time.Second
+
+// ErrLocked is returned when another owner holds an unexpired lease.
+var ErrLocked = errors.New("lease held by another writer")
+
+// Backend stores leases. A lease is named by name and anchored on the Drive
+// file fileID; backends that keep leases elsewhere ignore the anchor.
+// Leases expire on their own once ttl passes without a renewal.
+type Backend interface {
+	// Acquire takes the lease for owner unless someone else holds it.
+	Acquire(fileID, name, owner string, ttl time.Duration) (bool, error)
+	// Renew extends a lease owner holds; it reports false if it was lost.
+	Renew(fileID, name, owner string, ttl time.Duration) (bool, error)
+	// Release gives up a lease owner holds.
+	Release(fileID, name, owner string) error
+}
+
+// lease is a lease held by this process.
+type lease struct {
+	fileID string
+	refs   int
+}
+
+// Manager holds leases for one mount and renews them in the background
+// until they are released.
+type Manager struct {
+	backend Backend
+	owner   string
+	ttl     time.Duration
+
+	mu   sync.Mutex
+	held map[string]*lease
+	stop chan struct{}
+	once sync.Once
+}
+
+// NewManager starts renewing leases taken through backend. Leases not
+// renewed within ttl are treated as stale by other owners; ttl is raised to
+// MinTTL if shorter.
+func NewManager(backend Backend, ttl time.Duration) *Manager {
+	if ttl < MinTTL {
+		ttl = MinTTL
+	}
+	id := make([]byte, 8)
+	rand.Read(id)
+	m := &Manager{
+		backend: backend,
+		owner:   hex.EncodeToString(id),
+		ttl:     ttl,
+		held:    make(map[string]*lease),
+		stop:    make(chan struct{}),
+	}
+	go m.renewLoop()
+	return m
+}
+
+// Owner identifies this manager in lease records.
+func (m *Manager) Owner() string {
+	return m.owner
+}
+
+// Acquire takes the lease name anchored on fileID, or returns ErrLocked if
+// another owner holds it. Leases already held by this manager are shared
+// and released once every holder has released them.
+func (m *Manager) Acquire(fileID, name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if l, ok := m.held[name]; ok {
+		l.refs++
+		return nil
+	}
+	ok, err := m.backend.Acquire(fileID, name, m.owner, m.ttl)
+	if err != nil {
+		return fmt.Errorf("failed to acquire lease %s: %w", name, err)
+	}
+	if !ok {
+		return ErrLocked
+	}
+	m.held[name] = &lease{fileID: fileID, refs: 1}
+	return nil
+}
+
+// OwnChange reports whether the version of fileID moved from from to to
+// only through this manager's own lease writes. Backends that keep leases
+// outside Drive never change versions, so they report false.
+func (m *Manager) OwnChange(fileID string, from, to int64) bool {
+	tracker, ok := m.backend.(interface {
+		OwnChange(fileID string, from, to int64) bool
+	})
+	return ok && tracker.OwnChange(fileID, from, to)
+}
+
+// Release drops one hold on the lease name.
+func (m *Manager) Release(name string) {
+	m.mu.Lock()
+	l, ok := m.held[name]
+	if !ok {
+		m.mu.Unlock()
+		return
+	}
+	l.refs--
+	if l.refs > 0 {
+		m.mu.Unlock()
+		return
+	}
+	delete(m.held, name)
+	m.mu.Unlock()
+	if err := m.backend.Release(l.fileID, name, m.owner); err != nil {
+		log.Printf("Failed to release lease %s: %v", name, err)
+	}
+}
+
+// Close stops renewal and releases every lease still held.
+func (m *Manager) Close() {
+	m.once.Do(func() { close(m.stop) })
+	m.mu.Lock()
+	held := m.held
+	m.held = make(map[string]*lease)
+	m.mu.Unlock()
+	for name, l := range held {
+		if err := m.backend.Release(l.fileID, name, m.owner); err != nil {
+			log.Printf("Failed to release lease %s: %v", name, err)
+		}
+	}
+}
+
+// renewLoop extends held leases three times per ttl so that one missed
+// renewal does not let them expire.
+func (m *Manager) renewLoop() {
+	ticker := time.NewTicker(m.ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.stop:
+			return
+		case <-ticker.C:
+		}
+		m.mu.Lock()
+		held := make(map[string]string, len(m.held))
+		for name, l := range m.held {
+			held[name] = l.fileID
+		}
+		m.mu.Unlock()
+		for name, fileID := range held {
+			ok, err := m.backend.Renew(fileID, name, m.owner, m.ttl)
+			if err != nil {
+				log.Printf("Failed to renew lease %s: %v", name, err)
+				continue
+			}
+			if !ok {
+				log.Printf("Lease %s expired and was taken over by another writer", name)
+				m.mu.Lock()
+				delete(m.held, name)
+				m.mu.Unlock()
+			}
+		}
+	}
+}
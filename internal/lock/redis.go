@@ -0,0 +1,55 @@
+package lock
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+var ctx = context.Background()
+
+// renewScript extends a lease only if it is still held by the caller.
+var renewScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("pexpire", KEYS[1], ARGV[2])
+end
+return 0`)
+
+// releaseScript deletes a lease only if it is still held by the caller.
+var releaseScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("del", KEYS[1])
+end
+return 0`)
+
+// RedisBackend keeps leases as Redis keys set with NX and an expiry, so a
+// crashed owner's lease disappears after its TTL.
+type RedisBackend struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisBackend connects to the Redis server at addr.
+func NewRedisBackend(addr string) *RedisBackend {
+	return &RedisBackend{
+		client: redis.NewClient(&redis.Options{Addr: addr}),
+		prefix: "gdrivefs:lock:",
+	}
+}
+
+// Acquire implements Backend.
+func (r *RedisBackend) Acquire(fileID, name, owner string, ttl time.Duration) (bool, error) {
+	return r.client.SetNX(ctx, r.prefix+name, owner, ttl).Result()
+}
+
+// Renew implements Backend.
+func (r *RedisBackend) Renew(fileID, name, owner string, ttl time.Duration) (bool, error) {
+	n, err := renewScript.Run(ctx, r.client, []string{r.prefix + name}, owner, ttl.Milliseconds()).Int()
+	return n == 1, err
+}
+
+// Release implements Backend.
+func (r *RedisBackend) Release(fileID, name, owner string) error {
+	return releaseScript.Run(ctx, r.client, []string{r.prefix + name}, owner).Err()
+}
@@ -0,0 +1,64 @@
+package lock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestRedisBackend(t *testing.T) {
+	mr := miniredis.RunT(t)
+	r := NewRedisBackend(mr.Addr())
+	const ttl = time.Minute
+
+	if ok, err := r.Acquire("f1", "a.txt", "mount-a", ttl); err != nil || !ok {
+		t.Fatalf("Acquire = %v, %v", ok, err)
+	}
+	if ok, err := r.Acquire("f1", "a.txt", "mount-b", ttl); err != nil || ok {
+		t.Errorf("Acquire of a held lease = %v, %v", ok, err)
+	}
+	if got := mr.TTL("gdrivefs:lock:a.txt"); got != ttl {
+		t.Errorf("lease TTL = %v, want %v", got, ttl)
+	}
+
+	if ok, err := r.Renew("f1", "a.txt", "mount-b", 2*ttl); err != nil || ok {
+		t.Errorf("Renew by another owner = %v, %v", ok, err)
+	}
+	if ok, err := r.Renew("f1", "a.txt", "mount-a", 2*ttl); err != nil || !ok {
+		t.Errorf("Renew = %v, %v", ok, err)
+	}
+	if got := mr.TTL("gdrivefs:lock:a.txt"); got != 2*ttl {
+		t.Errorf("renewed TTL = %v, want %v", got, 2*ttl)
+	}
+
+	// only the owner's release frees the lease
+	if err := r.Release("f1", "a.txt", "mount-b"); err != nil {
+		t.Fatal(err)
+	}
+	if !mr.Exists("gdrivefs:lock:a.txt") {
+		t.Fatal("lease released by another owner")
+	}
+	if err := r.Release("f1", "a.txt", "mount-a"); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := r.Acquire("f1", "a.txt", "mount-b", ttl); err != nil || !ok {
+		t.Errorf("Acquire after Release = %v, %v", ok, err)
+	}
+}
+
+func TestRedisBackendExpiry(t *testing.T) {
+	mr := miniredis.RunT(t)
+	r := NewRedisBackend(mr.Addr())
+	if ok, _ := r.Acquire("f1", "a.txt", "mount-a", time.Minute); !ok {
+		t.Fatal("Acquire failed")
+	}
+	// a crashed owner stops renewing and its lease runs out
+	mr.FastForward(time.Minute)
+	if ok, err := r.Renew("f1", "a.txt", "mount-a", time.Minute); err != nil || ok {
+		t.Errorf("Renew of an expired lease = %v, %v", ok, err)
+	}
+	if ok, err := r.Acquire("f1", "a.txt", "mount-b", time.Minute); err != nil || !ok {
+		t.Errorf("Acquire of an expired lease = %v, %v", ok, err)
+	}
+}